@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"syscall"
 
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
@@ -20,14 +21,9 @@ func NewAppCommand(l zerolog.Logger) *cobra.Command {
 		Use:   "app",
 		Short: "Run DNS server application",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			signals := make(chan os.Signal, 1)
-			defer close(signals)
-			defer signal.Stop(signals)
-
-			signal.Notify(signals, os.Interrupt)
-			defer signal.Reset(os.Interrupt)
-
-			ctx, cancel := context.WithCancel(context.Background())
+			// The application drains in-flight queries and
+			// exits on the first signal.
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 			defer cancel()
 
 			application, err := app.New(app.Opts{
@@ -38,13 +34,6 @@ func NewAppCommand(l zerolog.Logger) *cobra.Command {
 				return err
 			}
 
-			go func() {
-				defer cancel()
-				defer application.Shutdown()
-
-				<-signals
-			}()
-
 			if err := application.Run(ctx); err != nil {
 				return err
 			}
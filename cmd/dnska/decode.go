@@ -1,38 +1,252 @@
 package main
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 
-	"github.com/davecgh/go-spew/spew"
 	"github.com/spf13/cobra"
 
+	"github.com/rokkerruslan/dnska/pkg/pcap"
 	"github.com/rokkerruslan/dnska/pkg/proto"
 )
 
+const (
+	formatAuto = "auto"
+	formatPcap = "pcap"
+)
+
 func NewDecodeCommand() *cobra.Command {
+	var opts struct {
+		Output string
+		Format string
+		Ports  []uint
+	}
+
 	cmd := cobra.Command{
 		Use:   "decode [PATH]",
 		Short: "Try to decode DNS packet from file",
-		Args:  cobra.MinimumNArgs(1),
-		RunE: func(_ *cobra.Command, args []string) error {
-			buf, err := os.ReadFile(args[0])
+		Long: "Decode DNS packet from PATH or from stdin if PATH is omitted or \"-\". The packet\n" +
+			"is raw, hex or base64 (including DoH \"dns\" query parameter) encoded. For pcap and\n" +
+			"pcapng files every DNS message of UDP datagrams and TCP streams is decoded.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in := cmd.InOrStdin()
+			if len(args) == 1 && args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+
+				in = f
+			}
+
+			data, err := io.ReadAll(in)
 			if err != nil {
 				return err
 			}
 
-			dec := proto.NewDecoder()
+			format := opts.Format
+			if format == formatAuto {
+				format = detectFormat(data)
+			}
+
+			if format == formatPcap {
+				ports := make([]uint16, 0, len(opts.Ports))
+				for _, port := range opts.Ports {
+					if port == 0 {
+						ports = nil
+						break
+					}
 
-			msg, err := dec.Decode(buf)
+					ports = append(ports, uint16(port))
+				}
+
+				return decodeCapture(cmd.OutOrStdout(), data, ports, opts.Output)
+			}
+
+			buf, err := unformatPacket(data, format)
 			if err != nil {
-				return fmt.Errorf("failed to decode msg :: error=%v", err)
+				return err
 			}
 
-			spew.Dump(msg)
+			msg, err := proto.NewDecoder().Decode(buf)
+			if err != nil {
+				return fmt.Errorf("failed to decode msg :: error=%v", err)
+			}
 
-			return nil
+			return writeMessage(cmd.OutOrStdout(), msg, opts.Output)
 		},
 	}
 
+	addOutputFlag(&cmd, &opts.Output)
+
+	cmd.Flags().StringVarP(&opts.Format, "format", "f", formatAuto,
+		"format of packet: auto, raw, hex, base64 or pcap (pcap and pcapng)")
+	cmd.Flags().UintSliceVar(&opts.Ports, "port", []uint{53},
+		"ports of DNS messages in pcap files, 0 for all UDP and TCP packets")
+
 	return &cmd
 }
+
+// detectFormat returns the format of packet "data",
+// hex or base64 textual data is checked before raw one.
+func detectFormat(data []byte) string {
+	if pcap.IsCapture(data) {
+		return formatPcap
+	}
+
+	if _, err := decodeHex(data); err == nil {
+		return formatHex
+	}
+
+	if _, err := decodeBase64(data); err == nil {
+		return formatBase64
+	}
+
+	return formatRaw
+}
+
+// unformatPacket is the opposite of formatPacket.
+func unformatPacket(data []byte, format string) ([]byte, error) {
+	switch format {
+	case formatRaw:
+		return data, nil
+	case formatHex:
+		return decodeHex(data)
+	case formatBase64:
+		return decodeBase64(data)
+	}
+
+	return nil, fmt.Errorf("unknown packet format %q", format)
+}
+
+// decodeHex decodes hex dump, the whitespaces, colons
+// and "0x" prefix of the dump are ignored.
+func decodeHex(data []byte) ([]byte, error) {
+	s := strings.TrimPrefix(string(bytes.TrimSpace(data)), "0x")
+	s = strings.Map(func(r rune) rune {
+		if r == ':' || r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+
+		return r
+	}, s)
+
+	if s == "" {
+		return nil, errors.New("empty hex packet")
+	}
+
+	return hex.DecodeString(s)
+}
+
+// decodeBase64 decodes standard or URL base64 encoding with or
+// without padding, the "dns" parameter of DoH URL is accepted too.
+func decodeBase64(data []byte) ([]byte, error) {
+	s := strings.TrimSpace(string(data))
+	if _, after, ok := strings.Cut(s, "dns="); ok {
+		s, _, _ = strings.Cut(after, "&")
+	}
+
+	if s == "" {
+		return nil, errors.New("empty base64 packet")
+	}
+
+	var err error
+	for _, enc := range []*base64.Encoding{
+		base64.StdEncoding,
+		base64.RawStdEncoding,
+		base64.URLEncoding,
+		base64.RawURLEncoding,
+	} {
+		var buf []byte
+		if buf, err = enc.DecodeString(s); err == nil {
+			return buf, nil
+		}
+	}
+
+	return nil, err
+}
+
+// decodeCapture decodes every DNS message of the pcap file, the
+// messages which cannot be decoded are reported and skipped.
+func decodeCapture(w io.Writer, data []byte, ports []uint16, output string) error {
+	r, err := pcap.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	ex := pcap.NewExtractor(r, ports...)
+
+	for i := 0; ; i++ {
+		m, err := ex.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		msg, decodeErr := proto.NewDecoder().Decode(m.Data)
+
+		if err := writeCaptured(w, i, m, msg, decodeErr, output); err != nil {
+			return err
+		}
+	}
+}
+
+type capturedMessage struct {
+	Timestamp time.Time      `json:"timestamp"`
+	Transport string         `json:"transport"`
+	Src       string         `json:"src"`
+	Dst       string         `json:"dst"`
+	Message   *proto.Message `json:"message,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+func writeCaptured(w io.Writer, i int, m pcap.Message, msg proto.Message, decodeErr error, output string) error {
+	switch output {
+	case outputText:
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+
+		if _, err := fmt.Fprintf(w, ";; %s %s %s -> %s\n",
+			m.Timestamp.Format(time.RFC3339Nano), m.Transport, m.Src, m.Dst); err != nil {
+			return err
+		}
+
+		if decodeErr != nil {
+			_, err := fmt.Fprintf(w, ";; failed to decode msg :: error=%v\n", decodeErr)
+			return err
+		}
+
+		return writeMessage(w, msg, output)
+	case outputJSON:
+		out := capturedMessage{
+			Timestamp: m.Timestamp,
+			Transport: m.Transport,
+			Src:       m.Src.String(),
+			Dst:       m.Dst.String(),
+		}
+
+		if decodeErr != nil {
+			out.Error = decodeErr.Error()
+		} else {
+			out.Message = &msg
+		}
+
+		return writeJSON(w, out)
+	}
+
+	return fmt.Errorf("unknown output format %q", output)
+}
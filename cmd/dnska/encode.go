@@ -1,19 +1,126 @@
 package main
 
 import (
-	"errors"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
 
 	"github.com/spf13/cobra"
+
+	"github.com/rokkerruslan/dnska/pkg/proto"
+)
+
+const (
+	inputAuto = "auto"
+	inputText = "text"
+	inputJSON = "json"
+
+	formatRaw    = "raw"
+	formatHex    = "hex"
+	formatBase64 = "base64"
 )
 
 func NewEncodeCommand() *cobra.Command {
+	var opts struct {
+		Input  string
+		Format string
+		Out    string
+	}
+
 	cmd := cobra.Command{
-		Use:   "encode",
+		Use:   "encode [PATH]",
 		Short: "Construct and encodes DNS message",
-		RunE: func(_ *cobra.Command, _ []string) error {
-			return errors.New("not implemented")
+		Long: "Construct DNS message from a textual (dig-style, as printed by lookup and decode)\n" +
+			"or JSON (RFC 8427) description and encode it into the wire format. The description\n" +
+			"is read from PATH or from stdin if PATH is omitted or \"-\".",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in := cmd.InOrStdin()
+			if len(args) == 1 && args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+
+				in = f
+			}
+
+			description, err := io.ReadAll(in)
+			if err != nil {
+				return err
+			}
+
+			msg, err := parseDescription(description, opts.Input)
+			if err != nil {
+				return fmt.Errorf("failed to parse message description :: error=%v", err)
+			}
+
+			buf, err := proto.NewEncoder(make([]byte, 0xffff)).Encode(msg)
+			if err != nil {
+				return fmt.Errorf("failed to encode msg :: error=%v", err)
+			}
+
+			out, err := formatPacket(buf, opts.Format)
+			if err != nil {
+				return err
+			}
+
+			if opts.Out == "" || opts.Out == "-" {
+				_, err = cmd.OutOrStdout().Write(out)
+				return err
+			}
+
+			return os.WriteFile(opts.Out, out, 0o644)
 		},
 	}
 
+	cmd.Flags().StringVarP(&opts.Input, "input", "i", inputAuto,
+		"format of message description: auto, text or json")
+	cmd.Flags().StringVarP(&opts.Format, "format", "f", formatRaw,
+		"format of encoded packet: raw, hex or base64")
+	cmd.Flags().StringVarP(&opts.Out, "out", "w", "",
+		"write encoded packet to the file instead of stdout")
+
 	return &cmd
 }
+
+// parseDescription parses message description, the auto format is
+// json if the description is a JSON object and text otherwise.
+func parseDescription(description []byte, input string) (proto.Message, error) {
+	if input == inputAuto {
+		input = inputText
+		if bytes.HasPrefix(bytes.TrimSpace(description), []byte("{")) {
+			input = inputJSON
+		}
+	}
+
+	switch input {
+	case inputText:
+		return proto.ParseMessage(string(description))
+	case inputJSON:
+		var msg proto.Message
+		err := json.Unmarshal(description, &msg)
+
+		return msg, err
+	}
+
+	return proto.Message{}, fmt.Errorf("unknown input format %q", input)
+}
+
+func formatPacket(buf []byte, format string) ([]byte, error) {
+	switch format {
+	case formatRaw:
+		return buf, nil
+	case formatHex:
+		return []byte(hex.EncodeToString(buf) + "\n"), nil
+	case formatBase64:
+		return []byte(base64.StdEncoding.EncodeToString(buf) + "\n"), nil
+	}
+
+	return nil, fmt.Errorf("unknown packet format %q", format)
+}
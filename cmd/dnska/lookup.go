@@ -6,7 +6,6 @@ import (
 	"net/netip"
 	"time"
 
-	"github.com/davecgh/go-spew/spew"
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
 
@@ -23,6 +22,7 @@ func NewLookupCommand(l zerolog.Logger) *cobra.Command {
 		OnlyAnswer              bool
 		SetRecursionDesiredFlag bool
 		DumpMalformedPackets    bool
+		Output                  string
 	}
 
 	cmd := cobra.Command{
@@ -76,12 +76,10 @@ func NewLookupCommand(l zerolog.Logger) *cobra.Command {
 			}
 
 			if opts.OnlyAnswer {
-				spew.Dump(message.Answer)
-			} else {
-				spew.Dump(message)
+				return writeRecords(cmd.OutOrStdout(), message.Answer, opts.Output)
 			}
 
-			return nil
+			return writeMessage(cmd.OutOrStdout(), message, opts.Output)
 		},
 	}
 
@@ -93,6 +91,8 @@ func NewLookupCommand(l zerolog.Logger) *cobra.Command {
 
 	cmd.Flags().BoolVar(&opts.OnlyAnswer, "only-answer", false, "display only answer part of response")
 
+	addOutputFlag(&cmd, &opts.Output)
+
 	cmd.Flags().BoolVarP(&opts.SetRecursionDesiredFlag, "recursion-desired", "r", false,
 		"set to 1 the recursion desired bit flag in request message")
 
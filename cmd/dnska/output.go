@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rokkerruslan/dnska/pkg/proto"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+func addOutputFlag(cmd *cobra.Command, output *string) {
+	cmd.Flags().StringVarP(output, "output", "o", outputText,
+		"output format: text (presentation format) or json (RFC 8427)")
+}
+
+// writeMessage writes message "m" in "output" format.
+func writeMessage(w io.Writer, m proto.Message, output string) error {
+	switch output {
+	case outputText:
+		_, err := fmt.Fprint(w, m)
+		return err
+	case outputJSON:
+		return writeJSON(w, m)
+	}
+
+	return fmt.Errorf("unknown output format %q", output)
+}
+
+// writeRecords writes the records in "output" format, one
+// record per line for text format and array for json one.
+func writeRecords(w io.Writer, records []proto.ResourceRecord, output string) error {
+	switch output {
+	case outputText:
+		for _, el := range records {
+			if _, err := fmt.Fprintln(w, el); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case outputJSON:
+		if records == nil {
+			records = []proto.ResourceRecord{}
+		}
+
+		return writeJSON(w, records)
+	}
+
+	return fmt.Errorf("unknown output format %q", output)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
@@ -2,7 +2,9 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/pprof"
 	"net/netip"
@@ -26,50 +28,66 @@ type Opts struct {
 type App struct {
 	endpoints []endpoints2.Endpoint
 
+	// closers are closed after the endpoints are stopped,
+	// e.g. the cache saves the snapshot on close.
+	closers []io.Closer
+
 	l zerolog.Logger
 }
 
 func New(opts Opts) (*App, error) {
 	logger := opts.L
 
-	endpointsList, err := setup(logger, opts.EndpointsFilePath)
+	endpointsList, closers, err := setup(logger, opts.EndpointsFilePath)
 	if err != nil {
 		return nil, err
 	}
 
 	return &App{
 		endpoints: endpointsList,
+		closers:   closers,
 		l:         logger,
 	}, nil
 }
 
-func (a *App) Run(_ context.Context) error {
+// Run serves queries until the context is done, then it waits for
+// endpoints to drain the in-flight queries and closes the resolvers.
+// If an endpoint fails, the others are stopped too.
+func (a *App) Run(ctx context.Context) error {
 	if err := a.bootstrap(); err != nil {
 		return fmt.Errorf("failed to bootstrap: %v", err)
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	var wg sync.WaitGroup
 	wg.Add(len(a.endpoints))
 
+	errs := make([]error, len(a.endpoints))
+
 	for i := range a.endpoints {
-		endpoint := a.endpoints[i]
+		i, endpoint := i, a.endpoints[i]
 
 		go func() {
-			endpoint.Start(wg.Done)
+			defer wg.Done()
+
+			if err := endpoint.Start(ctx); err != nil {
+				errs[i] = fmt.Errorf("endpoint %s: %w", endpoint.Name(), err)
+				cancel()
+			}
 		}()
 	}
 
 	wg.Wait()
 
-	return nil
-}
-
-func (a *App) Shutdown() {
-	for _, endpoint := range a.endpoints {
-		if err := endpoint.Stop(); err != nil {
-			a.l.Printf("failed to stop endpoint %s :: error=%s", endpoint.Name(), err)
+	for _, closer := range a.closers {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close: %w", err))
 		}
 	}
+
+	return errors.Join(errs...)
 }
 
 func (a *App) bootstrap() error {
@@ -95,33 +113,156 @@ func (a *App) bootstrap() error {
 
 type endpointsFileConfigurationV0 struct {
 	LocalAddress string `toml:"local-address"`
+
+	UDPWorkers   int `toml:"udp-workers"`
+	UDPQueueSize int `toml:"udp-queue-size"`
+	UDPSockets   int `toml:"udp-sockets"`
+
+	TCPIdleTimeout    string `toml:"tcp-idle-timeout"`
+	TCPMaxConnections int    `toml:"tcp-max-connections"`
+	TCPMaxInFlight    int    `toml:"tcp-max-in-flight"`
+
+	ShutdownGracePeriod string `toml:"shutdown-grace-period"`
+
+	CacheMinTTL string `toml:"cache-min-ttl"`
+	CacheMaxTTL string `toml:"cache-max-ttl"`
+
+	CacheMaxNegativeTTL string `toml:"cache-max-negative-ttl"`
+
+	CacheMaxStaleAge    string `toml:"cache-max-stale-age"`
+	CacheClientTimeout  string `toml:"cache-client-timeout"`
+	CacheStaleAnswerTTL string `toml:"cache-stale-answer-ttl"`
+
+	CachePrefetchThreshold int    `toml:"cache-prefetch-threshold"`
+	CachePrefetchMinHits   uint64 `toml:"cache-prefetch-min-hits"`
+
+	CacheMaxEntries int `toml:"cache-max-entries"`
+	CacheMaxBytes   int `toml:"cache-max-bytes"`
+
+	CacheSnapshotPath     string `toml:"cache-snapshot-path"`
+	CacheSnapshotInterval string `toml:"cache-snapshot-interval"`
 }
 
-func (efc endpointsFileConfigurationV0) InstantiateEndpoints(l zerolog.Logger) ([]endpoints2.Endpoint, error) {
-	resolver := resolve2.NewCacheResolver(
-		resolve2.NewBlacklistResolver(resolve2.BlacklistResolverOpts{
+func (efc endpointsFileConfigurationV0) InstantiateEndpoints(l zerolog.Logger) ([]endpoints2.Endpoint, []io.Closer, error) {
+	cacheMinTTL, err := parseOptionalDuration("cache min ttl", efc.CacheMinTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cacheMaxTTL, err := parseOptionalDuration("cache max ttl", efc.CacheMaxTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cacheMaxNegativeTTL, err := parseOptionalDuration("cache max negative ttl", efc.CacheMaxNegativeTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cacheMaxStaleAge, err := parseOptionalDuration("cache max stale age", efc.CacheMaxStaleAge)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cacheClientTimeout, err := parseOptionalDuration("cache client timeout", efc.CacheClientTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cacheStaleAnswerTTL, err := parseOptionalDuration("cache stale answer ttl", efc.CacheStaleAnswerTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cacheSnapshotInterval, err := parseOptionalDuration("cache snapshot interval", efc.CacheSnapshotInterval)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	udpLocalAddr, err := netip.ParseAddrPort(efc.LocalAddress)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve local addr: %v", err)
+	}
+	tcpLocalAddr := udpLocalAddr
+
+	gracePeriod, err := parseOptionalDuration("shutdown grace period", efc.ShutdownGracePeriod)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	udpOpts := endpoints2.UDPEndpointOpts{
+		Workers:   efc.UDPWorkers,
+		QueueSize: efc.UDPQueueSize,
+		Sockets:   efc.UDPSockets,
+
+		GracePeriod: gracePeriod,
+	}
+
+	tcpOpts := endpoints2.TCPEndpointOpts{
+		MaxConnections: efc.TCPMaxConnections,
+		MaxInFlight:    efc.TCPMaxInFlight,
+
+		GracePeriod: gracePeriod,
+	}
+
+	tcpOpts.IdleTimeout, err = parseOptionalDuration("tcp idle timeout", efc.TCPIdleTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resolver := resolve2.NewCacheResolver(resolve2.CacheResolverOpts{
+		MinTTL:         cacheMinTTL,
+		MaxTTL:         cacheMaxTTL,
+		MaxNegativeTTL: cacheMaxNegativeTTL,
+
+		MaxStaleAge:    cacheMaxStaleAge,
+		ClientTimeout:  cacheClientTimeout,
+		StaleAnswerTTL: cacheStaleAnswerTTL,
+
+		PrefetchThreshold: efc.CachePrefetchThreshold,
+		PrefetchMinHits:   efc.CachePrefetchMinHits,
+
+		MaxEntries: efc.CacheMaxEntries,
+		MaxBytes:   efc.CacheMaxBytes,
+
+		SnapshotPath:     efc.CacheSnapshotPath,
+		SnapshotInterval: cacheSnapshotInterval,
+
+		L: l,
+
+		Pass: resolve2.NewBlacklistResolver(resolve2.BlacklistResolverOpts{
 			AutoReloadInterval: time.Hour,
 			BlacklistURL:       "http://github.com/black",
 			Pass: resolve2.NewChainResolver(
 				l,
 				resolve2.NewStaticResolver(l),
 				resolve2.NewIterativeResolver(l)),
-		}))
+		}),
+	})
 
-	udpLocalAddr, err := netip.ParseAddrPort(efc.LocalAddress)
+	endpoints := []endpoints2.Endpoint{endpoints2.NewUDPEndpoint(udpLocalAddr, resolver, udpOpts, l), endpoints2.NewTCPEndpoint(tcpLocalAddr, resolver, tcpOpts, l)}
+	return endpoints, []io.Closer{resolver}, nil
+}
+
+// parseOptionalDuration parses the duration option "name", zero
+// is returned for the omitted option, so the default is used.
+func parseOptionalDuration(name, s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(s)
 	if err != nil {
-		return nil, fmt.Errorf("failed to resolve local addr: %v", err)
+		return 0, fmt.Errorf("failed to parse %s: %v", name, err)
 	}
-	tcpLocalAddr := udpLocalAddr
 
-	endpoints := []endpoints2.Endpoint{endpoints2.NewUDPEndpoint(udpLocalAddr, resolver, l), endpoints2.NewTCPEndpoint(tcpLocalAddr, resolver, l)}
-	return endpoints, nil
+	return d, nil
 }
 
-func setup(l zerolog.Logger, endpointsFilePath string) ([]endpoints2.Endpoint, error) {
+func setup(l zerolog.Logger, endpointsFilePath string) ([]endpoints2.Endpoint, []io.Closer, error) {
 	var config endpointsFileConfigurationV0
 	if _, err := toml.DecodeFile(endpointsFilePath, &config); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	return config.InstantiateEndpoints(l)
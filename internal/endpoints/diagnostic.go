@@ -30,4 +30,49 @@ var (
 		Name: "dnska_server_packet_encode_error_total",
 		Help: "The total number of packet encode errors",
 	})
+
+	resolveErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dnska_server_resolve_errors_total",
+		Help: "The total number of resolve errors by the response code sent to a client",
+	}, []string{"rcode"})
+
+	notImplementedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dnska_server_not_implemented_total",
+		Help: "The total number of queries with unsupported opcode",
+	})
+
+	udpQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dnska_server_udp_queue_depth",
+		Help: "The number of received UDP queries waiting for a worker",
+	})
+
+	udpQueueDroppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dnska_server_udp_queue_dropped_total",
+		Help: "The total number of UDP queries dropped because the queue is full",
+	})
+
+	udpInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dnska_server_udp_in_flight",
+		Help: "The number of UDP queries being resolved by workers",
+	})
+
+	udpTruncatedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dnska_server_udp_truncated_total",
+		Help: "The total number of UDP responses truncated to the client's payload size",
+	})
+
+	tcpConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dnska_server_tcp_connections",
+		Help: "The number of open TCP connections",
+	})
+
+	tcpConnectionsRejectedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dnska_server_tcp_connections_rejected_total",
+		Help: "The total number of TCP connections closed because the limit of connections is reached",
+	})
+
+	tcpInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dnska_server_tcp_in_flight",
+		Help: "The number of TCP queries being resolved",
+	})
 )
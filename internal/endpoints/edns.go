@@ -0,0 +1,119 @@
+package endpoints
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/rokkerruslan/dnska/internal/limits"
+	"github.com/rokkerruslan/dnska/pkg/proto"
+)
+
+// negotiateEDNS sets OPT record of the response "out" to the query
+// "in". OPT record must not be included into a response unless the
+// query contained it. The values of upstream's OPT record are not
+// passed to the client except extended RCODE, because EDNS is a
+// hop-by-hop extension.
+func negotiateEDNS(in, out proto.Message) proto.Message {
+	if in.EDNS == nil {
+		out.EDNS = nil
+		return out
+	}
+
+	edns := proto.EDNS{
+		UDPPayloadSize: limits.EDNSUDPPayloadSize,
+		DNSSECOK:       in.EDNS.DNSSECOK,
+	}
+
+	if out.EDNS != nil {
+		edns.ExtendedRCode = out.EDNS.ExtendedRCode
+	}
+
+	out.EDNS = &edns
+
+	return out
+}
+
+// ednsBadVersion is the extended RCODE of the response to a query
+// with EDNS version which is not implemented (RFC 6891 section 9).
+const ednsBadVersion = 16
+
+// supportedEDNS reports whether the EDNS version of the query "in"
+// is implemented, only version 0 is.
+func supportedEDNS(in proto.Message) bool {
+	return in.EDNS == nil || in.EDNS.Version == 0
+}
+
+// badVersionResponse builds a response to query "in" with EDNS
+// version which is not implemented. The response is BADVERS, the
+// OPT record carries version 0, the highest one implemented
+// (RFC 6891 section 6.1.3).
+func badVersionResponse(in proto.Message) proto.Message {
+	out := rCodeResponse(in, proto.RCode(ednsBadVersion&0xf))
+
+	out.EDNS = &proto.EDNS{
+		ExtendedRCode: ednsBadVersion >> 4,
+	}
+
+	return out
+}
+
+// udpResponseSize returns the maximum size of UDP response to the
+// query "in", that is the smallest of client's and our payload sizes.
+func udpResponseSize(in proto.Message) int {
+	size := in.UDPPayloadSize()
+	if size > limits.EDNSUDPPayloadSize {
+		size = limits.EDNSUDPPayloadSize
+	}
+
+	return size
+}
+
+// validKeepalive reports whether edns-tcp-keepalive option of the
+// query "in" is valid, clients must not send the TIMEOUT field in
+// queries (RFC 7828 section 3.2.2).
+func validKeepalive(in proto.Message) bool {
+	if in.EDNS == nil {
+		return true
+	}
+
+	for _, option := range in.EDNS.Options {
+		if option.Code == proto.EDNSOptionCodeTCPKeepalive && len(option.Data) != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// advertiseKeepalive adds edns-tcp-keepalive option with the idle
+// timeout to the response "out" if the query "in" contained the
+// option (RFC 7828 section 3.3.2). The timeout is encoded in
+// units of 100 milliseconds.
+func advertiseKeepalive(in, out proto.Message, timeout time.Duration) proto.Message {
+	if in.EDNS == nil || out.EDNS == nil {
+		return out
+	}
+
+	for _, option := range in.EDNS.Options {
+		if option.Code != proto.EDNSOptionCodeTCPKeepalive {
+			continue
+		}
+
+		units := timeout / (100 * time.Millisecond)
+		if units > 0xffff {
+			units = 0xffff
+		}
+
+		data := make([]byte, 2)
+		binary.BigEndian.PutUint16(data, uint16(units))
+
+		out.EDNS.Options = append(out.EDNS.Options, proto.EDNSOption{
+			Code: proto.EDNSOptionCodeTCPKeepalive,
+			Data: data,
+		})
+
+		return out
+	}
+
+	return out
+}
@@ -0,0 +1,67 @@
+package endpoints
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rokkerruslan/dnska/pkg/proto"
+	testing2 "github.com/rokkerruslan/dnska/testing"
+)
+
+func TestBadVersionResponse(t *testing.T) {
+	in := proto.Message{
+		Header:   proto.Header{ID: 7, RecursionDesired: true},
+		Question: []proto.Question{{Name: "example.com", Type: proto.QTypeA, Class: proto.ClassIN}},
+		EDNS:     &proto.EDNS{UDPPayloadSize: 1232, Version: 1},
+	}
+
+	testing2.Assert(t, supportedEDNS(in), false)
+
+	out := negotiateEDNS(in, badVersionResponse(in))
+
+	enc := proto.AcquireEncoder(make([]byte, 512))
+	buf, err := enc.Encode(out)
+	proto.ReleaseEncoder(enc)
+	testing2.FailIfError(t, err)
+
+	dec := proto.AcquireDecoder()
+	got, err := dec.Decode(buf)
+	proto.ReleaseDecoder(dec)
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, got.Header.ID, uint16(7))
+	testing2.Assert(t, got.ExtendedRCode(), uint16(ednsBadVersion))
+	testing2.Assert(t, got.EDNS.Version, uint8(0))
+}
+
+func TestKeepalive(t *testing.T) {
+	keepalive := func(data []byte) proto.Message {
+		return proto.Message{
+			EDNS: &proto.EDNS{Options: []proto.EDNSOption{{Code: proto.EDNSOptionCodeTCPKeepalive, Data: data}}},
+		}
+	}
+
+	testing2.Assert(t, validKeepalive(proto.Message{}), true)
+	testing2.Assert(t, validKeepalive(keepalive(nil)), true)
+	testing2.Assert(t, validKeepalive(keepalive([]byte{0x00, 0x64})), false)
+
+	for _, tc := range []struct {
+		name    string
+		timeout time.Duration
+		want    []byte
+	}{
+		{"seconds", 10 * time.Second, []byte{0x00, 0x64}},
+		{"rounded down", 250 * time.Millisecond, []byte{0x00, 0x02}},
+		{"limited", 2 * time.Hour, []byte{0xff, 0xff}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := advertiseKeepalive(keepalive(nil), proto.Message{EDNS: &proto.EDNS{}}, tc.timeout)
+
+			testing2.Assert(t, out.EDNS.Options, []proto.EDNSOption{{Code: proto.EDNSOptionCodeTCPKeepalive, Data: tc.want}})
+		})
+	}
+
+	// The option is not sent to the clients which do not request it.
+	out := advertiseKeepalive(proto.Message{EDNS: &proto.EDNS{}}, proto.Message{EDNS: &proto.EDNS{}}, time.Second)
+	testing2.Assert(t, len(out.EDNS.Options), 0)
+}
@@ -1,8 +1,42 @@
 package endpoints
 
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultGracePeriod is the time that endpoints wait
+// for the in-flight queries on shutdown by default.
+const defaultGracePeriod = 5 * time.Second
+
 // Endpoint represents implementation of entrypoint into a DNS resolver.
 type Endpoint interface {
 	Name() string
-	Start(func())
-	Stop() error
+
+	// Start serves queries until the context is done. Then the
+	// endpoint stops accepting new queries immediately, answers the
+	// in-flight ones within the grace period and closes its sockets.
+	Start(ctx context.Context) error
+}
+
+// waitTimeout waits for the group "wg" no longer than "d", false
+// is returned if the group is not done in time.
+func waitTimeout(wg *sync.WaitGroup, d time.Duration) bool {
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
 }
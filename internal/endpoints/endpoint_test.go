@@ -0,0 +1,285 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/rokkerruslan/dnska/pkg/proto"
+	testing2 "github.com/rokkerruslan/dnska/testing"
+)
+
+// freeAddr returns the loopback address with a port that is free
+// for both UDP and TCP at the moment.
+func freeAddr(t *testing.T) netip.AddrPort {
+	t.Helper()
+
+	for i := 0; i < 10; i++ {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		testing2.FailIfError(t, err)
+
+		addr := pc.LocalAddr().(*net.UDPAddr).AddrPort()
+
+		l, err := net.ListenTCP("tcp", net.TCPAddrFromAddrPort(addr))
+		pc.Close()
+		if err != nil {
+			continue
+		}
+		l.Close()
+
+		return addr
+	}
+
+	t.Fatal("no free port")
+
+	return netip.AddrPort{}
+}
+
+// runningEndpoint is the endpoint started by startEndpoint,
+// "done" is closed when Start returns.
+type runningEndpoint struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// startEndpoint starts the endpoint, it's stopped
+// by the cleanup of the test.
+func startEndpoint(t *testing.T, ep Endpoint) *runningEndpoint {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := &runningEndpoint{cancel: cancel, done: make(chan struct{})}
+
+	go func() {
+		defer close(r.done)
+
+		r.err = ep.Start(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+
+		if !r.stopped(10 * time.Second) {
+			t.Error("endpoint is not stopped")
+			return
+		}
+
+		testing2.ThisIsFine(t, r.err)
+	})
+
+	return r
+}
+
+// stopped reports whether Start returns within "timeout".
+func (r *runningEndpoint) stopped(timeout time.Duration) bool {
+	select {
+	case <-r.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// answeringResolver answers A queries with a single record,
+// the lookup of a name takes the time from "delays".
+type answeringResolver struct {
+	delays map[string]time.Duration
+}
+
+func (r *answeringResolver) Resolve(ctx context.Context, in proto.Message) (proto.Message, error) {
+	if d, ok := r.delays[in.Question[0].Name]; ok {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return proto.Message{}, ctx.Err()
+		}
+	}
+
+	return answer(in), nil
+}
+
+// blockingResolver answers the queries when "release" is closed,
+// the lookups are reported into "started" and the errors of
+// the cancelled lookups into "cancelled".
+type blockingResolver struct {
+	started   chan string
+	release   chan struct{}
+	cancelled chan error
+}
+
+func newBlockingResolver() *blockingResolver {
+	return &blockingResolver{
+		started:   make(chan string, 16),
+		release:   make(chan struct{}),
+		cancelled: make(chan error, 16),
+	}
+}
+
+func (r *blockingResolver) Resolve(ctx context.Context, in proto.Message) (proto.Message, error) {
+	r.started <- in.Question[0].Name
+
+	select {
+	case <-r.release:
+		return answer(in), nil
+	case <-ctx.Done():
+		r.cancelled <- ctx.Err()
+		return proto.Message{}, ctx.Err()
+	}
+}
+
+// waitStarted waits for the lookup of the name.
+func (r *blockingResolver) waitStarted(t *testing.T, name string) {
+	t.Helper()
+
+	select {
+	case got := <-r.started:
+		testing2.Assert(t, got, name)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("lookup of %s is not started", name)
+	}
+}
+
+func answer(in proto.Message) proto.Message {
+	q := in.Question[0]
+
+	return proto.Message{
+		Header:   proto.Header{ID: in.Header.ID, Response: true, RecursionDesired: in.Header.RecursionDesired},
+		Question: in.Question,
+		Answer: []proto.ResourceRecord{{
+			Name:  q.Name,
+			Type:  proto.QTypeA,
+			Class: proto.ClassIN,
+			TTL:   300,
+			RData: &proto.A{Addr: netip.MustParseAddr("192.0.2.1")},
+		}},
+	}
+}
+
+func query(id uint16, name string) proto.Message {
+	return proto.Message{
+		Header:   proto.Header{ID: id, RecursionDesired: true},
+		Question: []proto.Question{{Name: name, Type: proto.QTypeA, Class: proto.ClassIN}},
+	}
+}
+
+func encode(t *testing.T, m proto.Message) []byte {
+	t.Helper()
+
+	buf, err := proto.NewEncoder(make([]byte, 512)).Encode(m)
+	testing2.FailIfError(t, err)
+
+	return buf
+}
+
+func decode(t *testing.T, buf []byte) proto.Message {
+	t.Helper()
+
+	m, err := proto.NewDecoder().Decode(buf)
+	testing2.FailIfError(t, err)
+
+	return m
+}
+
+// dialUDP connects to the endpoint, it waits for the endpoint to
+// start by the malformed packet which is answered without lookups.
+func dialUDP(t *testing.T, addr netip.AddrPort) *net.UDPConn {
+	t.Helper()
+
+	conn, err := net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(addr))
+	testing2.FailIfError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	for i := 0; i < 50; i++ {
+		// The writes and reads fail with "connection refused"
+		// until the socket is bound.
+		if _, err := conn.Write([]byte{0xff, 0xff, 0x00}); err == nil {
+			if _, ok := readUDP(t, conn, 100*time.Millisecond); ok {
+				return conn
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	t.Fatal("udp endpoint is not started")
+
+	return nil
+}
+
+// readUDP reads the response, false is returned
+// if no response is received in time.
+func readUDP(t *testing.T, conn *net.UDPConn, timeout time.Duration) (proto.Message, bool) {
+	t.Helper()
+
+	testing2.FailIfError(t, conn.SetReadDeadline(time.Now().Add(timeout)))
+
+	buf := make([]byte, 4096)
+
+	n, err := conn.Read(buf)
+	if err != nil {
+		return proto.Message{}, false
+	}
+
+	return decode(t, buf[:n]), true
+}
+
+// dialTCP connects to the endpoint, it waits for the endpoint to start.
+func dialTCP(t *testing.T, addr netip.AddrPort) *net.TCPConn {
+	t.Helper()
+
+	for i := 0; i < 50; i++ {
+		conn, err := net.DialTCP("tcp", nil, net.TCPAddrFromAddrPort(addr))
+		if err != nil {
+			time.Sleep(20 * time.Millisecond)
+			continue
+		}
+
+		t.Cleanup(func() { conn.Close() })
+
+		return conn
+	}
+
+	t.Fatal("tcp endpoint is not started")
+
+	return nil
+}
+
+func writeTCP(t *testing.T, conn *net.TCPConn, msgs ...proto.Message) {
+	t.Helper()
+
+	var buf []byte
+	for _, m := range msgs {
+		data := encode(t, m)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(data)))
+		buf = append(buf, data...)
+	}
+
+	_, err := conn.Write(buf)
+	testing2.FailIfError(t, err)
+}
+
+// readTCP reads the response, the error is returned
+// if the connection is closed or no response is received in time.
+func readTCP(t *testing.T, conn *net.TCPConn, timeout time.Duration) (proto.Message, error) {
+	t.Helper()
+
+	testing2.FailIfError(t, conn.SetReadDeadline(time.Now().Add(timeout)))
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return proto.Message{}, err
+	}
+
+	buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return proto.Message{}, err
+	}
+
+	return decode(t, buf), nil
+}
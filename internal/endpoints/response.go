@@ -0,0 +1,71 @@
+package endpoints
+
+import (
+	"encoding/binary"
+
+	"github.com/rokkerruslan/dnska/internal/resolve"
+	"github.com/rokkerruslan/dnska/pkg/proto"
+)
+
+// errorResponse builds a response to query "in" without records,
+// the response code is chosen by the resolve error "err".
+func errorResponse(in proto.Message, err error) proto.Message {
+	rCode := resolve.RCode(err)
+
+	resolveErrorsTotal.WithLabelValues(rCode.String()).Inc()
+
+	return rCodeResponse(in, rCode)
+}
+
+// notImplementedResponse builds a response to query "in" with an
+// opcode other than standard query, only queries are supported.
+func notImplementedResponse(in proto.Message) proto.Message {
+	notImplementedTotal.Inc()
+
+	return rCodeResponse(in, proto.RCodeNotImplemented)
+}
+
+// formatErrorResponse builds a response to the malformed packet "buf",
+// the ID and flags of the response are taken from the packet header
+// if they are present. The responses and packets without ID are not
+// answered (false is returned), so two servers cannot loop each other.
+func formatErrorResponse(buf []byte) (proto.Message, bool) {
+	if len(buf) < 2 {
+		return proto.Message{}, false
+	}
+
+	var in proto.Message
+
+	in.Header.ID = binary.BigEndian.Uint16(buf)
+
+	if len(buf) > 2 {
+		if buf[2]&0b10000000 != 0 {
+			return proto.Message{}, false
+		}
+
+		in.Header.Opcode = proto.Opcode((buf[2] & 0b01111000) >> 3)
+		in.Header.RecursionDesired = buf[2]&0b00000001 != 0
+	}
+
+	if len(buf) > 3 {
+		in.Header.CheckingDisabled = buf[3]&0b00010000 != 0
+	}
+
+	return rCodeResponse(in, proto.RCodeFormatError), true
+}
+
+// rCodeResponse builds a response to query "in" without records.
+func rCodeResponse(in proto.Message, rCode proto.RCode) proto.Message {
+	return proto.Message{
+		Header: proto.Header{
+			ID:                 in.Header.ID,
+			Response:           true,
+			Opcode:             in.Header.Opcode,
+			RecursionDesired:   in.Header.RecursionDesired,
+			RecursionAvailable: true,
+			CheckingDisabled:   in.Header.CheckingDisabled,
+			RCode:              rCode,
+		},
+		Question: in.Question,
+	}
+}
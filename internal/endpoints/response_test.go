@@ -0,0 +1,136 @@
+package endpoints
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rokkerruslan/dnska/pkg/proto"
+	testing2 "github.com/rokkerruslan/dnska/testing"
+)
+
+func TestFormatErrorResponse(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		buf  []byte
+		ok   bool
+		want proto.Header
+	}{
+		{
+			name: "id only",
+			buf:  []byte{0x12, 0x34},
+			ok:   true,
+			want: proto.Header{ID: 0x1234, Response: true, RecursionAvailable: true, RCode: proto.RCodeFormatError},
+		},
+		{
+			name: "truncated header",
+			buf:  []byte{0x12, 0x34, 0x01, 0x10, 0x00},
+			ok:   true,
+			want: proto.Header{
+				ID:                 0x1234,
+				Response:           true,
+				RecursionDesired:   true,
+				RecursionAvailable: true,
+				CheckingDisabled:   true,
+				RCode:              proto.RCodeFormatError,
+			},
+		},
+		{
+			name: "truncated question",
+			buf:  []byte{0xab, 0xcd, 0x10, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x07, 'e', 'x'},
+			ok:   true,
+			want: proto.Header{
+				ID:                 0xabcd,
+				Response:           true,
+				Opcode:             proto.OpcodeStatus,
+				RecursionAvailable: true,
+				RCode:              proto.RCodeFormatError,
+			},
+		},
+		{name: "empty", buf: nil, ok: false},
+		{name: "shorter than id", buf: []byte{0x12}, ok: false},
+		{name: "response", buf: []byte{0x12, 0x34, 0x80, 0x00, 0x00}, ok: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, ok := formatErrorResponse(tc.buf)
+
+			testing2.Assert(t, ok, tc.ok)
+			testing2.Assert(t, out.Header, tc.want)
+		})
+	}
+}
+
+func TestNotImplementedResponse(t *testing.T) {
+	in := query(7, "example.com")
+	in.Header.Opcode = proto.OpcodeStatus
+
+	out := notImplementedResponse(in)
+
+	testing2.Assert(t, out.Header.ID, uint16(7))
+	testing2.Assert(t, out.Header.Response, true)
+	testing2.Assert(t, out.Header.Opcode, proto.OpcodeStatus)
+	testing2.Assert(t, out.Header.RCode, proto.RCodeNotImplemented)
+	testing2.Assert(t, out.Question, in.Question)
+}
+
+func TestUDPEndpointResponseCodes(t *testing.T) {
+	addr := freeAddr(t)
+
+	// The only worker answers the packets in order, so the packet
+	// which is not answered is followed by the response to the next.
+	ep := NewUDPEndpoint(addr, &answeringResolver{}, UDPEndpointOpts{Workers: 1}, zerolog.Nop())
+	startEndpoint(t, ep)
+
+	conn := dialUDP(t, addr)
+
+	send := func(buf []byte) {
+		t.Helper()
+
+		_, err := conn.Write(buf)
+		testing2.FailIfError(t, err)
+	}
+
+	t.Run("malformed", func(t *testing.T) {
+		send([]byte{0x12, 0x34, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x07, 'e', 'x'})
+
+		out, ok := readUDP(t, conn, time.Second)
+
+		testing2.Assert(t, ok, true)
+		testing2.Assert(t, out.Header.ID, uint16(0x1234))
+		testing2.Assert(t, out.Header.RecursionDesired, true)
+		testing2.Assert(t, out.Header.RCode, proto.RCodeFormatError)
+	})
+
+	t.Run("not implemented", func(t *testing.T) {
+		in := query(2, "example.com")
+		in.Header.Opcode = proto.OpcodeStatus
+		send(encode(t, in))
+
+		out, ok := readUDP(t, conn, time.Second)
+
+		testing2.Assert(t, ok, true)
+		testing2.Assert(t, out.Header.ID, uint16(2))
+		testing2.Assert(t, out.Header.RCode, proto.RCodeNotImplemented)
+	})
+
+	for _, tc := range []struct {
+		name string
+		buf  []byte
+	}{
+		{"shorter than id", []byte{0x12}},
+		{"malformed response", []byte{0x12, 0x34, 0x80, 0x00, 0x00}},
+		{"response", encode(t, answer(query(3, "example.com")))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			send(tc.buf)
+			send(encode(t, query(4, "example.com")))
+
+			out, ok := readUDP(t, conn, time.Second)
+
+			testing2.Assert(t, ok, true)
+			testing2.Assert(t, out.Header.ID, uint16(4))
+			testing2.Assert(t, out.Header.RCode, proto.RCodeNoErrorCondition)
+		})
+	}
+}
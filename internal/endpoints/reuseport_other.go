@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package endpoints
+
+import (
+	"syscall"
+)
+
+// reusePort is nil on the platforms without SO_REUSEPORT.
+var reusePort func(network, address string, c syscall.RawConn) error
@@ -3,24 +3,77 @@ package endpoints
 import (
 	"context"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/netip"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
 
+	"github.com/rokkerruslan/dnska/internal/limits"
 	"github.com/rokkerruslan/dnska/internal/resolve"
 	"github.com/rokkerruslan/dnska/pkg/proto"
 )
 
-func NewTCPEndpoint(addr netip.AddrPort, resolver resolve.Resolver, l zerolog.Logger) *TCPEndpoint {
+const (
+	defaultTCPIdleTimeout    = 10 * time.Second
+	defaultTCPMaxConnections = 1024
+	defaultTCPMaxInFlight    = 32
+)
+
+// TCPEndpointOpts configures connections of TCP endpoint, zero
+// values are replaced with the defaults.
+type TCPEndpointOpts struct {
+	// IdleTimeout is the time a connection without queries
+	// is kept open, it's advertised to the clients with
+	// edns-tcp-keepalive option (RFC 7828).
+	IdleTimeout time.Duration
+
+	// MaxConnections is the number of connections served
+	// concurrently, the connections above the limit are closed.
+	MaxConnections int
+
+	// MaxInFlight is the number of queries of a connection resolved
+	// concurrently, the next queries are not read until some
+	// of the responses are sent.
+	MaxInFlight int
+
+	// GracePeriod is the time the in-flight queries are answered
+	// on shutdown, then the lookups are cancelled and connections
+	// are closed.
+	GracePeriod time.Duration
+}
+
+func NewTCPEndpoint(addr netip.AddrPort, resolver resolve.Resolver, opts TCPEndpointOpts, l zerolog.Logger) *TCPEndpoint {
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = defaultTCPIdleTimeout
+	}
+	if opts.MaxConnections <= 0 {
+		opts.MaxConnections = defaultTCPMaxConnections
+	}
+	if opts.MaxInFlight <= 0 {
+		opts.MaxInFlight = defaultTCPMaxInFlight
+	}
+	if opts.GracePeriod <= 0 {
+		opts.GracePeriod = defaultGracePeriod
+	}
+
 	return &TCPEndpoint{
 		addr:     addr,
 		resolver: resolver,
+		opts:     opts,
 		l:        l,
 
-		exit: make(chan struct{}),
+		conns: map[*net.TCPConn]struct{}{},
+		buffers: sync.Pool{
+			New: func() any {
+				buf := make([]byte, 2+limits.TCPMessageSizeLimit)
+				return &buf
+			},
+		},
 	}
 }
 
@@ -28,130 +81,279 @@ type TCPEndpoint struct {
 	addr      netip.AddrPort
 	resolver  resolve.Resolver
 	resolver2 resolve.ResolverV2
+	opts      TCPEndpointOpts
 	l         zerolog.Logger
 
-	exit   chan struct{}
-	onStop func()
+	// lookups is the parent context of lookups, it's cancelled
+	// when the grace period of shutdown expires.
+	lookups context.Context
+
+	// conns are the open connections, they are closed
+	// for reading when the endpoint is stopped.
+	mu    sync.Mutex
+	conns map[*net.TCPConn]struct{}
+
+	// buffers are used for encoding of responses.
+	buffers sync.Pool
 }
 
 func (t *TCPEndpoint) Name() string {
 	return "tcp"
 }
 
-func (t *TCPEndpoint) Start(onStop func()) {
-	t.onStop = onStop
-
+func (t *TCPEndpoint) Start(ctx context.Context) error {
 	listener, err := net.ListenTCP("tcp", net.TCPAddrFromAddrPort(t.addr))
 	if err != nil {
-		t.l.Printf("tcp :: failed to listen :: error=%v", err)
-		return
+		return fmt.Errorf("failed to listen: %w", err)
 	}
 
-	defer func() {
-		closeErr := listener.Close()
-		if closeErr != nil {
-			t.l.Printf("tcp :: failed to close connection :: error=%v", closeErr)
-		}
-	}()
+	var cancelLookups context.CancelFunc
+	t.lookups, cancelLookups = context.WithCancel(context.Background())
+	defer cancelLookups()
 
 	t.l.Printf("tcp :: starts on %v | %v", listener.Addr(), t.addr)
 
-	for {
-		select {
-		case <-t.exit:
-			return
-		default:
-			// nop
+	// The blocked accept is interrupted by closing
+	// of the listener, no connections are accepted.
+	go func() {
+		<-ctx.Done()
+
+		if closeErr := listener.Close(); closeErr != nil {
+			t.l.Printf("tcp :: failed to close listener :: error=%v", closeErr)
 		}
+	}()
+
+	var wg sync.WaitGroup
 
+	for {
 		conn, err := listener.AcceptTCP()
 		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+
 			t.l.Printf("tcp :: failed to establish connection :: error=%v", err)
 			continue
 		}
 
-		t.step(conn)
-		conn.Close()
+		if !t.trackConn(conn) {
+			tcpConnectionsRejectedTotal.Inc()
+			conn.Close()
+			continue
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer t.untrackConn(conn)
+
+			t.serve(conn)
+		}()
 	}
+
+	// The queries that are already read are answered, the next
+	// ones are not read.
+	t.closeConns((*net.TCPConn).CloseRead)
+
+	if !waitTimeout(&wg, t.opts.GracePeriod) {
+		t.l.Printf("tcp :: grace period is expired, in-flight lookups are cancelled")
+
+		// The cancelled lookups are answered with SERVFAIL, the
+		// connections that are still busy are closed.
+		cancelLookups()
+
+		if !waitTimeout(&wg, time.Second) {
+			t.closeConns((*net.TCPConn).Close)
+			wg.Wait()
+		}
+	}
+
+	t.l.Printf("tcp :: stopped")
+
+	return nil
 }
 
-func (t *TCPEndpoint) step(conn *net.TCPConn) {
-	if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
-		t.l.Printf("tcp :: failed to set deadline :: error=%v", err)
-		return
+// trackConn remembers the connection, false is returned
+// if the limit of connections is reached.
+func (t *TCPEndpoint) trackConn(conn *net.TCPConn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.conns) >= t.opts.MaxConnections {
+		return false
 	}
 
-	var length uint16
-	if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
-		packetReadErrorsTotal.Inc()
-		t.l.Printf("tcp :: failed to read length field :: error=%v", err)
-		return
+	t.conns[conn] = struct{}{}
+	tcpConnections.Inc()
+
+	return true
+}
+
+func (t *TCPEndpoint) untrackConn(conn *net.TCPConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.conns, conn)
+	tcpConnections.Dec()
+
+	// The connection is already closed if the grace period is expired.
+	if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		t.l.Printf("tcp :: failed to close connection :: error=%v", err)
 	}
+}
 
-	buf := make([]byte, length)
-	_, err := io.ReadFull(conn, buf)
-	if err != nil {
-		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+// closeConns closes the open connections with the function "closeFn".
+func (t *TCPEndpoint) closeConns(closeFn func(*net.TCPConn) error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for conn := range t.conns {
+		if err := closeFn(conn); err != nil {
+			t.l.Printf("tcp :: failed to close connection :: error=%v", err)
+		}
+	}
+}
+
+// serve reads the queries of the connection until the client closes
+// it or the connection is idle for too long. The queries are resolved
+// concurrently, so the responses are sent in the order of completion
+// (RFC 7766 section 7).
+func (t *TCPEndpoint) serve(conn *net.TCPConn) {
+	var (
+		wg       sync.WaitGroup
+		writeMu  sync.Mutex
+		inFlight = make(chan struct{}, t.opts.MaxInFlight)
+	)
+
+	defer wg.Wait()
+
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(t.opts.IdleTimeout)); err != nil {
+			t.l.Printf("tcp :: failed to set deadline :: error=%v", err)
 			return
 		}
 
-		packetReadErrorsTotal.Inc()
-		t.l.Printf("tcp :: failed to read data :: error=%v", err)
-		return
+		buf, err := readMessage(conn)
+		if err != nil {
+			var netErr net.Error
+			if errors.Is(err, io.EOF) || (errors.As(err, &netErr) && netErr.Timeout()) {
+				// The client is gone or idle, the connection
+				// is closed after the pending responses.
+				return
+			}
+
+			packetReadErrorsTotal.Inc()
+			t.l.Printf("tcp :: failed to read message :: error=%v", err)
+			return
+		}
+
+		inFlight <- struct{}{}
+		tcpInFlight.Inc()
+		wg.Add(1)
+
+		go func() {
+			defer func() {
+				tcpInFlight.Dec()
+				<-inFlight
+				wg.Done()
+			}()
+
+			t.step(conn, &writeMu, buf)
+		}()
 	}
+}
 
-	startTs := time.Now()
+// readMessage reads the length prefixed message from the connection.
+func readMessage(conn *net.TCPConn) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		return nil, err
+	}
+
+	return buf, nil
+}
 
-	dec := proto.NewDecoder()
+func (t *TCPEndpoint) step(conn *net.TCPConn, writeMu *sync.Mutex, buf []byte) {
+	startTs := time.Now()
 
+	dec := proto.AcquireDecoder()
 	inMsg, err := dec.Decode(buf)
-	if err != nil {
+	proto.ReleaseDecoder(dec)
+
+	var outMsg proto.Message
+
+	switch {
+	case err != nil:
 		packetDecodeErrorsTotal.Inc()
 		t.l.Printf("tcp :: failed to decode message :: error=%v", err)
-		return
-	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	outMsg, err := t.resolver.Resolve(ctx, inMsg)
-	if err != nil {
-		t.l.Printf("tcp :: failed to lookup :: error=%v", err)
+		var ok bool
+		if outMsg, ok = formatErrorResponse(buf); !ok {
+			return
+		}
+	case inMsg.Header.Response:
+		t.l.Printf("tcp :: unexpected response from %v", conn.RemoteAddr())
 		return
+	case inMsg.Header.Opcode != proto.OpcodeQuery:
+		outMsg = notImplementedResponse(inMsg)
+	case !supportedEDNS(inMsg):
+		outMsg = badVersionResponse(inMsg)
+	case !validKeepalive(inMsg):
+		outMsg = rCodeResponse(inMsg, proto.RCodeFormatError)
+	default:
+		ctx, cancel := context.WithTimeout(t.lookups, 5*time.Second)
+		defer cancel()
+
+		outMsg, err = t.resolver.Resolve(ctx, inMsg)
+		if err != nil {
+			t.l.Printf("tcp :: failed to lookup :: error=%v", err)
+			outMsg = errorResponse(inMsg, err)
+		}
 	}
 
-	enc := proto.NewEncoder(make([]byte, 512))
+	outMsg = negotiateEDNS(inMsg, outMsg)
+	outMsg = advertiseKeepalive(inMsg, outMsg, t.opts.IdleTimeout)
+
+	outBuf := t.buffers.Get().(*[]byte)
+	defer t.buffers.Put(outBuf)
 
+	// The message is encoded right after the length prefix.
+	enc := proto.AcquireEncoder((*outBuf)[2:])
 	dataBuf, err := enc.Encode(outMsg)
+	proto.ReleaseEncoder(enc)
 	if err != nil {
 		packetEncodeErrorsTotal.Inc()
 		t.l.Printf("tcp :: failed to encode message :: error=%v", err)
 		return
 	}
 
-	outBuf := make([]byte, 2+len(dataBuf))
-	binary.BigEndian.PutUint16(outBuf, uint16(len(dataBuf)))
-	copy(outBuf[2:], dataBuf)
+	binary.BigEndian.PutUint16(*outBuf, uint16(len(dataBuf)))
+
+	// The responses of concurrent queries must not interleave.
+	writeMu.Lock()
+	defer writeMu.Unlock()
 
 	if err := conn.SetWriteDeadline(time.Now().Add(time.Second)); err != nil {
 		t.l.Printf("tcp :: failed to set write deadline :: error=%v", err)
 		return
 	}
-	if _, err := conn.Write(outBuf); err != nil {
+	if _, err := conn.Write((*outBuf)[:2+len(dataBuf)]); err != nil {
 		t.l.Printf("tcp :: failed to write :: error=%v", err)
 		packetWriteErrorsTotal.Inc()
 		return
 	}
 
-	t.l.Printf("trace :: tcp :: total time is %v :: q=%s", time.Since(startTs), inMsg.Question[0].Name)
+	t.l.Printf("trace :: tcp :: total time is %v :: q=%v", time.Since(startTs), inMsg.Question)
 
 	successesProcessedOpsTotal.Inc()
 }
-
-func (t *TCPEndpoint) Stop() error {
-	t.onStop()
-
-	close(t.exit)
-
-	return nil
-}
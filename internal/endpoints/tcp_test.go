@@ -0,0 +1,242 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rokkerruslan/dnska/pkg/proto"
+	testing2 "github.com/rokkerruslan/dnska/testing"
+)
+
+func TestTCPEndpointPipelining(t *testing.T) {
+	resolver := &answeringResolver{delays: map[string]time.Duration{
+		"a.example": 300 * time.Millisecond,
+		"b.example": 200 * time.Millisecond,
+		"c.example": 100 * time.Millisecond,
+	}}
+
+	names := map[uint16]string{1: "a.example", 2: "b.example", 3: "c.example", 4: "d.example"}
+
+	for _, tc := range []struct {
+		name        string
+		maxInFlight int
+		want        []uint16
+	}{
+		// The responses are sent in the order of completion.
+		{"concurrent", 0, []uint16{4, 3, 2, 1}},
+		// The next query is not read until the response is sent.
+		{"sequential", 1, []uint16{1, 2, 3, 4}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			addr := freeAddr(t)
+
+			ep := NewTCPEndpoint(addr, resolver, TCPEndpointOpts{MaxInFlight: tc.maxInFlight}, zerolog.Nop())
+			startEndpoint(t, ep)
+
+			conn := dialTCP(t, addr)
+
+			writeTCP(t, conn, query(1, names[1]), query(2, names[2]), query(3, names[3]), query(4, names[4]))
+
+			var got []uint16
+			for range names {
+				// Every response is decoded, so the responses
+				// are not interleaved.
+				out, err := readTCP(t, conn, 5*time.Second)
+				testing2.FailIfError(t, err)
+
+				testing2.Assert(t, out.Question[0].Name, names[out.Header.ID])
+				testing2.Assert(t, out.Answer[0].Name, names[out.Header.ID])
+
+				got = append(got, out.Header.ID)
+			}
+
+			testing2.Assert(t, got, tc.want)
+		})
+	}
+}
+
+func TestTCPEndpointKeepalive(t *testing.T) {
+	addr := freeAddr(t)
+
+	ep := NewTCPEndpoint(addr, &answeringResolver{}, TCPEndpointOpts{IdleTimeout: 2500 * time.Millisecond}, zerolog.Nop())
+	startEndpoint(t, ep)
+
+	conn := dialTCP(t, addr)
+
+	keepaliveQuery := func(id uint16, data []byte) proto.Message {
+		in := query(id, "example.com")
+		in.EDNS = &proto.EDNS{
+			UDPPayloadSize: 1232,
+			Options:        []proto.EDNSOption{{Code: proto.EDNSOptionCodeTCPKeepalive, Data: data}},
+		}
+
+		return in
+	}
+
+	t.Run("advertised", func(t *testing.T) {
+		writeTCP(t, conn, keepaliveQuery(1, nil))
+
+		out, err := readTCP(t, conn, time.Second)
+		testing2.FailIfError(t, err)
+
+		testing2.Assert(t, out.Header.RCode, proto.RCodeNoErrorCondition)
+
+		// The timeout is in units of 100 milliseconds.
+		testing2.Assert(t, out.EDNS.Options, []proto.EDNSOption{
+			{Code: proto.EDNSOptionCodeTCPKeepalive, Data: []byte{0x00, 0x19}},
+		})
+	})
+
+	t.Run("timeout sent by client", func(t *testing.T) {
+		writeTCP(t, conn, keepaliveQuery(2, []byte{0x00, 0x64}))
+
+		out, err := readTCP(t, conn, time.Second)
+		testing2.FailIfError(t, err)
+
+		testing2.Assert(t, out.Header.ID, uint16(2))
+		testing2.Assert(t, out.Header.RCode, proto.RCodeFormatError)
+	})
+
+	t.Run("not requested", func(t *testing.T) {
+		writeTCP(t, conn, query(3, "example.com"))
+
+		out, err := readTCP(t, conn, time.Second)
+		testing2.FailIfError(t, err)
+
+		testing2.Assert(t, out.EDNS == nil, true)
+	})
+}
+
+func TestTCPEndpointIdleTimeout(t *testing.T) {
+	addr := freeAddr(t)
+
+	ep := NewTCPEndpoint(addr, &answeringResolver{}, TCPEndpointOpts{IdleTimeout: 200 * time.Millisecond}, zerolog.Nop())
+	startEndpoint(t, ep)
+
+	conn := dialTCP(t, addr)
+
+	writeTCP(t, conn, query(1, "example.com"))
+
+	_, err := readTCP(t, conn, time.Second)
+	testing2.FailIfError(t, err)
+
+	// The idle connection is closed by the server.
+	_, err = readTCP(t, conn, 2*time.Second)
+	testing2.Assert(t, errors.Is(err, io.EOF), true)
+}
+
+func TestTCPEndpointMaxConnections(t *testing.T) {
+	addr := freeAddr(t)
+
+	ep := NewTCPEndpoint(addr, &answeringResolver{}, TCPEndpointOpts{MaxConnections: 1}, zerolog.Nop())
+	startEndpoint(t, ep)
+
+	first := dialTCP(t, addr)
+
+	writeTCP(t, first, query(1, "example.com"))
+
+	_, err := readTCP(t, first, time.Second)
+	testing2.FailIfError(t, err)
+
+	// The connection above the limit is closed at once.
+	second := dialTCP(t, addr)
+
+	_, err = readTCP(t, second, time.Second)
+	testing2.Assert(t, errors.Is(err, io.EOF), true)
+
+	// The first connection is still served.
+	writeTCP(t, first, query(2, "example.com"))
+
+	out, err := readTCP(t, first, time.Second)
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, out.Header.ID, uint16(2))
+}
+
+func TestTCPEndpointDrain(t *testing.T) {
+	addr := freeAddr(t)
+	resolver := newBlockingResolver()
+
+	ep := NewTCPEndpoint(addr, resolver, TCPEndpointOpts{GracePeriod: 5 * time.Second}, zerolog.Nop())
+	running := startEndpoint(t, ep)
+
+	conn := dialTCP(t, addr)
+
+	writeTCP(t, conn, query(1, "in-flight.example"))
+	resolver.waitStarted(t, "in-flight.example")
+
+	running.cancel()
+
+	// The connections are not accepted after the context is done.
+	refused := false
+	for i := 0; i < 50; i++ {
+		late, err := net.DialTCP("tcp", nil, net.TCPAddrFromAddrPort(addr))
+		if err != nil {
+			refused = true
+			break
+		}
+
+		late.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	testing2.Assert(t, refused, true)
+	testing2.Assert(t, running.stopped(100*time.Millisecond), false)
+
+	close(resolver.release)
+
+	// The in-flight query is answered, then the connection is closed.
+	out, err := readTCP(t, conn, time.Second)
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, out.Header.ID, uint16(1))
+	testing2.Assert(t, out.Header.RCode, proto.RCodeNoErrorCondition)
+
+	_, err = readTCP(t, conn, time.Second)
+	testing2.Assert(t, errors.Is(err, io.EOF), true)
+
+	testing2.Assert(t, running.stopped(time.Second), true)
+}
+
+func TestTCPEndpointGracePeriod(t *testing.T) {
+	addr := freeAddr(t)
+	resolver := newBlockingResolver()
+
+	ep := NewTCPEndpoint(addr, resolver, TCPEndpointOpts{GracePeriod: 200 * time.Millisecond}, zerolog.Nop())
+	running := startEndpoint(t, ep)
+
+	conn := dialTCP(t, addr)
+
+	writeTCP(t, conn, query(1, "in-flight.example"))
+	resolver.waitStarted(t, "in-flight.example")
+
+	startTs := time.Now()
+	running.cancel()
+
+	testing2.Assert(t, running.stopped(5*time.Second), true)
+
+	if elapsed := time.Since(startTs); elapsed < 200*time.Millisecond {
+		t.Errorf("endpoint is stopped before the grace period expires: %v", elapsed)
+	}
+
+	// The lookup is cancelled when the grace period expires,
+	// the query is answered with the server failure.
+	select {
+	case err := <-resolver.cancelled:
+		testing2.Assert(t, errors.Is(err, context.Canceled), true)
+	default:
+		t.Error("lookup is not cancelled")
+	}
+
+	out, err := readTCP(t, conn, time.Second)
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, out.Header.ID, uint16(1))
+	testing2.Assert(t, out.Header.RCode, proto.RCodeServerFailure)
+}
@@ -2,23 +2,72 @@ package endpoints
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
 	"net/netip"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
 
+	"github.com/rokkerruslan/dnska/internal/limits"
 	"github.com/rokkerruslan/dnska/internal/resolve"
 	"github.com/rokkerruslan/dnska/pkg/proto"
 )
 
-func NewUDPEndpoint(addr netip.AddrPort, resolver resolve.Resolver, l zerolog.Logger) *UDPEndpoint {
+const (
+	defaultUDPWorkers   = 128
+	defaultUDPQueueSize = 1024
+)
+
+// UDPEndpointOpts configures concurrency of UDP endpoint, zero
+// values are replaced with the defaults.
+type UDPEndpointOpts struct {
+	// Workers is the number of queries resolved concurrently.
+	Workers int
+
+	// QueueSize is the number of received queries waiting for
+	// a free worker, the queries above the limit are dropped.
+	QueueSize int
+
+	// Sockets is the number of sockets bound to the same address
+	// with SO_REUSEPORT, the kernel spreads the load between them.
+	// One socket without SO_REUSEPORT is used by default.
+	Sockets int
+
+	// GracePeriod is the time the queued and in-flight queries are
+	// answered on shutdown, then the lookups are cancelled.
+	GracePeriod time.Duration
+}
+
+func NewUDPEndpoint(addr netip.AddrPort, resolver resolve.Resolver, opts UDPEndpointOpts, l zerolog.Logger) *UDPEndpoint {
+	if opts.Workers <= 0 {
+		opts.Workers = defaultUDPWorkers
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultUDPQueueSize
+	}
+	if opts.Sockets <= 0 {
+		opts.Sockets = 1
+	}
+	if opts.GracePeriod <= 0 {
+		opts.GracePeriod = defaultGracePeriod
+	}
+
 	return &UDPEndpoint{
 		addr:     addr,
 		resolver: resolver,
+		opts:     opts,
 		l:        l,
 
-		exit: make(chan struct{}),
+		queue: make(chan udpRequest, opts.QueueSize),
+		buffers: sync.Pool{
+			New: func() any {
+				buf := make([]byte, limits.EDNSUDPPayloadSize)
+				return &buf
+			},
+		},
 	}
 }
 
@@ -26,110 +75,242 @@ type UDPEndpoint struct {
 	addr      netip.AddrPort
 	resolver  resolve.Resolver
 	resolver2 resolve.ResolverV2
+	opts      UDPEndpointOpts
 	l         zerolog.Logger
 
-	exit   chan struct{}
-	onStop func()
+	// lookups is the parent context of lookups, it's cancelled
+	// when the grace period of shutdown expires.
+	lookups context.Context
+
+	// Readers of sockets put the received packets into the queue,
+	// workers take them out. The buffers of packets are returned
+	// into the pool when the query is answered.
+	queue   chan udpRequest
+	buffers sync.Pool
+}
+
+// udpRequest is the packet received from the address "from",
+// the response is written into the same socket.
+type udpRequest struct {
+	conn *net.UDPConn
+	from netip.AddrPort
+	buf  *[]byte
+	n    int
 }
 
 func (ep *UDPEndpoint) Name() string {
 	return "udp"
 }
 
-func (ep *UDPEndpoint) Start(onStop func()) {
-	ep.onStop = onStop
-
-	conn, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(ep.addr))
+func (ep *UDPEndpoint) Start(ctx context.Context) error {
+	conns, err := ep.listen()
 	if err != nil {
-		ep.l.Printf("failed to listen :: error=%v", err)
+		return fmt.Errorf("failed to listen: %w", err)
 	}
 
-	defer func() {
-		closeErr := conn.Close()
-		if closeErr != nil {
+	var cancelLookups context.CancelFunc
+	ep.lookups, cancelLookups = context.WithCancel(context.Background())
+	defer cancelLookups()
+
+	var workers sync.WaitGroup
+	workers.Add(ep.opts.Workers)
+
+	for i := 0; i < ep.opts.Workers; i++ {
+		go func() {
+			defer workers.Done()
+
+			ep.work()
+		}()
+	}
+
+	var readers sync.WaitGroup
+	readers.Add(len(conns))
+
+	for _, conn := range conns {
+		conn := conn
+
+		ep.l.Printf("starts on %v | %v", conn.LocalAddr(), ep.addr)
+
+		go func() {
+			defer readers.Done()
+
+			ep.read(ctx, conn)
+		}()
+	}
+
+	<-ctx.Done()
+
+	// The blocked reads are interrupted, so no packets
+	// are received from now on.
+	for _, conn := range conns {
+		if err := conn.SetReadDeadline(time.Now()); err != nil {
+			ep.l.Printf("failed to set deadline :: error=%v", err)
+		}
+	}
+
+	readers.Wait()
+
+	// No packets are put into the queue, workers answer
+	// the queued ones and exit.
+	close(ep.queue)
+
+	if !waitTimeout(&workers, ep.opts.GracePeriod) {
+		ep.l.Printf("grace period is expired, in-flight lookups are cancelled")
+
+		cancelLookups()
+		workers.Wait()
+	}
+
+	for _, conn := range conns {
+		if closeErr := conn.Close(); closeErr != nil {
 			ep.l.Printf("failed to close connection :: error=%v", closeErr)
 		}
-	}()
+	}
+
+	ep.l.Printf("stopped")
 
-	ep.l.Printf("starts on %v | %v", conn.LocalAddr(), ep.addr)
+	return nil
+}
 
+// listen opens the sockets of the endpoint, SO_REUSEPORT is
+// set only if more than one socket is requested.
+func (ep *UDPEndpoint) listen() ([]*net.UDPConn, error) {
+	var lc net.ListenConfig
+	if ep.opts.Sockets > 1 {
+		if reusePort == nil {
+			return nil, errors.New("SO_REUSEPORT is not supported on the platform")
+		}
+
+		lc.Control = reusePort
+	}
+
+	conns := make([]*net.UDPConn, 0, ep.opts.Sockets)
+
+	for i := 0; i < ep.opts.Sockets; i++ {
+		pc, err := lc.ListenPacket(context.Background(), "udp", ep.addr.String())
+		if err != nil {
+			for _, conn := range conns {
+				conn.Close()
+			}
+
+			return nil, fmt.Errorf("socket %d: %w", i, err)
+		}
+
+		conns = append(conns, pc.(*net.UDPConn))
+	}
+
+	return conns, nil
+}
+
+// read receives packets from the socket "conn" and puts them
+// into the queue until the context is done.
+func (ep *UDPEndpoint) read(ctx context.Context, conn *net.UDPConn) {
 	for {
+		buf := ep.buffers.Get().(*[]byte)
+
+		n, from, err := conn.ReadFromUDPAddrPort(*buf)
+		if err != nil {
+			ep.buffers.Put(buf)
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			packetReadErrorsTotal.Inc()
+			ep.l.Printf("failed to read from udp :: error=%v", err)
+			continue
+		}
+
 		select {
-		case <-ep.exit:
-			return
+		case ep.queue <- udpRequest{conn: conn, from: from, buf: buf, n: n}:
+			udpQueueDepth.Inc()
 		default:
-			// nop
-		}
+			ep.buffers.Put(buf)
 
-		ep.step(conn)
+			udpQueueDroppedTotal.Inc()
+		}
 	}
 }
 
-func (ep *UDPEndpoint) step(conn *net.UDPConn) {
-	buf := make([]byte, 512)
+// work answers the queued packets until the queue is closed.
+func (ep *UDPEndpoint) work() {
+	out := make([]byte, limits.EDNSUDPPayloadSize)
 
-	if err := conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond)); err != nil {
-		ep.l.Printf("failed to set deadline :: error=%v", err)
-		return
-	}
-	_, remoteAddr, err := conn.ReadFromUDP(buf)
-	if err != nil {
-		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-			return
-		}
+	for req := range ep.queue {
+		udpQueueDepth.Dec()
+		udpInFlight.Inc()
 
-		packetReadErrorsTotal.Inc()
-		ep.l.Printf("failed to read from udp :: error=%v", err)
-		return
+		ep.step(req, out)
+
+		udpInFlight.Dec()
+		ep.buffers.Put(req.buf)
 	}
+}
 
+func (ep *UDPEndpoint) step(req udpRequest, out []byte) {
 	startTs := time.Now()
 
-	dec := proto.NewDecoder()
+	buf := (*req.buf)[:req.n]
 
+	dec := proto.AcquireDecoder()
 	inMsg, err := dec.Decode(buf)
-	if err != nil {
+	proto.ReleaseDecoder(dec)
+
+	var outMsg proto.Message
+
+	switch {
+	case err != nil:
 		packetDecodeErrorsTotal.Inc()
 		ep.l.Printf("failed to decode message :: error=%v", err)
-		return
-	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	outMsg, err := ep.resolver.Resolve(ctx, inMsg)
-	if err != nil {
-		ep.l.Printf("failed to lookup :: error=%v", err)
+		var ok bool
+		if outMsg, ok = formatErrorResponse(buf); !ok {
+			return
+		}
+	case inMsg.Header.Response:
+		ep.l.Printf("unexpected response from %v", req.from)
 		return
+	case inMsg.Header.Opcode != proto.OpcodeQuery:
+		outMsg = notImplementedResponse(inMsg)
+	case !supportedEDNS(inMsg):
+		outMsg = badVersionResponse(inMsg)
+	default:
+		ctx, cancel := context.WithTimeout(ep.lookups, 5*time.Second)
+		defer cancel()
+
+		outMsg, err = ep.resolver.Resolve(ctx, inMsg)
+		if err != nil {
+			ep.l.Printf("failed to lookup :: error=%v", err)
+			outMsg = errorResponse(inMsg, err)
+		}
 	}
 
-	enc := proto.NewEncoder(buf)
+	outMsg = negotiateEDNS(inMsg, outMsg)
 
-	buf, err = enc.Encode(outMsg)
+	// The response which does not fit into the client's payload
+	// size is truncated, the client retries the query over TCP.
+	enc := proto.AcquireEncoder(out[:udpResponseSize(inMsg)])
+	buf, err = enc.EncodeTruncated(outMsg)
+	proto.ReleaseEncoder(enc)
 	if err != nil {
 		packetEncodeErrorsTotal.Inc()
 		ep.l.Printf("failed to encode message :: error=%v", err)
 		return
 	}
 
-	if err := conn.SetWriteDeadline(time.Now().Add(time.Second)); err != nil {
-		ep.l.Printf("failed to set write deadline :: error=%v", err)
+	if buf[2]&0b00000010 != 0 {
+		udpTruncatedTotal.Inc()
 	}
-	if _, err := conn.WriteToUDP(buf, remoteAddr); err != nil {
+
+	// The socket is shared by workers, so the write deadline is
+	// not set, writes of UDP sockets do not block for long.
+	if _, err := req.conn.WriteToUDPAddrPort(buf, req.from); err != nil {
 		ep.l.Printf("failed to write to udp :: error=%v", err)
 		packetWriteErrorsTotal.Inc()
 		return
 	}
 
-	ep.l.Printf("trace :: total time is %v :: q=%ep", time.Since(startTs), inMsg.Question[0].Name)
+	ep.l.Printf("trace :: total time is %v :: q=%v", time.Since(startTs), inMsg.Question)
 
 	successesProcessedOpsTotal.Inc()
 }
-
-func (ep *UDPEndpoint) Stop() error {
-	ep.onStop()
-
-	close(ep.exit)
-
-	return nil
-}
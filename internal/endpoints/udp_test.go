@@ -0,0 +1,245 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+
+	"github.com/rokkerruslan/dnska/pkg/proto"
+	testing2 "github.com/rokkerruslan/dnska/testing"
+)
+
+func TestUDPEndpointSlowLookup(t *testing.T) {
+	addr := freeAddr(t)
+	resolver := &answeringResolver{delays: map[string]time.Duration{
+		"slow.example": time.Second,
+	}}
+
+	ep := NewUDPEndpoint(addr, resolver, UDPEndpointOpts{}, zerolog.Nop())
+	startEndpoint(t, ep)
+
+	slow := dialUDP(t, addr)
+	fast := dialUDP(t, addr)
+
+	_, err := slow.Write(encode(t, query(1, "slow.example")))
+	testing2.FailIfError(t, err)
+
+	startTs := time.Now()
+
+	_, err = fast.Write(encode(t, query(2, "fast.example")))
+	testing2.FailIfError(t, err)
+
+	// The other client is answered while the slow lookup is in flight.
+	out, ok := readUDP(t, fast, 500*time.Millisecond)
+
+	testing2.Assert(t, ok, true)
+	testing2.Assert(t, out.Header.ID, uint16(2))
+
+	if elapsed := time.Since(startTs); elapsed >= time.Second {
+		t.Errorf("query is blocked by the slow lookup: %v", elapsed)
+	}
+
+	out, ok = readUDP(t, slow, 2*time.Second)
+
+	testing2.Assert(t, ok, true)
+	testing2.Assert(t, out.Header.ID, uint16(1))
+}
+
+func TestUDPEndpointQueueFull(t *testing.T) {
+	addr := freeAddr(t)
+	resolver := newBlockingResolver()
+
+	ep := NewUDPEndpoint(addr, resolver, UDPEndpointOpts{Workers: 1, QueueSize: 1}, zerolog.Nop())
+	startEndpoint(t, ep)
+
+	conn := dialUDP(t, addr)
+
+	send := func(in proto.Message) {
+		t.Helper()
+
+		_, err := conn.Write(encode(t, in))
+		testing2.FailIfError(t, err)
+	}
+
+	dropped := testutil.ToFloat64(udpQueueDroppedTotal)
+
+	// The worker is busy with the first query, the second one
+	// takes the only place in the queue, the rest are dropped.
+	send(query(1, "in-flight.example"))
+	resolver.waitStarted(t, "in-flight.example")
+
+	send(query(2, "queued.example"))
+	time.Sleep(50 * time.Millisecond)
+
+	send(query(3, "dropped.example"))
+	send(query(4, "dropped.example"))
+
+	for i := 0; i < 50 && testutil.ToFloat64(udpQueueDroppedTotal)-dropped < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	testing2.Assert(t, testutil.ToFloat64(udpQueueDroppedTotal)-dropped, float64(2))
+
+	close(resolver.release)
+
+	for _, id := range []uint16{1, 2} {
+		out, ok := readUDP(t, conn, time.Second)
+
+		testing2.Assert(t, ok, true)
+		testing2.Assert(t, out.Header.ID, id)
+	}
+
+	_, ok := readUDP(t, conn, 100*time.Millisecond)
+	testing2.Assert(t, ok, false)
+
+	resolver.waitStarted(t, "queued.example")
+	testing2.Assert(t, len(resolver.started), 0)
+}
+
+func TestUDPEndpointSockets(t *testing.T) {
+	if reusePort == nil {
+		t.Skip("SO_REUSEPORT is not supported on the platform")
+	}
+
+	addr := freeAddr(t)
+
+	ep := NewUDPEndpoint(addr, &answeringResolver{}, UDPEndpointOpts{Sockets: 4}, zerolog.Nop())
+	startEndpoint(t, ep)
+
+	// The kernel spreads the clients between the sockets by
+	// the address of the client, with so many clients every
+	// socket serves some of them.
+	for i := 0; i < 64; i++ {
+		conn := dialUDP(t, addr)
+
+		_, err := conn.Write(encode(t, query(uint16(i), "example.com")))
+		testing2.FailIfError(t, err)
+
+		out, ok := readUDP(t, conn, time.Second)
+
+		testing2.Assert(t, ok, true)
+		testing2.Assert(t, out.Header.ID, uint16(i))
+	}
+
+	// The bound sockets are listed by the kernel on Linux only.
+	table, err := os.ReadFile("/proc/net/udp")
+	if err != nil {
+		return
+	}
+
+	sockets := 0
+	for _, line := range strings.Split(string(table), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 1 && strings.HasSuffix(fields[1], fmt.Sprintf(":%04X", addr.Port())) {
+			sockets++
+		}
+	}
+
+	testing2.Assert(t, sockets, 4)
+
+	// The address is taken, the socket without
+	// SO_REUSEPORT can not be bound to it.
+	pc, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(addr))
+	if err == nil {
+		pc.Close()
+	}
+
+	testing2.Assert(t, err != nil, true)
+}
+
+func TestUDPEndpointDrain(t *testing.T) {
+	addr := freeAddr(t)
+	resolver := newBlockingResolver()
+
+	ep := NewUDPEndpoint(addr, resolver, UDPEndpointOpts{Workers: 1, GracePeriod: 5 * time.Second}, zerolog.Nop())
+	running := startEndpoint(t, ep)
+
+	conn := dialUDP(t, addr)
+
+	send := func(in proto.Message) {
+		t.Helper()
+
+		_, err := conn.Write(encode(t, in))
+		testing2.FailIfError(t, err)
+	}
+
+	// The first query is in flight, the second one is queued.
+	send(query(1, "in-flight.example"))
+	resolver.waitStarted(t, "in-flight.example")
+
+	send(query(2, "queued.example"))
+	time.Sleep(50 * time.Millisecond)
+
+	running.cancel()
+
+	// The packets are not read after the context is done.
+	time.Sleep(50 * time.Millisecond)
+	send(query(3, "late.example"))
+
+	testing2.Assert(t, running.stopped(100*time.Millisecond), false)
+
+	close(resolver.release)
+
+	for _, id := range []uint16{1, 2} {
+		out, ok := readUDP(t, conn, time.Second)
+
+		testing2.Assert(t, ok, true)
+		testing2.Assert(t, out.Header.ID, id)
+		testing2.Assert(t, out.Header.RCode, proto.RCodeNoErrorCondition)
+	}
+
+	testing2.Assert(t, running.stopped(time.Second), true)
+
+	_, ok := readUDP(t, conn, 100*time.Millisecond)
+	testing2.Assert(t, ok, false)
+
+	resolver.waitStarted(t, "queued.example")
+	testing2.Assert(t, len(resolver.started), 0)
+}
+
+func TestUDPEndpointGracePeriod(t *testing.T) {
+	addr := freeAddr(t)
+	resolver := newBlockingResolver()
+
+	ep := NewUDPEndpoint(addr, resolver, UDPEndpointOpts{GracePeriod: 200 * time.Millisecond}, zerolog.Nop())
+	running := startEndpoint(t, ep)
+
+	conn := dialUDP(t, addr)
+
+	_, err := conn.Write(encode(t, query(1, "in-flight.example")))
+	testing2.FailIfError(t, err)
+
+	resolver.waitStarted(t, "in-flight.example")
+
+	startTs := time.Now()
+	running.cancel()
+
+	testing2.Assert(t, running.stopped(5*time.Second), true)
+
+	if elapsed := time.Since(startTs); elapsed < 200*time.Millisecond {
+		t.Errorf("endpoint is stopped before the grace period expires: %v", elapsed)
+	}
+
+	// The lookup is cancelled when the grace period expires,
+	// the query is answered with the server failure.
+	select {
+	case err := <-resolver.cancelled:
+		testing2.Assert(t, errors.Is(err, context.Canceled), true)
+	default:
+		t.Error("lookup is not cancelled")
+	}
+
+	out, ok := readUDP(t, conn, time.Second)
+
+	testing2.Assert(t, ok, true)
+	testing2.Assert(t, out.Header.ID, uint16(1))
+	testing2.Assert(t, out.Header.RCode, proto.RCodeServerFailure)
+}
@@ -14,4 +14,14 @@ const (
 	UDPPayloadSizeLimit = 512
 	MaxLabelSize        = 63
 	MaxNameSize         = 255
+
+	// EDNSUDPPayloadSize is the UDP payload size that is advertised in
+	// the OPT record (RFC 6891) for both, queries to upstream servers
+	// and responses to clients. The value avoids IP fragmentation on
+	// the most of networks (DNS Flag Day 2020).
+	EDNSUDPPayloadSize = 1232
+
+	// TCPMessageSizeLimit is the largest message over TCP, the
+	// message is prefixed with the two octet length field.
+	TCPMessageSizeLimit = 65535
 )
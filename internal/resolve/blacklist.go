@@ -2,7 +2,9 @@ package resolve
 
 import (
 	"context"
+	"fmt"
 	"math"
+	"net/netip"
 	"time"
 
 	"github.com/rokkerruslan/dnska/pkg/proto"
@@ -28,28 +30,50 @@ var answerFuckOff = proto.ResourceRecord{
 	Type:     proto.QTypeA,
 	Class:    proto.ClassIN,
 	TTL:      math.MaxUint32,
-	RDLength: 9,
-	RData:    "127.0.0.1",
+	RDLength: 4,
+	RData:    &proto.A{Addr: netip.MustParseAddr("127.0.0.1")},
+}
+
+var answerFuckOffAAAA = proto.ResourceRecord{
+	Name:     "",
+	Type:     proto.QTypeAAAA,
+	Class:    proto.ClassIN,
+	TTL:      math.MaxUint32,
+	RDLength: 16,
+	RData:    &proto.AAAA{Addr: netip.MustParseAddr("::1")},
 }
 
 func (b *BlacklistResolver) Resolve(ctx context.Context, in proto.Message) (proto.Message, error) {
 	q := in.Question[0]
 
+	// The server is a resolver, it has no zones to transfer,
+	// so the transfers are refused by policy.
+	if q.Type == proto.QTypeAXFR {
+		return proto.Message{}, fmt.Errorf("%w: zone transfer of %s", ErrRefused, q.Name)
+	}
+
 	if _, ok := b.blacklist[q.Name]; ok {
-		out := proto.Message{
-			Header: proto.Header{
-				ID:                 in.Header.ID,
-				Response:           true,
-				RecursionAvailable: true,
-				RCode:              proto.RCodeNoErrorCondition,
-				ANCount:            1,
-			},
-			Question:   in.Question,
-			Answer:     []proto.ResourceRecord{answerFuckOff},
-			Authority:  nil,
-			Additional: nil,
+		// Only address queries are answered with the loopback
+		// address. For other types, especially HTTPS and SVCB
+		// that browsers query for every site, the response is
+		// empty, so clients don't get any endpoint or hint of
+		// the blacklisted service.
+		out := emptyResponse(in)
+
+		var answer proto.ResourceRecord
+
+		switch q.Type {
+		case proto.QTypeA:
+			answer = answerFuckOff
+		case proto.QTypeAAAA:
+			answer = answerFuckOffAAAA
+		default:
+			return out, nil
 		}
 
+		answer.Name = q.Name
+		out.Answer = []proto.ResourceRecord{answer}
+
 		return out, nil
 	}
 
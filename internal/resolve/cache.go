@@ -2,8 +2,9 @@ package resolve
 
 import (
 	"context"
-	"errors"
-	"os"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -12,65 +13,484 @@ import (
 	"github.com/rokkerruslan/dnska/pkg/proto"
 )
 
-type cacheResolver struct {
+const (
+	defaultCacheMaxTTL = 24 * time.Hour
+
+	// defaultCacheMaxNegativeTTL is recommended
+	// by RFC 2308 section 5.
+	defaultCacheMaxNegativeTTL = 3 * time.Hour
+
+	// The values are recommended by RFC 8767 section 5.
+	defaultCacheStaleAnswerTTL = 30 * time.Second
+	defaultCacheClientTimeout  = 1800 * time.Millisecond
+
+	// cacheLookupTimeout limits the upstream lookups, they are
+	// shared by the identical queries and continue in background
+	// when the clients are gone, so the cache is refreshed. The
+	// lookups are cancelled when the cache is closed.
+	cacheLookupTimeout = 5 * time.Second
+
+	// cacheEncodeBufferSize limits the size of cached responses,
+	// the larger responses are not cached.
+	cacheEncodeBufferSize = 4096
+)
+
+type CacheResolverOpts struct {
+	// MinTTL and MaxTTL clamp the time responses are cached,
+	// the time is the minimum TTL of the response records.
+	// MaxTTL is 24 hours by default.
+	MinTTL time.Duration
+	MaxTTL time.Duration
+
+	// MaxNegativeTTL clamps the time NXDOMAIN and NODATA
+	// responses are cached, it's 3 hours by default.
+	MaxNegativeTTL time.Duration
+
+	// MaxStaleAge enables serve-stale (RFC 8767), the expired
+	// responses are answered if the upstream fails or does not
+	// respond within ClientTimeout (1.8 seconds by default), but
+	// no longer than MaxStaleAge after the expiration. The
+	// records of stale answers have StaleAnswerTTL (30 seconds
+	// by default).
+	MaxStaleAge    time.Duration
+	ClientTimeout  time.Duration
+	StaleAnswerTTL time.Duration
+
+	// PrefetchThreshold enables prefetch, the response that is hit
+	// at least PrefetchMinHits times in the last PrefetchThreshold
+	// percents of its TTL is refreshed in background.
+	PrefetchThreshold int
+	PrefetchMinHits   uint64
+
+	// MaxEntries and MaxBytes bound the size of the cache, the least
+	// recently used responses are evicted. See bucket.Opts.
+	MaxEntries int
+	MaxBytes   int
+
+	// SnapshotPath is the file the cache is saved into every
+	// SnapshotInterval and on Close, the saved cache is loaded
+	// by NewCacheResolver. The empty path disables snapshots.
+	SnapshotPath     string
+	SnapshotInterval time.Duration
+
+	L zerolog.Logger
+
+	Pass Resolver
+}
+
+// CacheResolver answers the queries from the cache of responses of
+// the resolver Pass. The cache must be closed by Close, so the last
+// snapshot is saved.
+type CacheResolver struct {
 	sub    Resolver
 	bucket *bucket.Bucket
+
+	minTTL         time.Duration
+	maxTTL         time.Duration
+	maxNegativeTTL time.Duration
+
+	maxStaleAge    time.Duration
+	clientTimeout  time.Duration
+	staleAnswerTTL time.Duration
+
+	prefetchThreshold int
+	prefetchMinHits   uint64
+
+	// flights coalesce the identical queries of cache misses
+	// and the refreshes of popular entries.
+	flights *flightGroup
+
+	l zerolog.Logger
 }
 
-func (c *cacheResolver) Resolve(ctx context.Context, in proto.Message) (proto.Message, error) {
+func (c *CacheResolver) Resolve(ctx context.Context, in proto.Message) (proto.Message, error) {
 	if len(in.Question) != 1 {
-		return proto.Message{}, errors.New("cache resolver currency not support multi-question requests")
+		return proto.Message{}, fmt.Errorf("%w: cache resolver currency not support multi-question requests", proto.ErrFormat)
 	}
 
-	q := in.Question[0]
+	key := cacheKey(in)
 
-	// todo: Calculate hash from q.Name and another fields
+	entry, expired, exists := c.bucket.Get(key)
+
+	var cached proto.Message
+	if exists {
+		cached, exists = c.decode(key, entry)
+	}
 
-	entry, expired, exists := c.bucket.Get(q.Name)
 	if exists && !expired {
-		dec := proto.NewDecoder()
+		cacheHitsTotal.WithLabelValues(cacheKind(cached)).Inc()
 
-		decoded, err := dec.Decode(entry.Val)
-		if err != nil {
-			return proto.Message{}, err
+		if c.shouldPrefetch(entry) {
+			cachePrefetchesTotal.Inc()
+			c.refresh(key, in)
 		}
 
-		// todo: id?
-		decoded.Header.ID = in.Header.ID
+		return replay(in, cached, time.Since(entry.Created)), nil
+	}
 
-		return decoded, nil
+	if exists && c.isServable(entry) {
+		return c.resolveOrStale(ctx, key, in, cached)
 	}
 
-	out, err := c.sub.Resolve(ctx, in)
+	out, err := c.resolve(ctx, key, in)
 	if err != nil {
 		return proto.Message{}, err
 	}
 
-	if out.Header.RCode == proto.RCodeNoErrorCondition {
-		enc := proto.NewEncoder(make([]byte, 512))
+	cacheMissesTotal.WithLabelValues(cacheKind(out)).Inc()
+
+	return out, nil
+}
+
+// decode decodes the cached response of the entry. The entry which
+// cannot be decoded (e.g. the one loaded from a snapshot of another
+// version) is dropped, so the query is resolved as a cache miss. The
+// error is not returned to the client, its query is not malformed.
+func (c *CacheResolver) decode(key string, entry bucket.Entry) (proto.Message, bool) {
+	dec := proto.AcquireDecoder()
+	cached, err := dec.Decode(entry.Val)
+	proto.ReleaseDecoder(dec)
+	if err != nil {
+		cacheCorruptEntriesTotal.Inc()
+		c.l.Printf("failed to decode cached response of %s :: error=%v", key, err)
+
+		c.bucket.Delete(key)
+
+		return proto.Message{}, false
+	}
+
+	return cached, true
+}
 
+// resolve resolves the query "in" by the upstream and caches the
+// response. The identical queries in flight share one lookup, the
+// key of the cache identifies them.
+func (c *CacheResolver) resolve(ctx context.Context, key string, in proto.Message) (proto.Message, error) {
+	out, err := c.flights.do(ctx, key, cacheLookupTimeout, func(ctx context.Context) (proto.Message, error) {
+		return c.lookup(ctx, key, in)
+	})
+	if err != nil {
+		return proto.Message{}, err
+	}
+
+	return share(in, out), nil
+}
+
+// lookup resolves the query "in" by the upstream and
+// caches the response, it's called by a flight.
+func (c *CacheResolver) lookup(ctx context.Context, key string, in proto.Message) (proto.Message, error) {
+	out, err := c.sub.Resolve(ctx, in)
+	if err == nil {
+		c.store(key, in, out)
+	}
+
+	return out, err
+}
+
+// isServable reports whether the expired entry can be answered
+// to clients when the upstream fails.
+func (c *CacheResolver) isServable(entry bucket.Entry) bool {
+	return c.maxStaleAge > 0 && time.Since(entry.Expires) <= c.maxStaleAge
+}
+
+// resolveOrStale resolves the query "in" with the expired response
+// "cached". If the upstream fails or the lookup takes longer than the client
+// timeout, the entry is answered. The lookup continues in background, so
+// the cache is refreshed when the upstream recovers (RFC 8767 section 5).
+func (c *CacheResolver) resolveOrStale(ctx context.Context, key string, in proto.Message, cached proto.Message) (proto.Message, error) {
+	lookupCtx, cancel := context.WithTimeout(ctx, c.clientTimeout)
+	defer cancel()
+
+	// The lookup continues when the client timeout expires.
+	out, err := c.resolve(lookupCtx, key, in)
+	if err == nil && out.Header.RCode != proto.RCodeServerFailure {
+		cacheMissesTotal.WithLabelValues(cacheKind(out)).Inc()
+		return out, nil
+	}
+
+	cacheStaleAnswersTotal.Inc()
+
+	return replayStale(in, cached, c.staleAnswerTTL), nil
+}
+
+// shouldPrefetch reports whether the popular entry is close to
+// the expiration, so it should be refreshed before it expires.
+func (c *CacheResolver) shouldPrefetch(entry bucket.Entry) bool {
+	if c.prefetchThreshold <= 0 || entry.Hits < c.prefetchMinHits {
+		return false
+	}
+
+	ttl := entry.Expires.Sub(entry.Created)
+
+	return time.Until(entry.Expires) <= ttl*time.Duration(c.prefetchThreshold)/100
+}
+
+// refresh resolves the query "in" in background and updates the
+// cache. The refresh is a flight, so only one lookup of a key is
+// running at a time and it's cancelled when the cache is closed.
+func (c *CacheResolver) refresh(key string, in proto.Message) {
+	_, _, _ = c.flights.start(key, cacheLookupTimeout, func(ctx context.Context) (proto.Message, error) {
+		return c.lookup(ctx, key, in)
+	})
+}
+
+// store puts the response "out" to the query "in"
+// into the cache if the response is cacheable.
+func (c *CacheResolver) store(key string, in, out proto.Message) {
+	if ttl, ok := c.ttl(out); ok {
+		enc := proto.AcquireEncoder(make([]byte, cacheEncodeBufferSize))
 		buf, err := enc.Encode(out)
+		proto.ReleaseEncoder(enc)
 		if err == nil {
-
 			entry := bucket.Entry{
-				Val: buf,
-				Tag: "",
+				Val: append([]byte(nil), buf...),
+				Tag: in.Question[0].Name,
 			}
 
-			c.bucket.Set(q.Name, entry, 10*time.Second)
+			c.bucket.Set(key, entry, ttl)
 		}
 	}
+}
 
-	return out, nil
+// ttl returns the time the response "out" is cached, false is
+// returned if the response must not be cached. The time is the
+// minimum TTL of the records clamped by the options.
+func (c *CacheResolver) ttl(out proto.Message) (time.Duration, bool) {
+	if out.Header.TruncateCation {
+		return 0, false
+	}
+
+	if isNegative(out) {
+		return c.negativeTTL(out)
+	}
+
+	if out.Header.RCode != proto.RCodeNoErrorCondition || len(out.Answer) == 0 {
+		return 0, false
+	}
+
+	minTTL := out.Answer[0].TTL
+	for _, section := range [][]proto.ResourceRecord{out.Answer, out.Authority, out.Additional} {
+		for _, record := range section {
+			if record.TTL < minTTL {
+				minTTL = record.TTL
+			}
+		}
+	}
+
+	return c.clamp(time.Duration(minTTL)*time.Second, c.maxTTL)
+}
+
+// negativeTTL returns the time NXDOMAIN or NODATA response "out" is
+// cached, that is the smallest of TTL and MINIMUM field of SOA record
+// of the authority section (RFC 2308 section 5). The responses
+// without SOA record are not cached.
+func (c *CacheResolver) negativeTTL(out proto.Message) (time.Duration, bool) {
+	record, ok := findRecord(out.Authority, proto.QTypeSOA)
+	if !ok {
+		return 0, false
+	}
+
+	soa, ok := record.RData.(*proto.SOA)
+	if !ok {
+		return 0, false
+	}
+
+	minTTL := record.TTL
+	if soa.Minimum < minTTL {
+		minTTL = soa.Minimum
+	}
+
+	// The CNAME chain of NXDOMAIN response expires too.
+	for _, answer := range out.Answer {
+		if answer.TTL < minTTL {
+			minTTL = answer.TTL
+		}
+	}
+
+	maxTTL := c.maxTTL
+	if c.maxNegativeTTL < maxTTL {
+		maxTTL = c.maxNegativeTTL
+	}
+
+	return c.clamp(time.Duration(minTTL)*time.Second, maxTTL)
+}
+
+func (c *CacheResolver) clamp(ttl, maxTTL time.Duration) (time.Duration, bool) {
+	if ttl < c.minTTL {
+		ttl = c.minTTL
+	}
+	if ttl > maxTTL {
+		ttl = maxTTL
+	}
+
+	return ttl, ttl > 0
 }
 
-func NewCacheResolver(sub Resolver) Resolver {
-	return &cacheResolver{
-		sub: sub,
+// isNegative reports whether the response "out" is NXDOMAIN or
+// NODATA, i.e. there are no records of the requested type.
+func isNegative(out proto.Message) bool {
+	switch out.Header.RCode {
+	case proto.RCodeNameError:
+		return true
+	case proto.RCodeNoErrorCondition:
+		if len(out.Question) == 0 {
+			return false
+		}
+
+		q := out.Question[0]
+		if q.Type == proto.QTypeALL || q.Type == proto.QTypeCName {
+			return len(out.Answer) == 0
+		}
+
+		// The CNAME chain may end with the name without
+		// records of the type.
+		_, ok := findRecord(out.Answer, q.Type)
+
+		return !ok
+	}
+
+	return false
+}
+
+// cacheKind returns the label of metrics for the response "out".
+func cacheKind(out proto.Message) string {
+	if isNegative(out) {
+		return "negative"
+	}
+
+	return "positive"
+}
+
+// cacheKey returns the key of the query "in" in the cache, the key
+// consists of the name (case-insensitive), type and class of the
+// question and DO and CD bits, because they change the content
+// of the response.
+func cacheKey(in proto.Message) string {
+	q := in.Question[0]
+
+	var b strings.Builder
+
+	b.WriteString(strings.ToLower(strings.TrimSuffix(q.Name, ".")))
+	b.WriteByte('/')
+	b.WriteString(strconv.FormatUint(uint64(q.Type), 10))
+	b.WriteByte('/')
+	b.WriteString(strconv.FormatUint(uint64(q.Class), 10))
+	b.WriteByte('/')
+
+	if in.EDNS != nil && in.EDNS.DNSSECOK {
+		b.WriteString("do")
+	}
+	if in.Header.CheckingDisabled {
+		b.WriteString("cd")
+	}
+
+	return b.String()
+}
+
+// replay makes the response to the query "in" from the cached
+// response "cached". The ID and question are taken from the query,
+// so the case of the question name is preserved, and the TTLs of
+// the records are decremented by the time "age" in the cache.
+func replay(in, cached proto.Message, age time.Duration) proto.Message {
+	cached.Header.ID = in.Header.ID
+	cached.Header.RecursionDesired = in.Header.RecursionDesired
+	cached.Question = in.Question
+
+	elapsed := uint32(age / time.Second)
+
+	for _, section := range [][]proto.ResourceRecord{cached.Answer, cached.Authority, cached.Additional} {
+		for i := range section {
+			if section[i].TTL > elapsed {
+				section[i].TTL -= elapsed
+			} else {
+				section[i].TTL = 0
+			}
+		}
+	}
+
+	return cached
+}
+
+// share makes the response to the query "in" from the response
+// "out" of the lookup that may be shared by the identical queries.
+// The ID and question are taken from the query, and the sections
+// are copied, so the callers do not modify the records of others.
+func share(in, out proto.Message) proto.Message {
+	out.Header.ID = in.Header.ID
+	out.Header.RecursionDesired = in.Header.RecursionDesired
+	out.Question = in.Question
+
+	out.Answer = append([]proto.ResourceRecord(nil), out.Answer...)
+	out.Authority = append([]proto.ResourceRecord(nil), out.Authority...)
+	out.Additional = append([]proto.ResourceRecord(nil), out.Additional...)
+
+	return out
+}
+
+// replayStale makes the response to the query "in" from the
+// expired response "cached", the records have TTL "ttl".
+func replayStale(in, cached proto.Message, ttl time.Duration) proto.Message {
+	out := replay(in, cached, 0)
+
+	for _, section := range [][]proto.ResourceRecord{out.Answer, out.Authority, out.Additional} {
+		for i := range section {
+			section[i].TTL = uint32(ttl / time.Second)
+		}
+	}
+
+	return out
+}
+
+func NewCacheResolver(opts CacheResolverOpts) *CacheResolver {
+	if opts.MaxTTL <= 0 {
+		opts.MaxTTL = defaultCacheMaxTTL
+	}
+	if opts.MaxNegativeTTL <= 0 {
+		opts.MaxNegativeTTL = defaultCacheMaxNegativeTTL
+	}
+	if opts.ClientTimeout <= 0 {
+		opts.ClientTimeout = defaultCacheClientTimeout
+	}
+	if opts.StaleAnswerTTL <= 0 {
+		opts.StaleAnswerTTL = defaultCacheStaleAnswerTTL
+	}
+
+	return &CacheResolver{
+		sub: opts.Pass,
 		bucket: bucket.New(bucket.Opts{
-			Path:    "/tmp/resolve-cache",
-			Verbose: false,
-			L:       zerolog.New(os.Stdout),
+			Path:       opts.SnapshotPath,
+			Verbose:    false,
+			L:          opts.L,
+			MaxEntries: opts.MaxEntries,
+			MaxBytes:   opts.MaxBytes,
+
+			SnapshotInterval: opts.SnapshotInterval,
+
+			// The expired responses are kept for serve-stale.
+			Retention: opts.MaxStaleAge,
 		}),
+		minTTL:         opts.MinTTL,
+		maxTTL:         opts.MaxTTL,
+		maxNegativeTTL: opts.MaxNegativeTTL,
+
+		maxStaleAge:    opts.MaxStaleAge,
+		clientTimeout:  opts.ClientTimeout,
+		staleAnswerTTL: opts.StaleAnswerTTL,
+
+		prefetchThreshold: opts.PrefetchThreshold,
+		prefetchMinHits:   opts.PrefetchMinHits,
+
+		flights: newFlightGroup(),
+
+		l: opts.L,
 	}
 }
+
+// Close cancels the lookups in progress and waits for them, then it
+// stops the background work of the cache and saves the snapshot. So
+// no responses are stored after the snapshot is saved.
+func (c *CacheResolver) Close() error {
+	c.flights.close()
+
+	return c.bucket.Close()
+}
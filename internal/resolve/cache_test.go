@@ -0,0 +1,414 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rokkerruslan/dnska/pkg/bucket"
+	"github.com/rokkerruslan/dnska/pkg/proto"
+	testing2 "github.com/rokkerruslan/dnska/testing"
+)
+
+// countingResolver answers A and AAAA queries with a single
+// record and counts the calls.
+type countingResolver struct {
+	calls int
+	ttl   uint32
+}
+
+func (r *countingResolver) Resolve(_ context.Context, in proto.Message) (proto.Message, error) {
+	r.calls++
+
+	q := in.Question[0]
+
+	record := proto.ResourceRecord{Name: q.Name, Type: q.Type, Class: q.Class, TTL: r.ttl}
+	switch q.Type {
+	case proto.QTypeA:
+		record.RData = &proto.A{Addr: netip.MustParseAddr("192.0.2.1")}
+	case proto.QTypeAAAA:
+		record.RData = &proto.AAAA{Addr: netip.MustParseAddr("2001:db8::1")}
+	}
+
+	return proto.Message{
+		Header:   proto.Header{ID: in.Header.ID, Response: true, RecursionDesired: in.Header.RecursionDesired},
+		Question: in.Question,
+		Answer:   []proto.ResourceRecord{record},
+	}, nil
+}
+
+func cacheQuery(id uint16, name string, qType proto.QType) proto.Message {
+	return proto.Message{
+		Header:   proto.Header{ID: id, RecursionDesired: true},
+		Question: []proto.Question{{Name: name, Type: qType, Class: proto.ClassIN}},
+	}
+}
+
+func TestCacheResolver(t *testing.T) {
+	sub := &countingResolver{ttl: 300}
+	cache := NewCacheResolver(CacheResolverOpts{Pass: sub})
+
+	ctx := context.Background()
+
+	_, err := cache.Resolve(ctx, cacheQuery(1, "cache-test.example", proto.QTypeA))
+	testing2.FailIfError(t, err)
+
+	// The name is case-insensitive, the question and ID are
+	// taken from the query.
+	out, err := cache.Resolve(ctx, cacheQuery(2, "Cache-Test.EXAMPLE", proto.QTypeA))
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, sub.calls, 1)
+	testing2.Assert(t, out.Header.ID, uint16(2))
+	testing2.Assert(t, out.Question[0].Name, "Cache-Test.EXAMPLE")
+	testing2.Assert(t, out.Answer[0].Type, proto.QTypeA)
+
+	// Another type is another key.
+	out, err = cache.Resolve(ctx, cacheQuery(3, "cache-test.example", proto.QTypeAAAA))
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, sub.calls, 2)
+	testing2.Assert(t, out.Answer[0].Type, proto.QTypeAAAA)
+
+	// DO bit is a part of the key.
+	query := cacheQuery(4, "cache-test.example", proto.QTypeA)
+	query.EDNS = &proto.EDNS{DNSSECOK: true}
+
+	_, err = cache.Resolve(ctx, query)
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, sub.calls, 3)
+}
+
+func TestCacheResolverTTL(t *testing.T) {
+	c := CacheResolver{minTTL: time.Minute, maxTTL: time.Hour, maxNegativeTTL: 2 * time.Hour}
+
+	response := func(ttls ...uint32) proto.Message {
+		var out proto.Message
+		for _, ttl := range ttls {
+			out.Answer = append(out.Answer, proto.ResourceRecord{TTL: ttl})
+		}
+
+		return out
+	}
+
+	for _, tc := range []struct {
+		name string
+		in   proto.Message
+		ttl  time.Duration
+		ok   bool
+	}{
+		{"minimum", response(600, 300, 900), 5 * time.Minute, true},
+		{"min clamp", response(10), time.Minute, true},
+		{"max clamp", response(86400), time.Hour, true},
+		{"no records", response(), 0, false},
+		{"nxdomain", negativeResponse(proto.RCodeNameError, 600, 300), 5 * time.Minute, true},
+		{"nodata", negativeResponse(proto.RCodeNoErrorCondition, 120, 3600), 2 * time.Minute, true},
+		{"negative min clamp", negativeResponse(proto.RCodeNameError, 600, 0), time.Minute, true},
+		{"negative max clamp", negativeResponse(proto.RCodeNameError, 86400, 86400), time.Hour, true},
+		{"negative without soa", proto.Message{Header: proto.Header{RCode: proto.RCodeNameError}}, 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ttl, ok := c.ttl(tc.in)
+
+			testing2.Assert(t, ttl, tc.ttl)
+			testing2.Assert(t, ok, tc.ok)
+		})
+	}
+}
+
+// negativeResponse returns NXDOMAIN or NODATA response with SOA
+// record of TTL "ttl" and MINIMUM field "minimum".
+func negativeResponse(rCode proto.RCode, ttl, minimum uint32) proto.Message {
+	return proto.Message{
+		Header:   proto.Header{Response: true, RCode: rCode},
+		Question: []proto.Question{{Name: "missing.example", Type: proto.QTypeA, Class: proto.ClassIN}},
+		Authority: []proto.ResourceRecord{
+			{
+				Name:  "example",
+				Type:  proto.QTypeSOA,
+				Class: proto.ClassIN,
+				TTL:   ttl,
+				RData: &proto.SOA{MName: "ns.example", RName: "hostmaster.example", Serial: 1, Minimum: minimum},
+			},
+		},
+	}
+}
+
+// negativeResolver answers every query with NXDOMAIN.
+type negativeResolver struct {
+	calls int
+}
+
+func (r *negativeResolver) Resolve(_ context.Context, in proto.Message) (proto.Message, error) {
+	r.calls++
+
+	out := negativeResponse(proto.RCodeNameError, 600, 300)
+	out.Header.ID = in.Header.ID
+	out.Question = in.Question
+
+	return out, nil
+}
+
+func TestCacheResolverNegative(t *testing.T) {
+	sub := &negativeResolver{}
+	cache := NewCacheResolver(CacheResolverOpts{Pass: sub})
+
+	ctx := context.Background()
+
+	_, err := cache.Resolve(ctx, cacheQuery(1, "negative-test.example", proto.QTypeA))
+	testing2.FailIfError(t, err)
+
+	out, err := cache.Resolve(ctx, cacheQuery(2, "negative-test.example", proto.QTypeA))
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, sub.calls, 1)
+	testing2.Assert(t, out.Header.ID, uint16(2))
+	testing2.Assert(t, out.Header.RCode, proto.RCodeNameError)
+	testing2.Assert(t, len(out.Authority), 1)
+	testing2.Assert(t, out.Authority[0].Type, proto.QTypeSOA)
+}
+
+func TestReplayDecrementsTTL(t *testing.T) {
+	cached := proto.Message{
+		Header:   proto.Header{ID: 1, Response: true},
+		Question: []proto.Question{{Name: "example.com", Type: proto.QTypeA, Class: proto.ClassIN}},
+		Answer: []proto.ResourceRecord{
+			{Name: "example.com", Type: proto.QTypeA, Class: proto.ClassIN, TTL: 300},
+			{Name: "example.com", Type: proto.QTypeA, Class: proto.ClassIN, TTL: 30},
+		},
+	}
+
+	out := replay(cacheQuery(7, "EXAMPLE.com", proto.QTypeA), cached, 100*time.Second)
+
+	testing2.Assert(t, out.Header.ID, uint16(7))
+	testing2.Assert(t, out.Question[0].Name, "EXAMPLE.com")
+	testing2.Assert(t, out.Answer[0].TTL, uint32(200))
+	testing2.Assert(t, out.Answer[1].TTL, uint32(0))
+}
+
+// failingResolver fails every query after the first "ok" ones.
+type failingResolver struct {
+	countingResolver
+	ok int
+}
+
+func (r *failingResolver) Resolve(ctx context.Context, in proto.Message) (proto.Message, error) {
+	if r.calls >= r.ok {
+		r.calls++
+		return proto.Message{}, ErrUpstream
+	}
+
+	return r.countingResolver.Resolve(ctx, in)
+}
+
+// expire makes the entry of the query "in" expired "age" ago.
+func expire(t *testing.T, c *CacheResolver, in proto.Message, age time.Duration) {
+	key := cacheKey(in)
+
+	entry, _, ok := c.bucket.Get(key)
+	if !ok {
+		t.Fatalf("no entry of %s", key)
+	}
+
+	c.bucket.Set(key, entry, -age)
+}
+
+func TestCacheResolverServeStale(t *testing.T) {
+	sub := &failingResolver{countingResolver: countingResolver{ttl: 300}, ok: 1}
+	c := NewCacheResolver(CacheResolverOpts{Pass: sub, MaxStaleAge: time.Hour})
+
+	ctx := context.Background()
+	query := cacheQuery(1, "stale-test.example", proto.QTypeA)
+
+	_, err := c.Resolve(ctx, query)
+	testing2.FailIfError(t, err)
+
+	expire(t, c, query, time.Minute)
+
+	out, err := c.Resolve(ctx, cacheQuery(2, "stale-test.example", proto.QTypeA))
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, sub.calls, 2)
+	testing2.Assert(t, out.Header.ID, uint16(2))
+	testing2.Assert(t, out.Answer[0].TTL, uint32(30))
+
+	// The entry is too old to be answered.
+	expire(t, c, query, 2*time.Hour)
+
+	_, err = c.Resolve(ctx, query)
+	testing2.Assert(t, errors.Is(err, ErrUpstream), true)
+}
+
+func TestCacheResolverPrefetch(t *testing.T) {
+	c := CacheResolver{prefetchThreshold: 10, prefetchMinHits: 2}
+
+	now := time.Now()
+
+	for _, tc := range []struct {
+		name  string
+		entry bucket.Entry
+		want  bool
+	}{
+		{"fresh", bucket.Entry{Created: now, Expires: now.Add(100 * time.Second), Hits: 5}, false},
+		{"close to expiration", bucket.Entry{Created: now.Add(-95 * time.Second), Expires: now.Add(5 * time.Second), Hits: 5}, true},
+		{"unpopular", bucket.Entry{Created: now.Add(-95 * time.Second), Expires: now.Add(5 * time.Second), Hits: 1}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testing2.Assert(t, c.shouldPrefetch(tc.entry), tc.want)
+		})
+	}
+}
+
+// blockingResolver answers the queries when "release" is closed.
+type blockingResolver struct {
+	countingResolver
+	mu      sync.Mutex
+	release chan struct{}
+}
+
+func (r *blockingResolver) Resolve(ctx context.Context, in proto.Message) (proto.Message, error) {
+	<-r.release
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.countingResolver.Resolve(ctx, in)
+}
+
+func TestCacheResolverCoalesce(t *testing.T) {
+	sub := &blockingResolver{countingResolver: countingResolver{ttl: 300}, release: make(chan struct{})}
+	c := NewCacheResolver(CacheResolverOpts{Pass: sub})
+
+	const n = 10
+
+	var (
+		wg      sync.WaitGroup
+		waiting atomic.Int32
+	)
+
+	outs := make([]proto.Message, n)
+	errs := make([]error, n)
+
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		i := i
+
+		go func() {
+			defer wg.Done()
+
+			waiting.Add(1)
+			outs[i], errs[i] = c.Resolve(context.Background(), cacheQuery(uint16(i), "coalesce-test.example", proto.QTypeA))
+		}()
+	}
+
+	// The queries join the flight before the upstream answers.
+	for waiting.Load() != n {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	close(sub.release)
+	wg.Wait()
+
+	testing2.Assert(t, sub.calls, 1)
+
+	for i := 0; i < n; i++ {
+		testing2.FailIfError(t, errs[i])
+		testing2.Assert(t, outs[i].Header.ID, uint16(i))
+		testing2.Assert(t, len(outs[i].Answer), 1)
+	}
+}
+
+func TestCacheResolverCorruptEntry(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ttl  time.Duration
+	}{
+		{"fresh", time.Minute},
+		{"stale", -time.Minute},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sub := &countingResolver{ttl: 300}
+			c := NewCacheResolver(CacheResolverOpts{Pass: sub, MaxStaleAge: time.Hour, L: zerolog.Nop()})
+
+			ctx := context.Background()
+			query := cacheQuery(1, "corrupt-test.example", proto.QTypeA)
+
+			// E.g. the entry is loaded from a snapshot of another version.
+			c.bucket.Set(cacheKey(query), bucket.Entry{Val: []byte{0x00, 0x01, 0x02}}, tc.ttl)
+
+			// The entry is dropped and the query is resolved, the
+			// client is not answered with a format error.
+			out, err := c.Resolve(ctx, query)
+			testing2.FailIfError(t, err)
+
+			testing2.Assert(t, sub.calls, 1)
+			testing2.Assert(t, len(out.Answer), 1)
+
+			_, err = c.Resolve(ctx, query)
+			testing2.FailIfError(t, err)
+
+			testing2.Assert(t, sub.calls, 1)
+		})
+	}
+}
+
+// cancelledResolver blocks the lookups until they are cancelled.
+type cancelledResolver struct {
+	started   chan struct{}
+	cancelled atomic.Int32
+}
+
+func (r *cancelledResolver) Resolve(ctx context.Context, _ proto.Message) (proto.Message, error) {
+	r.started <- struct{}{}
+
+	<-ctx.Done()
+	r.cancelled.Add(1)
+
+	return proto.Message{}, ctx.Err()
+}
+
+func TestCacheResolverCloseCancelsLookups(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		start func(c *CacheResolver, in proto.Message)
+	}{
+		{"query", func(c *CacheResolver, in proto.Message) {
+			go func() {
+				_, _ = c.Resolve(context.Background(), in)
+			}()
+		}},
+		{"prefetch", func(c *CacheResolver, in proto.Message) {
+			c.refresh(cacheKey(in), in)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sub := &cancelledResolver{started: make(chan struct{}, 1)}
+			c := NewCacheResolver(CacheResolverOpts{Pass: sub, L: zerolog.Nop()})
+
+			query := cacheQuery(1, "close-test.example", proto.QTypeA)
+
+			tc.start(c, query)
+			<-sub.started
+
+			// The lookup is cancelled and waited for, so nothing
+			// is stored after the snapshot is saved.
+			testing2.FailIfError(t, c.Close())
+			testing2.Assert(t, sub.cancelled.Load(), int32(1))
+
+			// No lookups are started after the cache is closed.
+			_, err := c.Resolve(context.Background(), query)
+			testing2.Assert(t, errors.Is(err, ErrUpstream), true)
+
+			c.refresh(cacheKey(query), query)
+			testing2.Assert(t, len(sub.started), 0)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package resolve
 import (
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
 
 	"github.com/rs/zerolog"
@@ -12,7 +13,7 @@ import (
 
 func check(in proto.Message) error {
 	if len(in.Question) == 0 {
-		return errors.New("question section is empty")
+		return fmt.Errorf("%w: question section is empty", proto.ErrFormat)
 	}
 
 	return nil
@@ -44,15 +45,23 @@ func (c *ChainResolver) Resolve(ctx context.Context, in proto.Message) (proto.Me
 		return proto.Message{}, errors.New("chain resolver has zero sub resolvers")
 	}
 
+	// The errors of all resolvers are joined, so the caller
+	// can choose a response code based on any of them.
+	var errs []error
+
 	for _, el := range c.chain {
 		out, err := el.Resolve(ctx, in)
-		if err != nil {
-			c.l.Printf("resolver=%s returns error=%s", reflect.ValueOf(el).Type(), err)
-			continue
+		if err == nil {
+			return out, nil
 		}
 
-		return out, nil
+		c.l.Printf("resolver=%s returns error=%s", reflect.ValueOf(el).Type(), err)
+
+		errs = append(errs, err)
+		if !fallThrough(err) || ctx.Err() != nil {
+			break
+		}
 	}
 
-	return proto.Message{}, errors.New("all resolvers return error")
+	return proto.Message{}, fmt.Errorf("chain resolver failed: %w", errors.Join(errs...))
 }
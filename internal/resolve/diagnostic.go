@@ -0,0 +1,43 @@
+package resolve
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	cacheHitsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dnska_resolve_cache_hits_total",
+		Help: "The total number of responses replayed from the cache by kind (positive or negative)",
+	}, []string{"kind"})
+
+	cacheMissesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dnska_resolve_cache_misses_total",
+		Help: "The total number of responses resolved on cache miss by kind (positive or negative)",
+	}, []string{"kind"})
+
+	cacheCorruptEntriesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dnska_resolve_cache_corrupt_entries_total",
+		Help: "The total number of cached responses which cannot be decoded and are dropped",
+	})
+
+	cacheStaleAnswersTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dnska_resolve_cache_stale_answers_total",
+		Help: "The total number of expired responses answered because the upstream failed or timed out",
+	})
+
+	flightsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dnska_resolve_flights_total",
+		Help: "The total number of upstream lookups of the cache misses",
+	})
+
+	coalescedQueriesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dnska_resolve_coalesced_queries_total",
+		Help: "The total number of queries answered by the lookup of an identical query in flight",
+	})
+
+	cachePrefetchesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dnska_resolve_cache_prefetches_total",
+		Help: "The total number of popular responses refreshed before the expiration",
+	})
+)
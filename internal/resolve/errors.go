@@ -0,0 +1,66 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/rokkerruslan/dnska/pkg/proto"
+)
+
+// Errors of resolvers, the errors are wrapped with the details
+// of a failure, use errors.Is to check them. The malformed
+// queries are reported with proto.ErrFormat.
+var (
+	// ErrNotFound means that the resolver has no data for the
+	// question, the next resolver of a chain is asked.
+	ErrNotFound = errors.New("not found")
+
+	// ErrRefused means that the resolver refuses to answer the
+	// question by a policy, the chain does not ask other resolvers.
+	ErrRefused = errors.New("refused")
+
+	// ErrTimeout means that an upstream server did not
+	// respond in time, the next resolver of a chain is asked.
+	ErrTimeout = errors.New("upstream timeout")
+
+	// ErrUpstream means that an upstream server cannot be reached or
+	// responds with a malformed message, the next resolver is asked.
+	ErrUpstream = errors.New("upstream failure")
+)
+
+// upstreamError wraps the error of the operation "op" with an
+// upstream server into ErrTimeout or ErrUpstream.
+func upstreamError(op string, err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %s: %v", ErrTimeout, op, err)
+	}
+
+	return fmt.Errorf("%w: %s: %v", ErrUpstream, op, err)
+}
+
+// fallThrough reports whether the chain should ask the next
+// resolver after the error "err" of the previous one.
+func fallThrough(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrTimeout) || errors.Is(err, ErrUpstream)
+}
+
+// RCode returns response code for the resolve error "err". The
+// failures of upstream servers and unknown errors are reported as
+// server failure, the name which no resolver knows is refused.
+func RCode(err error) proto.RCode {
+	switch {
+	case err == nil:
+		return proto.RCodeNoErrorCondition
+	case errors.Is(err, proto.ErrFormat):
+		return proto.RCodeFormatError
+	case errors.Is(err, ErrTimeout), errors.Is(err, ErrUpstream):
+		return proto.RCodeServerFailure
+	case errors.Is(err, ErrRefused), errors.Is(err, ErrNotFound):
+		return proto.RCodeRefused
+	}
+
+	return proto.RCodeServerFailure
+}
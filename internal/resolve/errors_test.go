@@ -0,0 +1,142 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rokkerruslan/dnska/pkg/proto"
+	testing2 "github.com/rokkerruslan/dnska/testing"
+)
+
+func TestRCode(t *testing.T) {
+	formatErr := &proto.FormatError{Err: proto.ErrTruncated}
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want proto.RCode
+	}{
+		{"no error", nil, proto.RCodeNoErrorCondition},
+		{"format", fmt.Errorf("chain resolver failed: %w", formatErr), proto.RCodeFormatError},
+		{"wrapped format", fmt.Errorf("%w: question section is empty", proto.ErrFormat), proto.RCodeFormatError},
+		{"timeout", upstreamError("read", context.DeadlineExceeded), proto.RCodeServerFailure},
+		{"upstream", upstreamError("dial", errors.New("connection refused")), proto.RCodeServerFailure},
+		{"refused", fmt.Errorf("%w: zone transfer", ErrRefused), proto.RCodeRefused},
+		{"not found", fmt.Errorf("static: %w", ErrNotFound), proto.RCodeRefused},
+		{"unknown", errors.New("chain resolver has zero sub resolvers"), proto.RCodeServerFailure},
+		{"joined not found and timeout", errors.Join(ErrNotFound, upstreamError("read", context.DeadlineExceeded)), proto.RCodeServerFailure},
+		{"joined not found and refused", fmt.Errorf("chain: %w", errors.Join(ErrNotFound, ErrRefused)), proto.RCodeRefused},
+		{"joined not found and format", errors.Join(ErrNotFound, formatErr), proto.RCodeFormatError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testing2.Assert(t, RCode(tc.err), tc.want)
+		})
+	}
+}
+
+func TestUpstreamError(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"deadline", context.DeadlineExceeded, ErrTimeout},
+		{"net timeout", &net.DNSError{Err: "i/o timeout", IsTimeout: true}, ErrTimeout},
+		{"net failure", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, ErrUpstream},
+		{"malformed", &proto.FormatError{Err: proto.ErrTruncated}, ErrUpstream},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := upstreamError("exchange", tc.err)
+
+			testing2.Assert(t, errors.Is(err, tc.want), true)
+
+			// The malformed upstream response is not the
+			// malformed query of the client.
+			testing2.Assert(t, errors.Is(err, proto.ErrFormat), false)
+		})
+	}
+}
+
+// stubResolver returns "out" and "err" and counts the calls.
+type stubResolver struct {
+	calls int
+	out   proto.Message
+	err   error
+}
+
+func (r *stubResolver) Resolve(context.Context, proto.Message) (proto.Message, error) {
+	r.calls++
+
+	return r.out, r.err
+}
+
+func TestChainResolver(t *testing.T) {
+	query := cacheQuery(1, "chain-test.example", proto.QTypeA)
+
+	for _, tc := range []struct {
+		name  string
+		err   error
+		next  bool
+		rCode proto.RCode
+	}{
+		{"not found", fmt.Errorf("static: %w", ErrNotFound), true, proto.RCodeNoErrorCondition},
+		{"timeout", upstreamError("read", context.DeadlineExceeded), true, proto.RCodeNoErrorCondition},
+		{"upstream", upstreamError("dial", errors.New("network is unreachable")), true, proto.RCodeNoErrorCondition},
+		{"refused", fmt.Errorf("%w: zone transfer", ErrRefused), false, proto.RCodeRefused},
+		{"format", fmt.Errorf("%w: question section is empty", proto.ErrFormat), false, proto.RCodeFormatError},
+		{"unknown", errors.New("unexpected"), false, proto.RCodeServerFailure},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			first := &stubResolver{err: tc.err}
+			next := &stubResolver{out: emptyResponse(query)}
+
+			chain := NewChainResolver(zerolog.Nop(), first, next)
+
+			_, err := chain.Resolve(context.Background(), query)
+
+			testing2.Assert(t, next.calls == 1, tc.next)
+			testing2.Assert(t, RCode(err), tc.rCode)
+		})
+	}
+
+	t.Run("all failed", func(t *testing.T) {
+		chain := NewChainResolver(zerolog.Nop(),
+			&stubResolver{err: ErrNotFound},
+			&stubResolver{err: upstreamError("read", context.DeadlineExceeded)})
+
+		_, err := chain.Resolve(context.Background(), query)
+
+		testing2.Assert(t, errors.Is(err, ErrNotFound), true)
+		testing2.Assert(t, errors.Is(err, ErrTimeout), true)
+		testing2.Assert(t, RCode(err), proto.RCodeServerFailure)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		next := &stubResolver{}
+		chain := NewChainResolver(zerolog.Nop(), &stubResolver{err: upstreamError("read", ctx.Err())}, next)
+
+		_, err := chain.Resolve(ctx, query)
+
+		testing2.Assert(t, next.calls, 0)
+		testing2.Assert(t, errors.Is(err, ErrUpstream), true)
+	})
+}
+
+func TestBlacklistResolverRefusesZoneTransfer(t *testing.T) {
+	pass := &stubResolver{}
+	b := NewBlacklistResolver(BlacklistResolverOpts{AutoReloadInterval: time.Hour, Pass: pass})
+
+	_, err := b.Resolve(context.Background(), cacheQuery(1, "example.com", proto.QTypeAXFR))
+
+	testing2.Assert(t, errors.Is(err, ErrRefused), true)
+	testing2.Assert(t, pass.calls, 0)
+}
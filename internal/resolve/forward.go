@@ -43,7 +43,7 @@ func (sfr *SimpleForwardUDPResolver) Resolve(ctx context.Context, in proto.Messa
 
 	conn, err := net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(sfr.addr))
 	if err != nil {
-		return proto.Message{}, fmt.Errorf("failed to dial: %v", err)
+		return proto.Message{}, upstreamError("dial", err)
 	}
 	defer func() {
 		if err := conn.Close(); err != nil {
@@ -51,47 +51,47 @@ func (sfr *SimpleForwardUDPResolver) Resolve(ctx context.Context, in proto.Messa
 		}
 	}()
 
-	enc := proto.NewEncoder(make([]byte, limits.UDPPayloadSizeLimit))
-
-	outBuf, err := enc.Encode(in)
+	enc := proto.AcquireEncoder(make([]byte, limits.UDPPayloadSizeLimit))
+	outBuf, err := enc.Encode(withEDNS(in))
+	proto.ReleaseEncoder(enc)
 	if err != nil {
 		return proto.Message{}, fmt.Errorf("failed to encode: %v", err)
 	}
 
 	if deadline, ok := ctx.Deadline(); ok {
 		if err := conn.SetWriteDeadline(deadline); err != nil {
-			return proto.Message{}, fmt.Errorf("failed to set write deadline: %v", err)
+			return proto.Message{}, upstreamError("set write deadline", err)
 		}
 	}
 
 	if _, err := conn.Write(outBuf); err != nil {
-		return proto.Message{}, fmt.Errorf("failed to send packet: %v", err)
+		return proto.Message{}, upstreamError("send packet", err)
 	}
 
-	out := make([]byte, limits.UDPPayloadSizeLimit)
+	out := make([]byte, limits.EDNSUDPPayloadSize)
 
 	if deadline, ok := ctx.Deadline(); ok {
 		if err := conn.SetReadDeadline(deadline); err != nil {
-			return proto.Message{}, fmt.Errorf("failed to set read deadline: %v", err)
+			return proto.Message{}, upstreamError("set read deadline", err)
 		}
 	}
 
 	n, err := conn.Read(out)
 	if err != nil {
-		return proto.Message{}, fmt.Errorf("failed to recieve packet: %v", err)
+		return proto.Message{}, upstreamError("receive packet", err)
 	}
 	out = out[:n]
 
-	dec := proto.NewDecoder()
-
+	dec := proto.AcquireDecoder()
 	outMsg, err := dec.Decode(out)
+	proto.ReleaseDecoder(dec)
 	if err != nil {
 		if sfr.dumpMalformedPackets {
 			// todo: dump and query too.
 			debug.DumpMalformedPacket(out)
 		}
 
-		return proto.Message{}, fmt.Errorf("failed to decode packet: %v", err)
+		return proto.Message{}, upstreamError("decode packet", err)
 	}
 
 	if in.Header.ID != outMsg.Header.ID {
@@ -100,8 +100,29 @@ func (sfr *SimpleForwardUDPResolver) Resolve(ctx context.Context, in proto.Messa
 			debug.DumpMalformedPacket(out)
 		}
 
-		return proto.Message{}, fmt.Errorf("id is not equal :: in=%d out=%d", in.Header.ID, outMsg.Header.ID)
+		return proto.Message{}, fmt.Errorf("%w: id is not equal :: in=%d out=%d", ErrUpstream, in.Header.ID, outMsg.Header.ID)
+	}
+
+	if outMsg.Header.TruncateCation {
+		return exchangeTCP(ctx, sfr.addr, in)
 	}
 
 	return outMsg, nil
 }
+
+// withEDNS returns a copy of query "in" that advertises our UDP
+// payload size to an upstream server. Options of the original
+// query are not forwarded, EDNS is a hop-by-hop extension.
+func withEDNS(in proto.Message) proto.Message {
+	edns := proto.EDNS{
+		UDPPayloadSize: limits.EDNSUDPPayloadSize,
+	}
+
+	if in.EDNS != nil {
+		edns.DNSSECOK = in.EDNS.DNSSECOK
+	}
+
+	in.EDNS = &edns
+
+	return in
+}
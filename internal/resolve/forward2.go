@@ -50,54 +50,58 @@ type ForwardUDPResolver struct {
 }
 
 func (fur *ForwardUDPResolver) Resolve(ctx context.Context, in proto.Message) (proto.Message, error) {
-	enc := proto.NewEncoder(make([]byte, limits.UDPPayloadSizeLimit))
-
-	outBuf, err := enc.Encode(in)
+	enc := proto.AcquireEncoder(make([]byte, limits.UDPPayloadSizeLimit))
+	outBuf, err := enc.Encode(withEDNS(in))
+	proto.ReleaseEncoder(enc)
 	if err != nil {
 		return proto.Message{}, fmt.Errorf("failed to encode: %v", err)
 	}
 
 	if deadline, ok := ctx.Deadline(); ok {
 		if err := fur.conn.SetWriteDeadline(deadline); err != nil {
-			return proto.Message{}, fmt.Errorf("failed to set write deadline: %v", err)
+			return proto.Message{}, upstreamError("set write deadline", err)
 		}
 	}
 
 	if _, err := fur.conn.Write(outBuf); err != nil {
-		return proto.Message{}, fmt.Errorf("failed to send packet: %v", err)
+		return proto.Message{}, upstreamError("send packet", err)
 	}
 
-	out := make([]byte, limits.UDPPayloadSizeLimit)
+	out := make([]byte, limits.EDNSUDPPayloadSize)
 
 	if deadline, ok := ctx.Deadline(); ok {
 		if err := fur.conn.SetReadDeadline(deadline); err != nil {
-			return proto.Message{}, fmt.Errorf("failed to set read deadline: %v", err)
+			return proto.Message{}, upstreamError("set read deadline", err)
 		}
 	}
 
 	n, err := fur.conn.Read(out)
 	if err != nil {
-		return proto.Message{}, fmt.Errorf("failed to recieve packet: %v", err)
+		return proto.Message{}, upstreamError("receive packet", err)
 	}
 	out = out[:n]
 
-	dec := proto.NewDecoder()
-
+	dec := proto.AcquireDecoder()
 	outMsg, err := dec.Decode(out)
+	proto.ReleaseDecoder(dec)
 	if err != nil {
 		if fur.dumpMalformedPackets {
 			// todo: dump and query too.
 			debug.DumpMalformedPacket(out)
 		}
 
-		return proto.Message{}, fmt.Errorf("failed to decode packet: %v", err)
+		return proto.Message{}, upstreamError("decode packet", err)
 	}
 
 	if in.Header.ID != outMsg.Header.ID {
 		// todo: dump and query too.
 		debug.DumpMalformedPacket(out)
 
-		return proto.Message{}, fmt.Errorf("id is not equal :: in=%d out=%d", in.Header.ID, outMsg.Header.ID)
+		return proto.Message{}, fmt.Errorf("%w: id is not equal :: in=%d out=%d", ErrUpstream, in.Header.ID, outMsg.Header.ID)
+	}
+
+	if outMsg.Header.TruncateCation {
+		return exchangeTCP(ctx, fur.addr, in)
 	}
 
 	return outMsg, nil
@@ -2,7 +2,6 @@ package resolve
 
 import (
 	"context"
-	"fmt"
 	"math/rand"
 	"net/netip"
 
@@ -27,12 +26,7 @@ func cycle(ctx context.Context, opts LookupOpts) (proto.Message, error) {
 	for {
 		n++
 
-		addr, err := netip.ParseAddr(forward)
-		if err != nil {
-			return proto.Message{}, fmt.Errorf("failed to parse next addr :: addr=%v, error=%v", forward, err)
-		}
-
-		addrPort := netip.AddrPortFrom(addr, 53)
+		addrPort := netip.AddrPortFrom(forward, 53)
 
 		in := proto.Message{
 			Header: proto.Header{
@@ -49,6 +43,8 @@ func cycle(ctx context.Context, opts LookupOpts) (proto.Message, error) {
 			},
 		}
 
+		// The resolver retries the query over TCP if
+		// the response is truncated.
 		res := NewSimpleForwardUDPResolver(SimpleForwardUDPResolverOpts{
 			ForwardAddr:          addrPort,
 			DumpMalformedPackets: opts.DumpUnknownPacket,
@@ -74,9 +70,9 @@ func cycle(ctx context.Context, opts LookupOpts) (proto.Message, error) {
 			// specified in the data field of the CNAME record. The one exception to
 			// this rule is that queries which match the CNAME type are not restarted.
 
-			if record, ok := findRecord(out.Answer, proto.QTypeCName); ok {
+			if cname, ok := findData[*proto.CNAME](out.Answer, proto.QTypeCName); ok {
 				out2, err := cycle(ctx, LookupOpts{
-					Name:              record.RData,
+					Name:              cname.Target,
 					Type:              proto.QTypeA,
 					Class:             proto.ClassIN,
 					ID:                1,
@@ -99,20 +95,18 @@ func cycle(ctx context.Context, opts LookupOpts) (proto.Message, error) {
 		// NS records cause both the usual additional section processing to locate
 		// a type A record, and, when used in a referral, a special search of the
 		// zone in which they reside for glue information.
-		if record, ok := FirstRecord(out.Additional, proto.QTypeA); ok {
-			//opts.L.Printf("found additional part :: name=%v, data=%v", record.Name, record.RData)
-
-			forward = record.RData
+		if glue, ok := findData[*proto.A](out.Additional, proto.QTypeA); ok {
+			forward = glue.Addr
 			continue
 		}
 
-		record, ok := FirstRecord(out.Authority, proto.QTypeNS)
+		ns, ok := findData[*proto.NS](out.Authority, proto.QTypeNS)
 		if !ok {
 			return out, nil
 		}
 
 		nsOut, err := cycle(ctx, LookupOpts{
-			Name:              record.RData,
+			Name:              ns.Host,
 			Type:              proto.QTypeA,
 			Class:             proto.ClassIN,
 			ID:                1,
@@ -123,8 +117,8 @@ func cycle(ctx context.Context, opts LookupOpts) (proto.Message, error) {
 			return proto.Message{}, err
 		}
 
-		if record, ok := findRecord(nsOut.Answer, proto.QTypeA); ok {
-			forward = record.RData
+		if a, ok := findData[*proto.A](nsOut.Answer, proto.QTypeA); ok {
+			forward = a.Addr
 			continue
 		}
 
@@ -153,3 +147,22 @@ func findRecord(records []proto.ResourceRecord, t proto.QType) (proto.ResourceRe
 func FirstRecord(list []proto.ResourceRecord, t proto.QType) (proto.ResourceRecord, bool) {
 	return findRecord(list, t)
 }
+
+// findData returns data of the first record with type "t" if the
+// data has type "T". Records whose data can not be interpreted
+// (e.g. malformed or unknown) are skipped.
+func findData[T proto.RData](records []proto.ResourceRecord, t proto.QType) (T, bool) {
+	for _, el := range records {
+		if el.Type != t {
+			continue
+		}
+
+		if data, ok := el.RData.(T); ok {
+			return data, true
+		}
+	}
+
+	var zero T
+
+	return zero, false
+}
@@ -4,10 +4,11 @@ import (
 	"bufio"
 	_ "embed"
 	"log"
+	"net/netip"
 	"strings"
 )
 
-var namedRootIndex []string
+var namedRootIndex []netip.Addr
 
 func init() {
 	lines, err := ReadNamedRootFile()
@@ -21,12 +22,16 @@ func init() {
 		}
 
 		qType := line[2]
-		addr := line[3]
 
 		if qType != "A" {
 			continue
 		}
 
+		addr, err := netip.ParseAddr(line[3])
+		if err != nil {
+			log.Fatal(err)
+		}
+
 		namedRootIndex = append(namedRootIndex, addr)
 	}
 }
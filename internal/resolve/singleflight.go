@@ -0,0 +1,120 @@
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rokkerruslan/dnska/pkg/proto"
+)
+
+// errFlightGroupClosed is returned for the lookups
+// that are started after the group is closed.
+var errFlightGroupClosed = fmt.Errorf("%w: resolver is closed", ErrUpstream)
+
+// flightGroup coalesces the concurrent lookups with the same key
+// into one lookup, its result is shared by all callers.
+type flightGroup struct {
+	// ctx is the parent context of lookups, it's cancelled
+	// when the group is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	flights map[string]*flight
+	running sync.WaitGroup
+}
+
+// flight is a lookup in progress, "done" is closed
+// when the result is ready.
+type flight struct {
+	done chan struct{}
+	out  proto.Message
+	err  error
+}
+
+func newFlightGroup() *flightGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &flightGroup{
+		ctx:     ctx,
+		cancel:  cancel,
+		flights: map[string]*flight{},
+	}
+}
+
+// do calls "fn" for the key if there is no lookup of the key in
+// progress, otherwise the caller waits for the result of that
+// lookup. The lookup is not bound to the context of a caller, it
+// continues up to "timeout" when the callers leave, so the result
+// still can be cached. The caller waits no longer than "ctx".
+func (g *flightGroup) do(ctx context.Context, key string, timeout time.Duration, fn func(context.Context) (proto.Message, error)) (proto.Message, error) {
+	f, joined, err := g.start(key, timeout, fn)
+	if err != nil {
+		return proto.Message{}, err
+	}
+
+	if joined {
+		coalescedQueriesTotal.Inc()
+	}
+
+	select {
+	case <-f.done:
+		return f.out, f.err
+	case <-ctx.Done():
+		return proto.Message{}, upstreamError("wait for lookup", ctx.Err())
+	}
+}
+
+// start starts the lookup of the key in background unless it's
+// already in progress, true is returned if the caller joins the
+// lookup started by another one.
+func (g *flightGroup) start(key string, timeout time.Duration, fn func(context.Context) (proto.Message, error)) (*flight, bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.ctx.Err() != nil {
+		return nil, false, errFlightGroupClosed
+	}
+
+	if f, ok := g.flights[key]; ok {
+		return f, true, nil
+	}
+
+	f := &flight{done: make(chan struct{})}
+	g.flights[key] = f
+
+	flightsTotal.Inc()
+
+	g.running.Add(1)
+
+	go func() {
+		defer g.running.Done()
+
+		lookupCtx, cancel := context.WithTimeout(g.ctx, timeout)
+		defer cancel()
+
+		f.out, f.err = fn(lookupCtx)
+
+		g.mu.Lock()
+		delete(g.flights, key)
+		g.mu.Unlock()
+
+		close(f.done)
+	}()
+
+	return f, false, nil
+}
+
+// close cancels the lookups in progress and waits for them,
+// no lookups are started after that.
+func (g *flightGroup) close() {
+	// The lookups are not started concurrently with the
+	// cancellation, so all of them are waited for.
+	g.mu.Lock()
+	g.cancel()
+	g.mu.Unlock()
+
+	g.running.Wait()
+}
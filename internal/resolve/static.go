@@ -3,6 +3,7 @@ package resolve
 import (
 	"context"
 	"fmt"
+	"net/netip"
 
 	"github.com/rs/zerolog"
 
@@ -14,26 +15,39 @@ type answer struct {
 }
 
 func NewStaticResolver(_ zerolog.Logger) *StaticResolver {
+	m := map[proto.Question]answer{
+		proto.Question{
+			Name:  "lolkek",
+			Type:  proto.QTypeA,
+			Class: proto.ClassIN,
+		}: {records: []proto.ResourceRecord{{
+			Name:     "lolkek",
+			Type:     proto.QTypeA,
+			Class:    proto.ClassIN,
+			TTL:      10,
+			RDLength: 4,
+			RData:    &proto.A{Addr: netip.MustParseAddr("127.0.0.1")},
+		}}},
+	}
+
+	names := map[string]struct{}{}
+	for q := range m {
+		names[q.Name] = struct{}{}
+	}
+
 	return &StaticResolver{
-		map[proto.Question]answer{
-			proto.Question{
-				Name:  "lolkek",
-				Type:  proto.QTypeA,
-				Class: proto.ClassIN,
-			}: {records: []proto.ResourceRecord{{
-				Name:     "lolkek",
-				Type:     proto.QTypeA,
-				Class:    proto.ClassIN,
-				TTL:      10,
-				RDLength: 9,
-				RData:    "127.0.0.1",
-			}}},
-		},
+		m:     m,
+		names: names,
 	}
 }
 
 type StaticResolver struct {
 	m map[proto.Question]answer
+
+	// names contains all owner names of the static records, it is
+	// used to answer with empty response when a name exists, but
+	// has no records of the requested type (e.g. HTTPS or AAAA).
+	names map[string]struct{}
 }
 
 func (s *StaticResolver) Resolve(_ context.Context, in proto.Message) (proto.Message, error) {
@@ -42,14 +56,18 @@ func (s *StaticResolver) Resolve(_ context.Context, in proto.Message) (proto.Mes
 	}
 
 	if len(in.Question) != 1 {
-		return proto.Message{}, fmt.Errorf("static resolver can not handle more than one query, got=%d", len(in.Question))
+		return proto.Message{}, fmt.Errorf("%w: static resolver can not handle more than one query, got=%d", proto.ErrFormat, len(in.Question))
 	}
 
 	question := in.Question[0]
 
 	ans, ok := s.m[question]
 	if !ok {
-		return proto.Message{}, fmt.Errorf("static resolver do not contains answer on q=%v", question)
+		if _, ok := s.names[question.Name]; ok {
+			return emptyResponse(in), nil
+		}
+
+		return proto.Message{}, fmt.Errorf("%w: static resolver do not contains answer on q=%v", ErrNotFound, question)
 	}
 
 	out := proto.Message{
@@ -73,3 +91,20 @@ func (s *StaticResolver) Resolve(_ context.Context, in proto.Message) (proto.Mes
 
 	return out, nil
 }
+
+// emptyResponse builds a successful response to query "in" without
+// records. The response means that the name exists, but has no data
+// of the requested type (NODATA).
+func emptyResponse(in proto.Message) proto.Message {
+	return proto.Message{
+		Header: proto.Header{
+			ID:                 in.Header.ID,
+			Response:           true,
+			Opcode:             in.Header.Opcode,
+			RecursionDesired:   in.Header.RecursionDesired,
+			RecursionAvailable: true,
+			RCode:              proto.RCodeNoErrorCondition,
+		},
+		Question: in.Question,
+	}
+}
@@ -0,0 +1,71 @@
+package resolve
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+
+	"github.com/rokkerruslan/dnska/internal/limits"
+	"github.com/rokkerruslan/dnska/pkg/proto"
+)
+
+// exchangeTCP sends query "in" to the upstream server "addr" over
+// TCP, it's used to retry the query whose UDP response is truncated
+// (RFC 7766 section 5).
+func exchangeTCP(ctx context.Context, addr netip.AddrPort, in proto.Message) (proto.Message, error) {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr.String())
+	if err != nil {
+		return proto.Message{}, upstreamError("dial tcp", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return proto.Message{}, upstreamError("set deadline", err)
+		}
+	}
+
+	// The query is encoded right after the length prefix.
+	buf := make([]byte, 2+limits.UDPPayloadSizeLimit)
+
+	enc := proto.AcquireEncoder(buf[2:])
+	query, err := enc.Encode(withEDNS(in))
+	proto.ReleaseEncoder(enc)
+	if err != nil {
+		return proto.Message{}, fmt.Errorf("failed to encode: %v", err)
+	}
+
+	binary.BigEndian.PutUint16(buf, uint16(len(query)))
+
+	if _, err := conn.Write(buf[:2+len(query)]); err != nil {
+		return proto.Message{}, upstreamError("send message", err)
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return proto.Message{}, upstreamError("receive length", err)
+	}
+
+	out := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, out); err != nil {
+		return proto.Message{}, upstreamError("receive message", err)
+	}
+
+	dec := proto.AcquireDecoder()
+	outMsg, err := dec.Decode(out)
+	proto.ReleaseDecoder(dec)
+	if err != nil {
+		return proto.Message{}, upstreamError("decode message", err)
+	}
+
+	if in.Header.ID != outMsg.Header.ID {
+		return proto.Message{}, fmt.Errorf("%w: id is not equal :: in=%d out=%d", ErrUpstream, in.Header.ID, outMsg.Header.ID)
+	}
+
+	return outMsg, nil
+}
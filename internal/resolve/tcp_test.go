@@ -0,0 +1,228 @@
+package resolve
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rokkerruslan/dnska/pkg/proto"
+	testing2 "github.com/rokkerruslan/dnska/testing"
+)
+
+// truncatingServer answers the queries over UDP with the truncated
+// responses without records and over TCP with the full responses.
+type truncatingServer struct {
+	addr netip.AddrPort
+
+	udpQueries atomic.Int32
+	tcpQueries atomic.Int32
+
+	// respond builds the TCP response to the query.
+	respond func(in proto.Message) proto.Message
+}
+
+func startTruncatingServer(t *testing.T, respond func(in proto.Message) proto.Message) *truncatingServer {
+	t.Helper()
+
+	s := &truncatingServer{respond: respond}
+
+	// The UDP and TCP sockets are bound to the same port.
+	var (
+		pc       *net.UDPConn
+		listener *net.TCPListener
+	)
+
+	for i := 0; i < 10 && listener == nil; i++ {
+		var err error
+
+		pc, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		testing2.FailIfError(t, err)
+
+		s.addr = pc.LocalAddr().(*net.UDPAddr).AddrPort()
+
+		listener, err = net.ListenTCP("tcp", net.TCPAddrFromAddrPort(s.addr))
+		if err != nil {
+			pc.Close()
+		}
+	}
+
+	if listener == nil {
+		t.Fatal("no free port")
+	}
+
+	t.Cleanup(func() {
+		pc.Close()
+		listener.Close()
+	})
+
+	go s.serveUDP(pc)
+	go s.serveTCP(listener)
+
+	return s
+}
+
+func (s *truncatingServer) serveUDP(pc *net.UDPConn) {
+	buf := make([]byte, 4096)
+
+	for {
+		n, from, err := pc.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			return
+		}
+
+		s.udpQueries.Add(1)
+
+		in, err := proto.NewDecoder().Decode(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		out := emptyResponse(in)
+		out.Header.TruncateCation = true
+
+		data, err := proto.NewEncoder(make([]byte, 512)).Encode(out)
+		if err != nil {
+			continue
+		}
+
+		_, _ = pc.WriteToUDPAddrPort(data, from)
+	}
+}
+
+func (s *truncatingServer) serveTCP(listener *net.TCPListener) {
+	for {
+		conn, err := listener.AcceptTCP()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+
+			var length [2]byte
+			if _, err := io.ReadFull(conn, length[:]); err != nil {
+				return
+			}
+
+			buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				return
+			}
+
+			s.tcpQueries.Add(1)
+
+			in, err := proto.NewDecoder().Decode(buf)
+			if err != nil {
+				return
+			}
+
+			data, err := proto.NewEncoder(make([]byte, 65535)).Encode(s.respond(in))
+			if err != nil {
+				return
+			}
+
+			_, _ = conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(data))), data...))
+		}()
+	}
+}
+
+// fullResponse answers the query with the records
+// which do not fit into a UDP response.
+func fullResponse(in proto.Message) proto.Message {
+	out := emptyResponse(in)
+
+	for i := 0; i < 100; i++ {
+		out.Answer = append(out.Answer, proto.ResourceRecord{
+			Name:  in.Question[0].Name,
+			Type:  proto.QTypeA,
+			Class: proto.ClassIN,
+			TTL:   300,
+			RData: &proto.A{Addr: netip.AddrFrom4([4]byte{192, 0, 2, byte(i)})},
+		})
+	}
+
+	return out
+}
+
+func TestForwardRetriesTruncatedOverTCP(t *testing.T) {
+	s := startTruncatingServer(t, fullResponse)
+
+	opts := SimpleForwardUDPResolverOpts{ForwardAddr: s.addr, L: zerolog.Nop()}
+
+	forward, err := NewForwardUDPResolver(opts)
+	testing2.FailIfError(t, err)
+	defer forward.Close()
+
+	for _, tc := range []struct {
+		name     string
+		resolver Resolver
+	}{
+		{"simple forward", NewSimpleForwardUDPResolver(opts)},
+		{"forward", forward},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			udpQueries, tcpQueries := s.udpQueries.Load(), s.tcpQueries.Load()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			out, err := tc.resolver.Resolve(ctx, cacheQuery(7, "truncated.example", proto.QTypeA))
+			testing2.FailIfError(t, err)
+
+			testing2.Assert(t, s.udpQueries.Load()-udpQueries, int32(1))
+			testing2.Assert(t, s.tcpQueries.Load()-tcpQueries, int32(1))
+
+			testing2.Assert(t, out.Header.ID, uint16(7))
+			testing2.Assert(t, out.Header.TruncateCation, false)
+			testing2.Assert(t, len(out.Answer), 100)
+		})
+	}
+}
+
+func TestExchangeTCP(t *testing.T) {
+	in := cacheQuery(7, "truncated.example", proto.QTypeA)
+
+	t.Run("id mismatch", func(t *testing.T) {
+		s := startTruncatingServer(t, func(in proto.Message) proto.Message {
+			out := fullResponse(in)
+			out.Header.ID++
+
+			return out
+		})
+
+		_, err := exchangeTCP(context.Background(), s.addr, in)
+		testing2.Assert(t, errors.Is(err, ErrUpstream), true)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		// The server accepts the connection, but does not answer.
+		listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		testing2.FailIfError(t, err)
+		defer listener.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		_, err = exchangeTCP(ctx, listener.Addr().(*net.TCPAddr).AddrPort(), in)
+		testing2.Assert(t, errors.Is(err, ErrTimeout), true)
+	})
+
+	t.Run("connection refused", func(t *testing.T) {
+		listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		testing2.FailIfError(t, err)
+
+		addr := listener.Addr().(*net.TCPAddr).AddrPort()
+		listener.Close()
+
+		_, err = exchangeTCP(context.Background(), addr, in)
+		testing2.Assert(t, errors.Is(err, ErrUpstream), true)
+	})
+}
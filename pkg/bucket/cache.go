@@ -1,9 +1,6 @@
 package bucket
 
 import (
-	"encoding/gob"
-	"errors"
-	"os"
 	"sync"
 	"time"
 
@@ -12,76 +9,129 @@ import (
 	"github.com/rs/zerolog"
 )
 
-// todo: Add cache for availability to cache
-// todo: responses into a proxy name server.
-
 // Interesting implementation.
 // https://dgraph.io/blog/post/introducing-ristretto-high-perf-go-cache/
 
-// A Bucket is a rudimentary in-memory cache.
+const (
+	defaultMaxEntries    = 100_000
+	defaultMaxBytes      = 64 << 20
+	defaultShards        = 16
+	defaultSweepInterval = time.Minute
+)
+
+// A Bucket is an in-memory cache bounded by the number of entries
+// and their size. The entries are spread over shards with their own
+// locks, each shard evicts the least recently used entries when
+// it's full. The entries expired longer than the retention time
+// are removed by the background sweeper.
 type Bucket struct {
 	path    string
 	verbose bool
 	l       zerolog.Logger
 
-	mu      sync.Mutex
-	entries map[string]holder
+	shards    []shard
+	retention time.Duration
+
+	exit     chan struct{}
+	exitOnce sync.Once
+	done     sync.WaitGroup
 }
 
 type Opts struct {
 	Path    string
 	Verbose bool
 	L       zerolog.Logger
+
+	// MaxEntries and MaxBytes bound the number of entries and
+	// their approximate size in memory, the least recently used
+	// entries are evicted above the limits. The defaults are
+	// 100000 entries and 64 MiB.
+	MaxEntries int
+	MaxBytes   int
+
+	// Shards is the number of independently locked parts
+	// of the bucket, it's rounded up to a power of two.
+	Shards int
+
+	// Retention is the time the expired entries are kept, so
+	// Get still reports them as expired (e.g. for serve-stale).
+	Retention time.Duration
+
+	// SweepInterval is the interval of removing entries
+	// expired longer than the retention time.
+	SweepInterval time.Duration
+
+	// SnapshotInterval is the interval of writing the entries
+	// into the file Path, the snapshot is also written by Close.
+	// Zero disables periodic snapshots, the empty Path disables
+	// snapshots and loading of entries at all.
+	SnapshotInterval time.Duration
 }
 
 func New(opts Opts) *Bucket {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaultMaxEntries
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultMaxBytes
+	}
+	if opts.Shards <= 0 {
+		opts.Shards = defaultShards
+	}
+	if opts.SweepInterval <= 0 {
+		opts.SweepInterval = defaultSweepInterval
+	}
+
+	shards := 1
+	for shards < opts.Shards {
+		shards <<= 1
+	}
+
 	b := Bucket{
-		path:    opts.Path,
-		verbose: opts.Verbose,
-		entries: map[string]holder{},
-		l:       opts.L,
-	}
-
-	func() {
-		f, err := os.Open(opts.Path)
-		if err != nil {
-			if errors.Is(err, os.ErrNotExist) {
-				b.trace("info, cache file %s not found", opts.Path)
-			} else {
-				b.trace("info, cache opening failed: %v", err)
-			}
+		path:      opts.Path,
+		verbose:   opts.Verbose,
+		l:         opts.L,
+		shards:    make([]shard, shards),
+		retention: opts.Retention,
+		exit:      make(chan struct{}),
+	}
 
-			return
-		}
+	for i := range b.shards {
+		b.shards[i].init(ceilDiv(opts.MaxEntries, shards), ceilDiv(opts.MaxBytes, shards))
+	}
 
-		if err := gob.NewDecoder(f).Decode(&b.entries); err != nil {
-			b.trace("error, decoding cache failed: %v", err)
-		}
-	}()
+	if err := b.load(); err != nil {
+		b.l.Printf("failed to load bucket snapshot %s :: error=%v", b.path, err)
+	}
+
+	b.done.Add(1)
+	go b.run(opts.SweepInterval, opts.SnapshotInterval)
 
 	return &b
 }
 
 func (b *Bucket) Set(key string, ent Entry, ttl time.Duration) {
+	now := b.now()
+
+	ent.Created = now
+	ent.Expires = now.Add(ttl)
+	ent.Hits = 0
+
 	h := holder{
 		Ent: ent,
-		Exp: b.now().Add(ttl),
+		Exp: ent.Expires,
 	}
 
 	b.trace("trace, bucket set key[%s] tag[%s] exp[%s]\n", key, ent.Tag, h.Exp.Format(time.RFC3339))
 	setKeyTotal.Inc()
 
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	b.entries[key] = h
+	b.shardOf(key).set(key, h)
 }
 
 // Get returns entry if entry exists, then expired status
-// then existing status.
+// then existing status. The hits of the entry are counted.
 func (b *Bucket) Get(key string) (Entry, bool, bool) {
-	b.mu.Lock()
-	h, ok := b.entries[key]
-	b.mu.Unlock()
+	h, ok := b.shardOf(key).get(key)
 
 	getKeyTotal.Inc()
 
@@ -103,28 +153,85 @@ func (b *Bucket) Get(key string) (Entry, bool, bool) {
 	return h.Ent, false, true
 }
 
-// Dump dump all existed entries cache to destination file
-// path.
-func (b *Bucket) Dump() error {
-	f, err := os.Create(b.path)
-	if err != nil {
-		return err
+// Delete removes the entry of the key if it exists.
+func (b *Bucket) Delete(key string) {
+	b.trace("trace, bucket delete key[%s]\n", key)
+
+	b.shardOf(key).delete(key)
+}
+
+// Len returns the number of entries in the bucket.
+func (b *Bucket) Len() int {
+	n := 0
+	for i := range b.shards {
+		n += b.shards[i].len()
 	}
 
-	encode := func() error {
-		enc := gob.NewEncoder(f)
+	return n
+}
+
+// Close stops the background work and writes the last snapshot.
+func (b *Bucket) Close() error {
+	var err error
+
+	b.exitOnce.Do(func() {
+		close(b.exit)
+		b.done.Wait()
+
+		err = b.Dump()
+	})
+
+	return err
+}
+
+// run removes the entries expired longer than the retention time
+// and writes snapshots with the intervals until Close.
+func (b *Bucket) run(sweepInterval, snapshotInterval time.Duration) {
+	defer b.done.Done()
+
+	sweep := time.NewTicker(sweepInterval)
+	defer sweep.Stop()
+
+	var snapshot <-chan time.Time
+	if snapshotInterval > 0 && b.path != "" {
+		ticker := time.NewTicker(snapshotInterval)
+		defer ticker.Stop()
+
+		snapshot = ticker.C
+	}
 
-		b.mu.Lock()
-		defer b.mu.Unlock()
+	for {
+		select {
+		case <-b.exit:
+			return
+		case <-sweep.C:
+			deadline := b.now().Add(-b.retention)
 
-		return enc.Encode(b.entries)
+			for i := range b.shards {
+				b.shards[i].removeExpired(deadline)
+			}
+		case <-snapshot:
+			if err := b.Dump(); err != nil {
+				b.l.Printf("failed to write bucket snapshot %s :: error=%v", b.path, err)
+			}
+		}
 	}
+}
 
-	if err := encode(); err != nil {
-		return err
+// shardOf returns the shard of "key" by FNV-1a hash of the key.
+func (b *Bucket) shardOf(key string) *shard {
+	const (
+		offset = 2166136261
+		prime  = 16777619
+	)
+
+	hash := uint32(offset)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= prime
 	}
 
-	return f.Close()
+	return &b.shards[hash&uint32(len(b.shards)-1)]
 }
 
 func (b *Bucket) trace(format string, a ...interface{}) {
@@ -140,6 +247,14 @@ func (b *Bucket) now() time.Time {
 type Entry struct {
 	Val []byte
 	Tag string
+
+	// Created and Expires are the time the entry is set and the
+	// time it expires, they are filled by Set.
+	Created time.Time
+	Expires time.Time
+
+	// Hits is the number of Get calls for the entry since Set.
+	Hits uint64
 }
 
 type holder struct {
@@ -147,6 +262,10 @@ type holder struct {
 	Exp time.Time
 }
 
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
+
 var (
 	setKeyTotal = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "dnska_bucket_set_total",
@@ -168,4 +287,20 @@ var (
 		Name: "dnska_bucket_cache_hit_non_expired_total",
 		Help: "The total number of cahce hit with non expired entries",
 	})
+	evictionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dnska_bucket_evictions_total",
+		Help: "The total number of removed entries by reason (capacity or expired)",
+	}, []string{"reason"})
+	entriesCount = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dnska_bucket_entries",
+		Help: "The number of entries in buckets",
+	})
+	entriesBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dnska_bucket_bytes",
+		Help: "The approximate size of entries in buckets in bytes",
+	})
+	snapshotEntriesCount = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dnska_bucket_snapshot_entries",
+		Help: "The number of entries written by the last snapshot",
+	})
 )
@@ -0,0 +1,101 @@
+package bucket
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	testing2 "github.com/rokkerruslan/dnska/testing"
+)
+
+// newTestBucket makes the bucket without snapshots,
+// it's closed by the cleanup of the test.
+func newTestBucket(t *testing.T, opts Opts) *Bucket {
+	opts.Path = ""
+	opts.Shards = 1
+
+	b := New(opts)
+	t.Cleanup(func() {
+		testing2.FailIfError(t, b.Close())
+	})
+
+	return b
+}
+
+func TestBucketEvictsLeastRecentlyUsed(t *testing.T) {
+	b := newTestBucket(t, Opts{MaxEntries: 2})
+
+	b.Set("a", Entry{Val: []byte("a")}, time.Minute)
+	b.Set("b", Entry{Val: []byte("b")}, time.Minute)
+
+	// "a" becomes the most recently used entry.
+	_, _, ok := b.Get("a")
+	testing2.Assert(t, ok, true)
+
+	b.Set("c", Entry{Val: []byte("c")}, time.Minute)
+
+	_, _, ok = b.Get("b")
+	testing2.Assert(t, ok, false)
+
+	_, _, ok = b.Get("a")
+	testing2.Assert(t, ok, true)
+
+	testing2.Assert(t, b.Len(), 2)
+}
+
+func TestBucketEvictsByBytes(t *testing.T) {
+	b := newTestBucket(t, Opts{MaxBytes: 3 * (entryOverhead + 1 + 100)})
+
+	for i := 0; i < 10; i++ {
+		b.Set(strconv.Itoa(i), Entry{Val: make([]byte, 100)}, time.Minute)
+	}
+
+	testing2.Assert(t, b.Len(), 3)
+
+	_, _, ok := b.Get("9")
+	testing2.Assert(t, ok, true)
+}
+
+func TestBucketSweepsExpired(t *testing.T) {
+	b := newTestBucket(t, Opts{SweepInterval: 10 * time.Millisecond, Retention: time.Minute})
+
+	b.Set("fresh", Entry{}, time.Minute)
+	b.Set("stale", Entry{}, -time.Second)
+	b.Set("expired", Entry{}, -time.Hour)
+
+	time.Sleep(50 * time.Millisecond)
+
+	_, expired, ok := b.Get("stale")
+	testing2.Assert(t, ok, true)
+	testing2.Assert(t, expired, true)
+
+	_, _, ok = b.Get("expired")
+	testing2.Assert(t, ok, false)
+
+	testing2.Assert(t, b.Len(), 2)
+}
+
+func TestBucketCountsHits(t *testing.T) {
+	b := newTestBucket(t, Opts{})
+
+	b.Set("a", Entry{}, time.Minute)
+
+	b.Get("a")
+	entry, _, _ := b.Get("a")
+
+	testing2.Assert(t, entry.Hits, uint64(2))
+}
+
+func TestBucketDelete(t *testing.T) {
+	b := newTestBucket(t, Opts{})
+
+	b.Set("a", Entry{Val: []byte("a")}, time.Minute)
+	b.Set("b", Entry{Val: []byte("b")}, time.Minute)
+
+	b.Delete("a")
+	b.Delete("unknown")
+
+	_, _, exists := b.Get("a")
+	testing2.Assert(t, exists, false)
+	testing2.Assert(t, b.Len(), 1)
+}
@@ -0,0 +1,143 @@
+package bucket
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// entryOverhead is the approximate size of the entry
+// bookkeeping (list element, map bucket and times).
+const entryOverhead = 128
+
+// shard is a part of the bucket with LRU eviction, the
+// front of the list is the most recently used entry.
+type shard struct {
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      list.List
+	bytes    int
+	maxLen   int
+	maxBytes int
+}
+
+type shardItem struct {
+	key  string
+	h    holder
+	size int
+}
+
+func (s *shard) init(maxLen, maxBytes int) {
+	s.entries = map[string]*list.Element{}
+	s.maxLen = maxLen
+	s.maxBytes = maxBytes
+}
+
+func (s *shard) get(key string) (holder, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return holder{}, false
+	}
+
+	s.lru.MoveToFront(el)
+
+	item := el.Value.(*shardItem)
+	item.h.Ent.Hits++
+
+	return item.h, true
+}
+
+func (s *shard) set(key string, h holder) {
+	size := len(key) + len(h.Ent.Val) + len(h.Ent.Tag) + entryOverhead
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		item := el.Value.(*shardItem)
+
+		s.account(size - item.size)
+		item.h, item.size = h, size
+		s.lru.MoveToFront(el)
+	} else {
+		s.entries[key] = s.lru.PushFront(&shardItem{key: key, h: h, size: size})
+		s.account(size)
+		entriesCount.Inc()
+	}
+
+	// The new entry is kept even if it's larger than the
+	// byte budget of the shard, the others are evicted.
+	for s.lru.Len() > 1 && (s.lru.Len() > s.maxLen || s.bytes > s.maxBytes) {
+		s.remove(s.lru.Back())
+		evictionsTotal.WithLabelValues("capacity").Inc()
+	}
+}
+
+func (s *shard) delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		s.remove(el)
+	}
+}
+
+// removeExpired removes the entries expired before "deadline".
+func (s *shard) removeExpired(deadline time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for el := s.lru.Back(); el != nil; {
+		prev := el.Prev()
+
+		if el.Value.(*shardItem).h.Exp.Before(deadline) {
+			s.remove(el)
+			evictionsTotal.WithLabelValues("expired").Inc()
+		}
+
+		el = prev
+	}
+}
+
+func (s *shard) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lru.Len()
+}
+
+// collect appends the entries of the shard to "to".
+func (s *shard) collect(to []snapshotEntry) []snapshotEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for el := s.lru.Back(); el != nil; el = el.Prev() {
+		item := el.Value.(*shardItem)
+
+		to = append(to, snapshotEntry{
+			Key:     item.key,
+			Val:     item.h.Ent.Val,
+			Tag:     item.h.Ent.Tag,
+			Created: item.h.Ent.Created,
+			Expires: item.h.Exp,
+		})
+	}
+
+	return to
+}
+
+func (s *shard) remove(el *list.Element) {
+	item := s.lru.Remove(el).(*shardItem)
+
+	delete(s.entries, item.key)
+	s.account(-item.size)
+	entriesCount.Dec()
+}
+
+func (s *shard) account(delta int) {
+	s.bytes += delta
+	entriesBytes.Add(float64(delta))
+}
@@ -0,0 +1,176 @@
+package bucket
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The snapshot file starts with the magic and the version octet,
+// then the gob stream of the number of entries and the entries
+// follows. Gob ignores unknown fields and leaves missing ones
+// zero, so the fields of snapshotEntry can be added and removed
+// without a new version. The version is incremented only for the
+// incompatible changes, the snapshots of other versions are
+// skipped on load.
+const (
+	snapshotMagic   = "DNSKA-BUCKET"
+	snapshotVersion = 1
+)
+
+// snapshotEntry is an entry of the snapshot file.
+type snapshotEntry struct {
+	Key     string
+	Val     []byte
+	Tag     string
+	Created time.Time
+	Expires time.Time
+}
+
+// Dump writes all entries of the bucket into the file Path. The
+// snapshot is written into a temporary file which replaces the
+// previous snapshot, so the file is never partially written.
+// The least recently used entries are written first, so they
+// are evicted first if the snapshot is larger than the bucket.
+func (b *Bucket) Dump() error {
+	if b.path == "" {
+		return nil
+	}
+
+	var entries []snapshotEntry
+	for i := range b.shards {
+		entries = b.shards[i].collect(entries)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(b.path), filepath.Base(b.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	if err := writeSnapshot(f, entries); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := os.Rename(f.Name(), b.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	snapshotEntriesCount.Set(float64(len(entries)))
+
+	return nil
+}
+
+func writeSnapshot(w io.Writer, entries []snapshotEntry) error {
+	bw := bufio.NewWriter(w)
+
+	if _, err := bw.WriteString(snapshotMagic); err != nil {
+		return err
+	}
+	if err := bw.WriteByte(snapshotVersion); err != nil {
+		return err
+	}
+
+	enc := gob.NewEncoder(bw)
+
+	if err := enc.Encode(len(entries)); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// load reads the snapshot of the file Path, the entries expired
+// longer than the retention time are discarded.
+func (b *Bucket) load() error {
+	if b.path == "" {
+		return nil
+	}
+
+	f, err := os.Open(b.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			b.trace("info, cache file %s not found", b.path)
+			return nil
+		}
+
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+
+	header := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return errors.New("unknown snapshot format")
+	}
+
+	if version := header[len(snapshotMagic)]; version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	dec := gob.NewDecoder(br)
+
+	var n int
+	if err := dec.Decode(&n); err != nil {
+		return fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+
+	now := b.now()
+	loaded := 0
+
+	for i := 0; i < n; i++ {
+		var entry snapshotEntry
+		if err := dec.Decode(&entry); err != nil {
+			return fmt.Errorf("failed to decode snapshot entry %d: %w", i, err)
+		}
+
+		if now.Sub(entry.Expires) > b.retention {
+			continue
+		}
+
+		b.shardOf(entry.Key).set(entry.Key, holder{
+			Ent: Entry{
+				Val:     entry.Val,
+				Tag:     entry.Tag,
+				Created: entry.Created,
+				Expires: entry.Expires,
+			},
+			Exp: entry.Expires,
+		})
+
+		loaded++
+	}
+
+	b.trace("info, loaded %d of %d entries from %s", loaded, n, b.path)
+
+	return nil
+}
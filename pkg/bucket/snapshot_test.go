@@ -0,0 +1,60 @@
+package bucket
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	testing2 "github.com/rokkerruslan/dnska/testing"
+)
+
+func TestBucketSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bucket.snapshot")
+
+	b := New(Opts{Path: path, Retention: time.Minute})
+	b.Set("fresh", Entry{Val: []byte("fresh"), Tag: "tag"}, time.Hour)
+	b.Set("stale", Entry{Val: []byte("stale")}, -time.Second)
+	b.Set("expired", Entry{Val: []byte("expired")}, -time.Hour)
+
+	// The last snapshot is written on close.
+	testing2.FailIfError(t, b.Close())
+
+	restored := New(Opts{Path: path, Retention: time.Minute})
+	defer restored.Close()
+
+	testing2.Assert(t, restored.Len(), 2)
+
+	entry, expired, ok := restored.Get("fresh")
+	testing2.Assert(t, ok, true)
+	testing2.Assert(t, expired, false)
+	testing2.Assert(t, entry.Val, []byte("fresh"))
+	testing2.Assert(t, entry.Tag, "tag")
+
+	_, expired, ok = restored.Get("stale")
+	testing2.Assert(t, ok, true)
+	testing2.Assert(t, expired, true)
+
+	_, _, ok = restored.Get("expired")
+	testing2.Assert(t, ok, false)
+
+	// No temporary files are left.
+	files, err := os.ReadDir(filepath.Dir(path))
+	testing2.FailIfError(t, err)
+	testing2.Assert(t, len(files), 1)
+}
+
+func TestBucketSnapshotUnknownFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bucket.snapshot")
+
+	for _, data := range []string{
+		"legacy gob stream",
+		snapshotMagic + "\x02",
+	} {
+		testing2.FailIfError(t, os.WriteFile(path, []byte(data), 0o600))
+
+		b := New(Opts{Path: path})
+		testing2.Assert(t, b.Len(), 0)
+		testing2.FailIfError(t, b.Close())
+	}
+}
@@ -19,6 +19,13 @@ func NewByteView(data []byte) *ByteView {
 	}
 }
 
+// Reset makes the view to look at "data" from the start, it allows
+// to reuse the view instead of allocating a new one.
+func (nb *ByteView) Reset(data []byte) {
+	nb.data = data
+	nb.pos = 0
+}
+
 func (nb *ByteView) Pos() uint {
 	return nb.pos
 }
@@ -148,7 +155,33 @@ func (nb *ByteView) PutUint32(b uint32) error {
 	return nil
 }
 
+func (nb *ByteView) PutBytes(b []byte) error {
+	if nb.pos+uint(len(b)) > uint(len(nb.data)) {
+		return &ErrBuf{op: "put", pos: nb.pos}
+	}
+
+	nb.pos += uint(copy(nb.data[nb.pos:], b))
+
+	return nil
+}
+
+func (nb *ByteView) PutString(s string) error {
+	if nb.pos+uint(len(s)) > uint(len(nb.data)) {
+		return &ErrBuf{op: "put", pos: nb.pos}
+	}
+
+	nb.pos += uint(copy(nb.data[nb.pos:], s))
+
+	return nil
+}
+
+// Bytes returns the data before the position, the position
+// past the end of the data is clamped.
 func (nb *ByteView) Bytes() []byte {
+	if nb.pos > uint(len(nb.data)) {
+		return nb.data
+	}
+
 	return nb.data[:nb.pos]
 }
 
@@ -0,0 +1,198 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"time"
+)
+
+// maxOutOfOrder limits the number of out-of-order
+// segments buffered for a single TCP stream.
+const maxOutOfOrder = 256
+
+// A Message is a DNS message found in the capture.
+type Message struct {
+	Timestamp time.Time
+	Transport string
+	Src, Dst  netip.AddrPort
+	Data      []byte
+}
+
+// An Extractor extracts DNS messages from the captured packets, the
+// UDP datagrams are messages as is and the TCP streams are reassembled
+// and split by the two byte length prefix (RFC 1035 4.2.2).
+type Extractor struct {
+	r       *Reader
+	ports   map[uint16]bool
+	streams map[flow]*stream
+	pending []Message
+}
+
+// NewExtractor returns an Extractor of the messages sent from or to
+// one of the "ports", all UDP and TCP packets are used if "ports" is empty.
+func NewExtractor(r *Reader, ports ...uint16) *Extractor {
+	e := Extractor{
+		r:       r,
+		ports:   make(map[uint16]bool, len(ports)),
+		streams: make(map[flow]*stream),
+	}
+
+	for _, port := range ports {
+		e.ports[port] = true
+	}
+
+	return &e
+}
+
+// Next returns the next message of the capture or io.EOF if there are
+// no more messages. The packets which cannot be decoded are skipped.
+func (e *Extractor) Next() (Message, error) {
+	for len(e.pending) == 0 {
+		p, err := e.r.Next()
+		if err != nil {
+			return Message{}, err
+		}
+
+		seg, err := decodeSegment(p)
+		if err != nil {
+			continue
+		}
+
+		if len(e.ports) != 0 && !e.ports[seg.src.Port()] && !e.ports[seg.dst.Port()] {
+			continue
+		}
+
+		switch seg.transport {
+		case TransportUDP:
+			e.pending = append(e.pending, Message{
+				Timestamp: p.Timestamp,
+				Transport: TransportUDP,
+				Src:       seg.src,
+				Dst:       seg.dst,
+				Data:      seg.payload,
+			})
+		case TransportTCP:
+			e.reassemble(p.Timestamp, seg)
+		}
+	}
+
+	m := e.pending[0]
+	e.pending = e.pending[1:]
+
+	return m, nil
+}
+
+type flow struct {
+	src, dst netip.AddrPort
+}
+
+// A stream is a single direction of a TCP connection.
+type stream struct {
+	next       uint32
+	buf        []byte
+	outOfOrder map[uint32][]byte
+}
+
+func (e *Extractor) reassemble(ts time.Time, seg segment) {
+	key := flow{src: seg.src, dst: seg.dst}
+
+	s, ok := e.streams[key]
+	if !ok || seg.syn {
+		// The capture may start in the middle of the connection,
+		// in that case the first seen segment starts the stream.
+		s = &stream{next: seg.seq, outOfOrder: make(map[uint32][]byte)}
+		if seg.syn {
+			s.next++
+		}
+
+		e.streams[key] = s
+	}
+
+	if err := s.add(seg.seq, seg.payload); err != nil {
+		delete(e.streams, key)
+		return
+	}
+
+	for {
+		data, ok := s.message()
+		if !ok {
+			break
+		}
+
+		e.pending = append(e.pending, Message{
+			Timestamp: ts,
+			Transport: TransportTCP,
+			Src:       seg.src,
+			Dst:       seg.dst,
+			Data:      data,
+		})
+	}
+
+	if seg.fin || seg.rst {
+		delete(e.streams, key)
+	}
+}
+
+// add adds the segment data to the stream, the sequence
+// numbers are compared with wraparound (RFC 1982).
+func (s *stream) add(seq uint32, payload []byte) error {
+	if len(payload) == 0 {
+		return nil
+	}
+
+	if int32(seq-s.next) > 0 {
+		if len(s.outOfOrder) >= maxOutOfOrder {
+			return errors.New("pcap: too many out-of-order segments")
+		}
+
+		s.outOfOrder[seq] = payload
+
+		return nil
+	}
+
+	s.append(seq, payload)
+
+	for found := true; found; {
+		found = false
+
+		for seq, payload := range s.outOfOrder {
+			if int32(seq-s.next) <= 0 {
+				delete(s.outOfOrder, seq)
+				s.append(seq, payload)
+				found = true
+			}
+		}
+	}
+
+	return nil
+}
+
+// append appends the part of payload after already received data.
+func (s *stream) append(seq uint32, payload []byte) {
+	overlap := int(s.next - seq)
+	if overlap >= len(payload) {
+		// Retransmission of received data.
+		return
+	}
+
+	s.buf = append(s.buf, payload[overlap:]...)
+	s.next += uint32(len(payload) - overlap)
+}
+
+// message returns the next complete message of the stream.
+func (s *stream) message() ([]byte, bool) {
+	if len(s.buf) < 2 {
+		return nil, false
+	}
+
+	length := int(binary.BigEndian.Uint16(s.buf))
+	if len(s.buf) < 2+length {
+		return nil, false
+	}
+
+	data := append([]byte(nil), s.buf[2:2+length]...)
+	s.buf = s.buf[2+length:]
+
+	return data, true
+}
@@ -0,0 +1,252 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88a8
+
+	protocolTCP = 6
+	protocolUDP = 17
+
+	// IPv6 extension headers.
+	ipv6HopByHop     = 0
+	ipv6Routing      = 43
+	ipv6Fragment     = 44
+	ipv6Destinations = 60
+)
+
+var errSkip = errors.New("pcap: not a udp or tcp packet")
+
+// Transports of the segments.
+const (
+	TransportUDP = "udp"
+	TransportTCP = "tcp"
+)
+
+// A segment is a transport layer (UDP or TCP) payload of the packet.
+type segment struct {
+	transport string
+	src, dst  netip.AddrPort
+
+	// TCP only fields.
+	seq      uint32
+	syn, fin bool
+	rst      bool
+
+	payload []byte
+}
+
+// decodeSegment decodes link, network and transport layers of the packet.
+func decodeSegment(p Packet) (segment, error) {
+	network, data, err := decodeLink(p.LinkType, p.Data)
+	if err != nil {
+		return segment{}, err
+	}
+
+	var (
+		src, dst netip.Addr
+		protocol uint8
+	)
+
+	switch network {
+	case etherTypeIPv4:
+		src, dst, protocol, data, err = decodeIPv4(data)
+	case etherTypeIPv6:
+		src, dst, protocol, data, err = decodeIPv6(data)
+	default:
+		return segment{}, errSkip
+	}
+	if err != nil {
+		return segment{}, err
+	}
+
+	switch protocol {
+	case protocolUDP:
+		if len(data) < 8 {
+			return segment{}, errors.New("pcap: udp header is too short")
+		}
+
+		length := int(binary.BigEndian.Uint16(data[4:]))
+		if length < 8 || length > len(data) {
+			// Captured UDP datagram is truncated or length
+			// field is zero (jumbograms), use the whole data.
+			length = len(data)
+		}
+
+		return segment{
+			transport: TransportUDP,
+			src:       netip.AddrPortFrom(src, binary.BigEndian.Uint16(data[0:])),
+			dst:       netip.AddrPortFrom(dst, binary.BigEndian.Uint16(data[2:])),
+			payload:   data[8:length],
+		}, nil
+
+	case protocolTCP:
+		if len(data) < 20 {
+			return segment{}, errors.New("pcap: tcp header is too short")
+		}
+
+		offset := int(data[12]>>4) * 4
+		if offset < 20 || offset > len(data) {
+			return segment{}, fmt.Errorf("pcap: invalid tcp data offset %d", offset)
+		}
+
+		flags := data[13]
+
+		return segment{
+			transport: TransportTCP,
+			src:       netip.AddrPortFrom(src, binary.BigEndian.Uint16(data[0:])),
+			dst:       netip.AddrPortFrom(dst, binary.BigEndian.Uint16(data[2:])),
+			seq:       binary.BigEndian.Uint32(data[4:]),
+			fin:       flags&0x01 != 0,
+			syn:       flags&0x02 != 0,
+			rst:       flags&0x04 != 0,
+			payload:   data[offset:],
+		}, nil
+	}
+
+	return segment{}, errSkip
+}
+
+// decodeLink returns ether type of the network layer and its data.
+func decodeLink(linkType uint32, data []byte) (uint16, []byte, error) {
+	switch linkType {
+	case LinkTypeEthernet:
+		if len(data) < 14 {
+			return 0, nil, errors.New("pcap: ethernet header is too short")
+		}
+
+		etherType := binary.BigEndian.Uint16(data[12:])
+		data = data[14:]
+
+		for etherType == etherTypeVLAN || etherType == etherTypeQinQ {
+			if len(data) < 4 {
+				return 0, nil, errors.New("pcap: vlan tag is too short")
+			}
+
+			etherType = binary.BigEndian.Uint16(data[2:])
+			data = data[4:]
+		}
+
+		return etherType, data, nil
+
+	case LinkTypeNull, LinkTypeLoop:
+		if len(data) < 4 {
+			return 0, nil, errors.New("pcap: loopback header is too short")
+		}
+
+		// The address family is in host byte order and its values for
+		// IPv6 differ between platforms, use version of IP header instead.
+		return ipVersion(data[4:]), data[4:], nil
+
+	case LinkTypeRaw, LinkTypeIPv4, LinkTypeIPv6:
+		return ipVersion(data), data, nil
+
+	case LinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return 0, nil, errors.New("pcap: linux sll header is too short")
+		}
+
+		return binary.BigEndian.Uint16(data[14:]), data[16:], nil
+
+	case LinkTypeLinuxSLL2:
+		if len(data) < 20 {
+			return 0, nil, errors.New("pcap: linux sll2 header is too short")
+		}
+
+		return binary.BigEndian.Uint16(data[0:]), data[20:], nil
+	}
+
+	return 0, nil, fmt.Errorf("pcap: unsupported link type %d", linkType)
+}
+
+// ipVersion returns ether type by the version of IP header.
+func ipVersion(data []byte) uint16 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	switch data[0] >> 4 {
+	case 4:
+		return etherTypeIPv4
+	case 6:
+		return etherTypeIPv6
+	}
+
+	return 0
+}
+
+func decodeIPv4(data []byte) (src, dst netip.Addr, protocol uint8, payload []byte, err error) {
+	if len(data) < 20 {
+		return src, dst, 0, nil, errors.New("pcap: ipv4 header is too short")
+	}
+
+	ihl := int(data[0]&0x0f) * 4
+	total := int(binary.BigEndian.Uint16(data[2:]))
+	if ihl < 20 || ihl > len(data) {
+		return src, dst, 0, nil, fmt.Errorf("pcap: invalid ipv4 header length %d", ihl)
+	}
+
+	// Total length is zero for TSO captures, use the captured data.
+	if total < ihl || total > len(data) {
+		total = len(data)
+	}
+
+	// todo: Reassembly of fragmented datagrams.
+	fragment := binary.BigEndian.Uint16(data[6:])
+	if fragment&0x3fff != 0 {
+		return src, dst, 0, nil, errSkip
+	}
+
+	src = netip.AddrFrom4([4]byte(data[12:16]))
+	dst = netip.AddrFrom4([4]byte(data[16:20]))
+
+	return src, dst, data[9], data[ihl:total], nil
+}
+
+func decodeIPv6(data []byte) (src, dst netip.Addr, protocol uint8, payload []byte, err error) {
+	if len(data) < 40 {
+		return src, dst, 0, nil, errors.New("pcap: ipv6 header is too short")
+	}
+
+	length := int(binary.BigEndian.Uint16(data[4:]))
+	next := data[6]
+
+	src = netip.AddrFrom16([16]byte(data[8:24]))
+	dst = netip.AddrFrom16([16]byte(data[24:40]))
+
+	payload = data[40:]
+	if length != 0 && length < len(payload) {
+		payload = payload[:length]
+	}
+
+	for {
+		switch next {
+		case ipv6HopByHop, ipv6Routing, ipv6Destinations:
+			if len(payload) < 8 {
+				return src, dst, 0, nil, errors.New("pcap: ipv6 extension header is too short")
+			}
+
+			size := (int(payload[1]) + 1) * 8
+			if size > len(payload) {
+				return src, dst, 0, nil, errors.New("pcap: ipv6 extension header is too short")
+			}
+
+			next, payload = payload[0], payload[size:]
+
+		case ipv6Fragment:
+			// todo: Reassembly of fragmented datagrams.
+			return src, dst, 0, nil, errSkip
+
+		default:
+			return src, dst, next, payload, nil
+		}
+	}
+}
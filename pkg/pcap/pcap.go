@@ -0,0 +1,337 @@
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// References:
+// - https://datatracker.ietf.org/doc/html/draft-ietf-opsawg-pcap
+// - https://datatracker.ietf.org/doc/html/draft-ietf-opsawg-pcapng
+// - https://www.tcpdump.org/linktypes.html
+
+// Link types of captured packets.
+const (
+	LinkTypeNull      uint32 = 0
+	LinkTypeEthernet  uint32 = 1
+	LinkTypeRaw       uint32 = 101
+	LinkTypeLoop      uint32 = 108
+	LinkTypeLinuxSLL  uint32 = 113
+	LinkTypeIPv4      uint32 = 228
+	LinkTypeIPv6      uint32 = 229
+	LinkTypeLinuxSLL2 uint32 = 276
+)
+
+const (
+	magicMicroseconds = 0xa1b2c3d4
+	magicNanoseconds  = 0xa1b23c4d
+
+	blockTypeSectionHeader  = 0x0a0d0d0a
+	blockTypeInterface      = 0x00000001
+	blockTypeSimplePacket   = 0x00000003
+	blockTypeEnhancedPacket = 0x00000006
+	byteOrderMagic          = 0x1a2b3c4d
+	optionEndOfOpt          = 0
+	optionInterfaceTSResol  = 9
+	maxBlockLength          = 16 << 20
+)
+
+var ErrUnknownFormat = errors.New("pcap: unknown file format")
+
+// A Packet is a single captured frame.
+type Packet struct {
+	Timestamp time.Time
+	LinkType  uint32
+	Data      []byte
+}
+
+// IsCapture reports whether "data" starts with
+// the pcap or pcapng file magic number.
+func IsCapture(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		switch order.Uint32(data) {
+		case magicMicroseconds, magicNanoseconds, blockTypeSectionHeader:
+			return true
+		}
+	}
+
+	return false
+}
+
+// A Reader reads packets from pcap and pcapng files.
+type Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+
+	// The pcap file header.
+	ng       bool
+	nano     bool
+	linkType uint32
+
+	// The interfaces of the current pcapng section.
+	interfaces []ngInterface
+}
+
+type ngInterface struct {
+	linkType uint32
+	// Timestamp units per second.
+	resolution uint64
+}
+
+// NewReader reads the file header and returns
+// a Reader of the pcap or pcapng file.
+func NewReader(r io.Reader) (*Reader, error) {
+	pr := Reader{r: bufio.NewReader(r)}
+
+	magic, err := pr.r.Peek(4)
+	if err != nil {
+		return nil, ErrUnknownFormat
+	}
+
+	if binary.BigEndian.Uint32(magic) == blockTypeSectionHeader {
+		pr.ng = true
+
+		// The byte order is detected by section header.
+		return &pr, nil
+	}
+
+	var header [24]byte
+	if _, err := io.ReadFull(pr.r, header[:]); err != nil {
+		return nil, fmt.Errorf("pcap: failed to read file header: %w", err)
+	}
+
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		switch order.Uint32(header[:]) {
+		case magicMicroseconds:
+			pr.order = order
+		case magicNanoseconds:
+			pr.order = order
+			pr.nano = true
+		}
+	}
+
+	if pr.order == nil {
+		return nil, ErrUnknownFormat
+	}
+
+	// The low 16 bits contain link type, the upper ones contain FCS length.
+	pr.linkType = pr.order.Uint32(header[20:]) & 0xffff
+
+	return &pr, nil
+}
+
+// Next returns the next packet of the file or io.EOF
+// if there are no more packets.
+func (pr *Reader) Next() (Packet, error) {
+	if pr.ng {
+		return pr.nextBlock()
+	}
+
+	var header [16]byte
+	if _, err := io.ReadFull(pr.r, header[:]); err != nil {
+		return Packet{}, unexpectedEOF(err)
+	}
+
+	sec := pr.order.Uint32(header[0:])
+	frac := pr.order.Uint32(header[4:])
+	capLen := pr.order.Uint32(header[8:])
+
+	if capLen > maxBlockLength {
+		return Packet{}, fmt.Errorf("pcap: packet length %d is too big", capLen)
+	}
+
+	data := make([]byte, capLen)
+	if _, err := io.ReadFull(pr.r, data); err != nil {
+		return Packet{}, unexpectedEOF(err)
+	}
+
+	nsec := int64(frac) * 1000
+	if pr.nano {
+		nsec = int64(frac)
+	}
+
+	return Packet{
+		Timestamp: time.Unix(int64(sec), nsec).UTC(),
+		LinkType:  pr.linkType,
+		Data:      data,
+	}, nil
+}
+
+func (pr *Reader) nextBlock() (Packet, error) {
+	for {
+		blockType, body, err := pr.readBlock()
+		if err != nil {
+			return Packet{}, err
+		}
+
+		switch blockType {
+		case blockTypeSectionHeader:
+			pr.interfaces = pr.interfaces[:0]
+
+		case blockTypeInterface:
+			if len(body) < 8 {
+				return Packet{}, errors.New("pcap: interface block is too short")
+			}
+
+			iface := ngInterface{
+				linkType:   uint32(pr.order.Uint16(body)),
+				resolution: 1_000_000,
+			}
+
+			pr.parseInterfaceOptions(&iface, body[8:])
+			pr.interfaces = append(pr.interfaces, iface)
+
+		case blockTypeEnhancedPacket:
+			if len(body) < 20 {
+				return Packet{}, errors.New("pcap: enhanced packet block is too short")
+			}
+
+			id := pr.order.Uint32(body)
+			if int(id) >= len(pr.interfaces) {
+				return Packet{}, fmt.Errorf("pcap: unknown interface %d", id)
+			}
+			iface := pr.interfaces[id]
+
+			ts := uint64(pr.order.Uint32(body[4:]))<<32 | uint64(pr.order.Uint32(body[8:]))
+			capLen := pr.order.Uint32(body[12:])
+
+			if uint64(capLen) > uint64(len(body)-20) {
+				return Packet{}, errors.New("pcap: packet exceeds its block")
+			}
+
+			return Packet{
+				Timestamp: iface.timestamp(ts),
+				LinkType:  iface.linkType,
+				Data:      body[20 : 20+capLen],
+			}, nil
+
+		case blockTypeSimplePacket:
+			if len(body) < 4 {
+				return Packet{}, errors.New("pcap: simple packet block is too short")
+			}
+			if len(pr.interfaces) == 0 {
+				return Packet{}, errors.New("pcap: simple packet block without interface")
+			}
+
+			// The simple packet block has no timestamp.
+			capLen := pr.order.Uint32(body)
+			if capLen > uint32(len(body)-4) {
+				capLen = uint32(len(body) - 4)
+			}
+
+			return Packet{
+				LinkType: pr.interfaces[0].linkType,
+				Data:     body[4 : 4+capLen],
+			}, nil
+		}
+
+		// Other blocks (statistics, name resolution, custom, etc.) are skipped.
+	}
+}
+
+// readBlock reads the pcapng block and returns its type and body.
+func (pr *Reader) readBlock() (uint32, []byte, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(pr.r, header[:]); err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+
+	if binary.BigEndian.Uint32(header[:]) == blockTypeSectionHeader {
+		magic, err := pr.r.Peek(4)
+		if err != nil {
+			return 0, nil, unexpectedEOF(err)
+		}
+
+		switch uint32(byteOrderMagic) {
+		case binary.BigEndian.Uint32(magic):
+			pr.order = binary.BigEndian
+		case binary.LittleEndian.Uint32(magic):
+			pr.order = binary.LittleEndian
+		default:
+			return 0, nil, errors.New("pcap: invalid section byte order magic")
+		}
+	}
+
+	if pr.order == nil {
+		return 0, nil, errors.New("pcap: block before section header")
+	}
+
+	blockType := pr.order.Uint32(header[:])
+	length := pr.order.Uint32(header[4:])
+
+	if length < 12 || length%4 != 0 || length > maxBlockLength {
+		return 0, nil, fmt.Errorf("pcap: invalid block length %d", length)
+	}
+
+	// The block ends with a copy of its length.
+	buf := make([]byte, length-8)
+	if _, err := io.ReadFull(pr.r, buf); err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+
+	return blockType, buf[:len(buf)-4], nil
+}
+
+func (pr *Reader) parseInterfaceOptions(iface *ngInterface, options []byte) {
+	for len(options) >= 4 {
+		code := pr.order.Uint16(options)
+		length := int(pr.order.Uint16(options[2:]))
+		options = options[4:]
+
+		if code == optionEndOfOpt || length > len(options) {
+			return
+		}
+
+		if code == optionInterfaceTSResol && length >= 1 {
+			// The most significant bit selects base of the
+			// resolution: 10 if it is zero and 2 otherwise.
+			exp := options[0] & 0x7f
+			switch {
+			case options[0]&0x80 != 0 && exp < 64:
+				iface.resolution = 1 << exp
+			case options[0]&0x80 == 0 && exp <= 19:
+				iface.resolution = uint64(math.Pow10(int(exp)))
+			}
+		}
+
+		// Options are padded to 32 bits.
+		length = (length + 3) &^ 3
+		if length > len(options) {
+			return
+		}
+		options = options[length:]
+	}
+}
+
+func (iface ngInterface) timestamp(ts uint64) time.Time {
+	sec := ts / iface.resolution
+	frac := ts % iface.resolution
+
+	var nsec uint64
+	if iface.resolution <= uint64(time.Second) {
+		nsec = frac * uint64(time.Second) / iface.resolution
+	} else {
+		nsec = frac / (iface.resolution / uint64(time.Second))
+	}
+
+	return time.Unix(int64(sec), int64(nsec)).UTC()
+}
+
+// unexpectedEOF keeps io.EOF only on the packet boundary,
+// the EOF in the middle of a packet is an error.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("pcap: truncated file: %w", err)
+	}
+
+	return err
+}
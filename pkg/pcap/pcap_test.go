@@ -0,0 +1,170 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/netip"
+	"testing"
+	"time"
+
+	testing2 "github.com/rokkerruslan/dnska/testing"
+)
+
+var (
+	client = netip.MustParseAddrPort("192.0.2.1:40000")
+	server = netip.MustParseAddrPort("192.0.2.53:53")
+)
+
+// ipv4Frame returns ethernet frame of UDP datagram or TCP segment.
+func ipv4Frame(protocol uint8, src, dst netip.AddrPort, seq uint32, flags uint8, payload []byte) []byte {
+	var transport []byte
+	switch protocol {
+	case protocolUDP:
+		transport = binary.BigEndian.AppendUint16(nil, src.Port())
+		transport = binary.BigEndian.AppendUint16(transport, dst.Port())
+		transport = binary.BigEndian.AppendUint16(transport, uint16(8+len(payload)))
+		transport = append(transport, 0, 0)
+	case protocolTCP:
+		transport = binary.BigEndian.AppendUint16(nil, src.Port())
+		transport = binary.BigEndian.AppendUint16(transport, dst.Port())
+		transport = binary.BigEndian.AppendUint32(transport, seq)
+		transport = append(transport, 0, 0, 0, 0, 5<<4, flags, 0xff, 0xff, 0, 0, 0, 0)
+	}
+	transport = append(transport, payload...)
+
+	ip := []byte{0x45, 0}
+	ip = binary.BigEndian.AppendUint16(ip, uint16(20+len(transport)))
+	ip = append(ip, 0, 0, 0x40, 0, 64, protocol, 0, 0)
+	ip = append(ip, src.Addr().AsSlice()...)
+	ip = append(ip, dst.Addr().AsSlice()...)
+
+	frame := make([]byte, 12, 14)
+	frame = binary.BigEndian.AppendUint16(frame, etherTypeIPv4)
+
+	return append(append(frame, ip...), transport...)
+}
+
+func pcapFile(packets ...[]byte) []byte {
+	buf := binary.LittleEndian.AppendUint32(nil, magicNanoseconds)
+	buf = append(buf, 2, 0, 4, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+	buf = binary.LittleEndian.AppendUint32(buf, 0xffff)
+	buf = binary.LittleEndian.AppendUint32(buf, LinkTypeEthernet)
+
+	for i, p := range packets {
+		buf = binary.LittleEndian.AppendUint32(buf, 1700000000)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(i))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(p)))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(p)))
+		buf = append(buf, p...)
+	}
+
+	return buf
+}
+
+func ngBlock(blockType uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+
+	buf := binary.BigEndian.AppendUint32(nil, blockType)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(12+len(body)))
+	buf = append(buf, body...)
+
+	return binary.BigEndian.AppendUint32(buf, uint32(12+len(body)))
+}
+
+func extractAll(t *testing.T, data []byte) []Message {
+	t.Helper()
+
+	r, err := NewReader(bytes.NewReader(data))
+	testing2.FailIfError(t, err)
+
+	ex := NewExtractor(r, 53)
+
+	var out []Message
+	for {
+		m, err := ex.Next()
+		if errors.Is(err, io.EOF) {
+			return out
+		}
+		testing2.FailIfError(t, err)
+
+		out = append(out, m)
+	}
+}
+
+func TestExtractorPcap(t *testing.T) {
+	query := []byte("query")
+	first := []byte("first response")
+	second := []byte("second")
+
+	stream := binary.BigEndian.AppendUint16(nil, uint16(len(first)))
+	stream = append(stream, first...)
+	stream = binary.BigEndian.AppendUint16(stream, uint16(len(second)))
+	stream = append(stream, second...)
+
+	const isn = 0xfffffff0 // Sequence numbers wrap around.
+
+	data := pcapFile(
+		ipv4Frame(protocolUDP, client, server, 0, 0, query),
+		ipv4Frame(protocolUDP, client, netip.MustParseAddrPort("192.0.2.2:8080"), 0, 0, []byte("http")),
+		ipv4Frame(protocolTCP, server, client, isn, 0x02, nil),
+		// Out-of-order and retransmitted segments.
+		ipv4Frame(protocolTCP, server, client, isn+1+10, 0x10, stream[10:]),
+		ipv4Frame(protocolTCP, server, client, isn+1, 0x10, stream[:6]),
+		ipv4Frame(protocolTCP, server, client, isn+1, 0x10, stream[:10]),
+	)
+
+	ts := func(nsec int) time.Time { return time.Unix(1700000000, int64(nsec)).UTC() }
+
+	want := []Message{
+		{Timestamp: ts(0), Transport: TransportUDP, Src: client, Dst: server, Data: query},
+		{Timestamp: ts(5), Transport: TransportTCP, Src: server, Dst: client, Data: first},
+		{Timestamp: ts(5), Transport: TransportTCP, Src: server, Dst: client, Data: second},
+	}
+
+	testing2.Assert(t, extractAll(t, data), want)
+}
+
+func TestExtractorPcapng(t *testing.T) {
+	section := binary.BigEndian.AppendUint32(nil, byteOrderMagic)
+	section = append(section, 0, 1, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+
+	// Interface with millisecond timestamps.
+	iface := binary.BigEndian.AppendUint16(nil, uint16(LinkTypeEthernet))
+	iface = append(iface, 0, 0, 0, 0, 0xff, 0xff)
+	iface = append(iface, 0, optionInterfaceTSResol, 0, 1, 3, 0, 0, 0)
+	iface = append(iface, 0, 0, 0, 0)
+
+	frame := ipv4Frame(protocolUDP, server, client, 0, 0, []byte("response"))
+
+	packet := []byte{0, 0, 0, 0}
+	packet = binary.BigEndian.AppendUint32(packet, uint32(1700000000123>>32))
+	packet = binary.BigEndian.AppendUint32(packet, uint32(1700000000123&0xffffffff))
+	packet = binary.BigEndian.AppendUint32(packet, uint32(len(frame)))
+	packet = binary.BigEndian.AppendUint32(packet, uint32(len(frame)))
+	packet = append(packet, frame...)
+
+	data := ngBlock(blockTypeSectionHeader, section)
+	data = append(data, ngBlock(blockTypeInterface, iface)...)
+	data = append(data, ngBlock(0x00000005, []byte{1, 2, 3, 4})...)
+	data = append(data, ngBlock(blockTypeEnhancedPacket, packet)...)
+
+	if !IsCapture(data) {
+		t.Fatal("pcapng file is not detected")
+	}
+
+	want := []Message{
+		{
+			Timestamp: time.Unix(1700000000, 123*int64(time.Millisecond)).UTC(),
+			Transport: TransportUDP,
+			Src:       server,
+			Dst:       client,
+			Data:      []byte("response"),
+		},
+	}
+
+	testing2.Assert(t, extractAll(t, data), want)
+}
@@ -0,0 +1,216 @@
+package proto
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rokkerruslan/dnska/internal/limits"
+	"github.com/rokkerruslan/dnska/pkg/bv"
+)
+
+// Reference - https://datatracker.ietf.org/doc/html/rfc4034#section-6
+
+// Canonical Form and Order of Resource Records
+//
+// The canonical form of an RR is the wire format of the RR where:
+//
+//  1. every domain name in the RR is fully expanded (no DNS name
+//     compression) and fully qualified;
+//  2. all uppercase US-ASCII letters in the owner name of the RR
+//     are replaced by the corresponding lowercase US-ASCII letters;
+//  3. if the type of the RR is NS, MD, MF, CNAME, SOA, MB, MG, MR,
+//     PTR, HINFO, MINFO, MX, HINFO, RP, AFSDB, RT, SIG, PX, NXT,
+//     NAPTR, KX, SRV, DNAME, A6, RRSIG, or NSEC, all uppercase
+//     US-ASCII letters in the DNS names contained within the RDATA
+//     are replaced by the corresponding lowercase US-ASCII letters;
+//  4. if the owner name of the RR is a wildcard name, the owner name
+//     is in its original unexpanded form, including the "*" label
+//     (no wildcard substitution);
+//  5. the RR's TTL is set to its original value as it appears in
+//     the originating authoritative zone or the Original TTL field
+//     of the covering RRSIG RR.
+//
+// RFC 6840 section 5.1 removes NSEC from the list of the item 3.
+
+// canonicalLowercaseTypes is the list of types (of the item 3 above)
+// supported by the package.
+var canonicalLowercaseTypes = map[QType]bool{
+	QTypeNS:    true,
+	QTypeMD:    true,
+	QTypeMF:    true,
+	QTypeCName: true,
+	QTypeSOA:   true,
+	QTypeMB:    true,
+	QTypeMG:    true,
+	QTypeMR:    true,
+	QTypePTR:   true,
+	QTypeMINFO: true,
+	QTypeMX:    true,
+	QTypeNAPTR: true,
+	QTypeSRV:   true,
+	QTypeRRSIG: true,
+}
+
+// maxRecordSize is the size of the largest possible record: a name,
+// fixed part (type, class, ttl and rdlength) and rdata.
+const maxRecordSize = limits.MaxNameSize + 2 + 10 + 0xffff
+
+// CanonicalRecord returns the canonical form of record "r"
+// with TTL "originalTTL".
+func CanonicalRecord(r ResourceRecord, originalTTL uint32) ([]byte, error) {
+	out, _, err := canonicalRecord(r, originalTTL)
+
+	return out, err
+}
+
+// CanonicalRRSet returns the canonical form of RRset "rrset": the
+// records in the canonical form with TTL "originalTTL", sorted in
+// the canonical order (RFC 4034 section 6.3) and without duplicates.
+//
+// All the records must have the same owner name, class and type.
+func CanonicalRRSet(rrset []ResourceRecord, originalTTL uint32) ([]byte, error) {
+	type canonicalRR struct {
+		wire  []byte
+		rData []byte
+	}
+
+	records := make([]canonicalRR, 0, len(rrset))
+	for _, el := range rrset {
+		if !strings.EqualFold(el.Name, rrset[0].Name) || el.Type != rrset[0].Type || el.Class != rrset[0].Class {
+			return nil, fmt.Errorf("record %s %v does not belong to rrset %s %v", el.Name, el.Type, rrset[0].Name, rrset[0].Type)
+		}
+
+		wire, rDataOffset, err := canonicalRecord(el, originalTTL)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, canonicalRR{wire: wire, rData: wire[rDataOffset:]})
+	}
+
+	// RRs with the same owner name, class, and type are sorted by
+	// treating the RDATA portion of the canonical form of each RR
+	// as a left-justified unsigned octet sequence in which the
+	// absence of an octet sorts before a zero octet.
+	sort.Slice(records, func(i, j int) bool {
+		return bytes.Compare(records[i].rData, records[j].rData) < 0
+	})
+
+	var out []byte
+	for i, el := range records {
+		if i > 0 && bytes.Equal(el.rData, records[i-1].rData) {
+			continue
+		}
+
+		out = append(out, el.wire...)
+	}
+
+	return out, nil
+}
+
+// SignedData returns the data that signature "sig" covers
+// (RFC 4034 section 3.1.8.1):
+//
+//	signature = sign(RRSIG_RDATA | RR(1) | RR(2)... )
+//
+// where RRSIG_RDATA is the wire format of the RRSIG RDATA fields
+// with the Signature field excluded and the Signer's Name field
+// in canonical form, RR(i) are the records of RRset "rrset" in
+// the canonical form and order. The owner name of the wildcard
+// expanded records is replaced with the wildcard name.
+func SignedData(sig *RRSIG, rrset []ResourceRecord) ([]byte, error) {
+	buf := bv.NewByteView(make([]byte, 18+limits.MaxNameSize+2))
+
+	if err := encodeRRSIGHeader(buf, &labelsIndex{canonical: true, lowercase: true}, sig); err != nil {
+		return nil, err
+	}
+
+	records := make([]ResourceRecord, 0, len(rrset))
+	for _, el := range rrset {
+		if el.Type != sig.TypeCovered {
+			return nil, fmt.Errorf("rrsig covers %v records, got %v", sig.TypeCovered, el.Type)
+		}
+
+		labels := strings.Split(strings.TrimSuffix(el.Name, "."), ".")
+		if el.Name == "" {
+			labels = nil
+		}
+
+		if len(labels) < int(sig.Labels) {
+			return nil, fmt.Errorf("rrsig labels %d exceeds labels of %q", sig.Labels, el.Name)
+		}
+
+		if len(labels) > int(sig.Labels) {
+			el.Name = strings.Join(append([]string{"*"}, labels[len(labels)-int(sig.Labels):]...), ".")
+		}
+
+		records = append(records, el)
+	}
+
+	rrsetData, err := CanonicalRRSet(records, sig.OriginalTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(buf.Bytes(), rrsetData...), nil
+}
+
+// canonicalRecord returns the canonical form of record "r" and
+// the offset of RDATA in it.
+func canonicalRecord(r ResourceRecord, originalTTL uint32) ([]byte, int, error) {
+	buf := bv.NewByteView(make([]byte, maxRecordSize))
+
+	owner := &labelsIndex{canonical: true, lowercase: true}
+	if err := owner.EncodeName(buf, r.Name); err != nil {
+		return nil, 0, err
+	}
+
+	if err := buf.PutUint16(uint16(r.Type)); err != nil {
+		return nil, 0, err
+	}
+
+	if err := buf.PutUint16(uint16(r.Class)); err != nil {
+		return nil, 0, err
+	}
+
+	if err := buf.PutUint32(originalTTL); err != nil {
+		return nil, 0, err
+	}
+
+	// RDLENGTH is reserved, the value is put when RDATA is encoded.
+	if err := buf.PutUint16(0); err != nil {
+		return nil, 0, err
+	}
+
+	start := buf.Pos()
+
+	index := &labelsIndex{canonical: true, lowercase: canonicalLowercaseTypes[r.Type]}
+	if err := encodeResourceData(buf, index, r); err != nil {
+		return nil, 0, err
+	}
+
+	end := buf.Pos()
+	buf.Seek(start - 2)
+
+	if err := buf.PutUint16(uint16(end - start)); err != nil {
+		return nil, 0, err
+	}
+
+	buf.Seek(end)
+
+	return buf.Bytes(), int(start), nil
+}
+
+// canonicalName returns the canonical wire format of name "name",
+// the name is uncompressed and lowercased.
+func canonicalName(name string) ([]byte, error) {
+	buf := bv.NewByteView(make([]byte, limits.MaxNameSize+2))
+
+	if err := (&labelsIndex{canonical: true, lowercase: true}).EncodeName(buf, name); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
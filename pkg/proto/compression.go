@@ -1,7 +1,6 @@
 package proto
 
 import (
-	"errors"
 	"fmt"
 	"strings"
 
@@ -99,6 +98,12 @@ import (
 
 type labelsIndex struct {
 	nameIndex map[string]uint
+
+	// canonical disables compression and, together with
+	// lowercase, is used for the canonical form of records
+	// (RFC 4034 section 6.2).
+	canonical bool
+	lowercase bool
 }
 
 // EncodeName encodes domain name in buffer.
@@ -117,20 +122,21 @@ func (li *labelsIndex) EncodeName(b *bv.ByteView, s string) error {
 
 	s = strings.TrimSuffix(s, ".")
 
-	if labels, offset, exist := li.getName(s); exist {
-		if len(labels) != 0 { // todo: This is incorrect. Make generic algorithm for labels index.
+	if li.canonical {
+		return li.encodeLabels(b, s)
+	}
+
+	if prefix, offset, exist := li.getName(s); exist {
+		if len(prefix) != 0 { // todo: This is incorrect. Make generic algorithm for labels index.
 			li.putName(s, b.Pos())
 		}
 
-		for _, label := range labels {
-			if err := b.PutUint8(uint8(len(label))); err != nil {
-				return err
-			}
+		for len(prefix) != 0 {
+			var label string
+			label, prefix = nextLabel(prefix)
 
-			for _, ch := range []byte(label) {
-				if err := b.PutUint8(ch); err != nil {
-					return err
-				}
+			if err := putLabel(b, label); err != nil {
+				return err
 			}
 		}
 
@@ -147,136 +153,101 @@ func (li *labelsIndex) EncodeName(b *bv.ByteView, s string) error {
 		return nil
 	}
 
-	var parts []Part
-	for _, label := range strings.Split(s, ".") {
+	return li.encodeLabels(b, s)
+}
+
+// EncodeNameUncompressed encodes domain name in buffer without
+// compression pointers, but the name still can be a target of
+// pointers of the subsequent names.
+//
+// Names inside RDATA of the RR types that are defined after
+// RFC 1035 must not be compressed (RFC 3597 section 4).
+func (li *labelsIndex) EncodeNameUncompressed(b *bv.ByteView, s string) error {
+	if len(s) > limits.MaxNameSize {
+		return fmt.Errorf("the name length should be %d or less, got %d", limits.MaxNameSize, len(s))
+	}
+
+	return li.encodeLabels(b, strings.TrimSuffix(s, "."))
+}
+
+// encodeLabels writes full sequence of labels of name "s" and
+// remembers offsets of the labels in the index.
+func (li *labelsIndex) encodeLabels(b *bv.ByteView, s string) error {
+	if li.lowercase {
+		s = strings.ToLower(s)
+	}
+
+	// The suffixes of "s" are used as keys of the index, so
+	// the index is built without allocation of new strings.
+	for rest := s; len(rest) != 0; {
+		var label string
+		suffix := rest
+		label, rest = nextLabel(rest)
+
 		if len(label) == 0 {
 			// todo: error because label is empty?
 			break
 		}
 
-		labelLength := uint8(len(label))
-
-		if labelLength > limits.MaxLabelSize {
-			return fmt.Errorf("label %q too big", label)
+		if !li.canonical {
+			li.putName(suffix, b.Pos())
 		}
 
-		parts = append(parts, Part{
-			Label:  label,
-			Offset: b.Pos(),
-		})
-
-		if err := b.PutUint8(labelLength); err != nil {
+		if err := putLabel(b, label); err != nil {
 			return err
 		}
-
-		for _, ch := range []byte(label) {
-			if err := b.PutUint8(ch); err != nil {
-				return err
-			}
-		}
 	}
 
-	if err := b.PutUint8(0); err != nil {
-		return err
-	}
+	return b.PutUint8(0)
+}
 
-	// Build index.
+// nextLabel splits name "s" into the first label and the rest of name.
+func nextLabel(s string) (string, string) {
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return s[:i], s[i+1:]
+	}
 
-	for i := len(parts) - 1; i >= 0; i-- {
-		elements := parts[i:]
+	return s, ""
+}
 
-		buf := strings.Builder{}
-		for _, el := range elements {
-			buf.WriteString(el.Label)
-			buf.WriteByte('.')
-		}
+func putLabel(b *bv.ByteView, label string) error {
+	if len(label) > limits.MaxLabelSize {
+		return fmt.Errorf("label %q too big", label)
+	}
 
-		li.putName(strings.TrimSuffix(buf.String(), "."), elements[0].Offset)
+	if err := b.PutUint8(uint8(len(label))); err != nil {
+		return err
 	}
 
-	return nil
+	return b.PutString(label)
 }
 
 func (li *labelsIndex) DecodeName(b *bv.ByteView) (string, error) {
-	pos := b.Pos()
-
-	jumped := false
-	maxJumps := 5
-	jumpsPerformed := 0
-
-	delim := ""
-	out := ""
+	return decodeName(b)
+}
 
-	for {
-		if jumpsPerformed > maxJumps {
-			return "", errors.New("jumps limit reached")
+// getName finds the longest suffix of "name" in the index and returns
+// the labels before the suffix and the offset of the suffix.
+func (li *labelsIndex) getName(name string) (string, uint, bool) {
+	for rest := name; ; {
+		if offset, ok := li.nameIndex[rest]; ok {
+			return strings.TrimSuffix(name[:len(name)-len(rest)], "."), offset, true
 		}
 
-		length, err := b.Index(pos)
-		if err != nil {
-			return "", err
+		if len(rest) == 0 {
+			return "", 0, false
 		}
 
-		if length&0xc0 == 0xc0 {
-			if !jumped {
-				b.Seek(pos + 2)
-			}
-
-			b2, err := b.Index(pos + 1)
-			if err != nil {
-				return "", err
-			}
-
-			offset := (uint16(length^0xc0) << 8) | uint16(b2)
-			pos = uint(offset)
-
-			jumped = true
-			jumpsPerformed++
-
-			continue
-		} else {
-			pos++
-
-			if length == 0 {
-				break
-			}
-
-			out += delim
-			part, err := b.TakeRange(pos, uint(length))
-			if err != nil {
-				return "", err
-			}
-
-			out += string(part)
-
-			delim = "."
-			pos += uint(length)
-		}
-	}
-
-	if !jumped {
-		b.Seek(pos)
+		_, rest = nextLabel(rest)
 	}
-
-	return out, nil
 }
 
-func (li *labelsIndex) getName(name string) ([]string, uint, bool) {
-	labels := strings.Split(name, ".")
-
-	for i := 0; i < len(labels); i++ {
-		n := strings.Join(labels[i:], ".")
-
-		offset, ok := li.nameIndex[n]
-		if ok {
-			return labels[:i], offset, ok
-		}
+func (li *labelsIndex) putName(name string, index uint) {
+	// The offset of a pointer is 14 bits wide.
+	if index > 0x3fff {
+		return
 	}
 
-	return nil, 0, false
-}
-
-func (li *labelsIndex) putName(name string, index uint) {
 	if li.nameIndex == nil {
 		li.nameIndex = map[string]uint{}
 	}
@@ -287,3 +258,10 @@ func (li *labelsIndex) putName(name string, index uint) {
 
 	li.nameIndex[name] = index
 }
+
+// reset forgets all names of the index, the memory of the index is kept.
+func (li *labelsIndex) reset() {
+	for name := range li.nameIndex {
+		delete(li.nameIndex, name)
+	}
+}
@@ -1,20 +1,65 @@
 package proto
 
 import (
-	"errors"
 	"fmt"
+	"net/netip"
+	"sync"
 
+	"github.com/rokkerruslan/dnska/internal/limits"
 	"github.com/rokkerruslan/dnska/pkg/bv"
 )
 
-type Decoder struct{}
+// maxInternedNames limits the number of names remembered by a decoder.
+const maxInternedNames = 1024
+
+type Decoder struct {
+	nb bv.ByteView
+
+	// name is the buffer the owner and RDATA names are decoded
+	// into, the decoded names are interned in names, so the repeated
+	// names (of the RRset or of the same queries) share a string.
+	name  []byte
+	names map[string]string
+}
 
 func NewDecoder() *Decoder {
 	return &Decoder{}
 }
 
+var decoders = sync.Pool{
+	New: func() any {
+		return NewDecoder()
+	},
+}
+
+// AcquireDecoder returns a Decoder from the pool, the decoder
+// must be returned by ReleaseDecoder when it is no longer used.
+func AcquireDecoder() *Decoder {
+	return decoders.Get().(*Decoder)
+}
+
+// ReleaseDecoder returns the decoder to the pool, the messages
+// decoded by the decoder are still valid after release.
+func ReleaseDecoder(dec *Decoder) {
+	decoders.Put(dec)
+}
+
+// Decode decodes message "in", the errors of malformed messages
+// are *FormatError, they wrap ErrTruncated, ErrPointerLoop,
+// ErrNameTooLong and the other errors of the package.
 func (dec *Decoder) Decode(in []byte) (Message, error) {
-	buf := bv.NewByteView(in)
+	dec.nb.Reset(in)
+	defer dec.nb.Reset(nil)
+
+	m, err := dec.decode(&dec.nb)
+	if err != nil {
+		return Message{}, &FormatError{Err: truncated(err)}
+	}
+
+	return m, nil
+}
+
+func (dec *Decoder) decode(buf *bv.ByteView) (Message, error) {
 
 	var err error
 	var header Header
@@ -40,6 +85,9 @@ func (dec *Decoder) Decode(in []byte) (Message, error) {
 	header.TruncateCation = (flagsH & 0b00000010) != 0
 	header.RecursionDesired = (flagsH & 0b00000001) != 0
 	header.RecursionAvailable = (flagsL & 0b10000000) != 0
+	header.Z = (flagsL & 0b01000000) >> 6
+	header.AuthenticData = (flagsL & 0b00100000) != 0
+	header.CheckingDisabled = (flagsL & 0b00010000) != 0
 	header.RCode = RCode(flagsL & 0b00001111)
 
 	header.QDCount, err = buf.TakeUint16()
@@ -62,22 +110,27 @@ func (dec *Decoder) Decode(in []byte) (Message, error) {
 		return Message{}, err
 	}
 
-	questions, err := parseQuestion(buf, int(header.QDCount))
+	questions, err := dec.decodeQuestions(buf, int(header.QDCount))
 	if err != nil {
 		return Message{}, err
 	}
 
-	answers, err := decodeResourceRecords(buf, int(header.ANCount))
+	answers, err := dec.decodeResourceRecords(buf, int(header.ANCount))
 	if err != nil {
 		return Message{}, err
 	}
 
-	authorities, err := decodeResourceRecords(buf, int(header.NSCount))
+	authorities, err := dec.decodeResourceRecords(buf, int(header.NSCount))
 	if err != nil {
 		return Message{}, err
 	}
 
-	additional, err := decodeResourceRecords(buf, int(header.ARCount))
+	additional, err := dec.decodeResourceRecords(buf, int(header.ARCount))
+	if err != nil {
+		return Message{}, err
+	}
+
+	additional, edns, err := extractEDNS(additional)
 	if err != nil {
 		return Message{}, err
 	}
@@ -88,14 +141,37 @@ func (dec *Decoder) Decode(in []byte) (Message, error) {
 		Answer:     answers,
 		Authority:  authorities,
 		Additional: additional,
+		EDNS:       edns,
 	}, nil
 }
 
-func parseQuestion(nb *bv.ByteView, n int) ([]Question, error) {
+// The minimal sizes of a question (root name, type and class) and
+// of a record (root name, type, class, TTL and RDLENGTH).
+const (
+	minQuestionSize = 1 + 2 + 2
+	minRecordSize   = 1 + 2 + 2 + 4 + 2
+)
+
+// checkCount checks that "n" entries of "size" octets at least fit
+// into the rest of message, so the forged counts of the header do
+// not cause allocations of huge slices.
+func checkCount(nb *bv.ByteView, n int, size int, section string) error {
+	if rest := nb.Len() - int(nb.Pos()); n*size > rest {
+		return fmt.Errorf("%w: %d %s entries announced, but %d octets left", ErrTruncated, n, section, rest)
+	}
+
+	return nil
+}
+
+func (dec *Decoder) decodeQuestions(nb *bv.ByteView, n int) ([]Question, error) {
+	if err := checkCount(nb, n, minQuestionSize, "question"); err != nil {
+		return nil, err
+	}
+
 	out := make([]Question, 0, n)
 
 	for i := 0; i < n; i++ {
-		qName, err := decodeName(nb)
+		qName, err := dec.decodeName(nb)
 		if err != nil {
 			return nil, err
 		}
@@ -120,11 +196,15 @@ func parseQuestion(nb *bv.ByteView, n int) ([]Question, error) {
 	return out, nil
 }
 
-func decodeResourceRecords(nb *bv.ByteView, n int) ([]ResourceRecord, error) {
+func (dec *Decoder) decodeResourceRecords(nb *bv.ByteView, n int) ([]ResourceRecord, error) {
+	if err := checkCount(nb, n, minRecordSize, "record"); err != nil {
+		return nil, err
+	}
+
 	out := make([]ResourceRecord, 0, n)
 
 	for i := 0; i < n; i++ {
-		record, err := decodeResourceRecord(nb)
+		record, err := dec.decodeResourceRecord(nb)
 		if err != nil {
 			return out, err
 		}
@@ -135,8 +215,8 @@ func decodeResourceRecords(nb *bv.ByteView, n int) ([]ResourceRecord, error) {
 	return out, nil
 }
 
-func decodeResourceRecord(nb *bv.ByteView) (ResourceRecord, error) {
-	name, err := decodeName(nb)
+func (dec *Decoder) decodeResourceRecord(nb *bv.ByteView) (ResourceRecord, error) {
+	name, err := dec.decodeName(nb)
 	if err != nil {
 		return ResourceRecord{}, err
 	}
@@ -161,11 +241,24 @@ func decodeResourceRecord(nb *bv.ByteView) (ResourceRecord, error) {
 		return ResourceRecord{}, err
 	}
 
-	rData, err := decodeResourceData(nb, QType(queryType), rdLength)
+	start := nb.Pos()
+
+	if rest := uint(nb.Len()) - start; uint(rdLength) > rest {
+		return ResourceRecord{}, fmt.Errorf("%w: %v record rdata length is %d, but %d octets left", ErrTruncated, QType(queryType), rdLength, rest)
+	}
+
+	rData, err := dec.decodeResourceData(nb, QType(queryType), rdLength)
 	if err != nil {
 		return ResourceRecord{}, err
 	}
 
+	// The RDATA of known types is parsed field by field, it must
+	// take exactly RDLENGTH bytes, otherwise the rest of the message
+	// would be read from a wrong position.
+	if consumed := nb.Pos() - start; consumed != uint(rdLength) {
+		return ResourceRecord{}, fmt.Errorf("%w: %v record rdata length is %d, but %d bytes decoded", ErrRDataLength, QType(queryType), rdLength, consumed)
+	}
+
 	return ResourceRecord{
 		Name:     name,
 		Type:     QType(queryType),
@@ -176,147 +269,132 @@ func decodeResourceRecord(nb *bv.ByteView) (ResourceRecord, error) {
 	}, nil
 }
 
-func decodeResourceData(nb *bv.ByteView, queryType QType, length uint16) (string, error) {
+func (dec *Decoder) decodeResourceData(nb *bv.ByteView, queryType QType, length uint16) (RData, error) {
+	end := nb.Pos() + uint(length)
+
 	switch queryType {
 	case QTypeA:
-		addr, err := nb.TakeUint32()
+		buf, err := nb.TakeRange(nb.Pos(), 4)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
+		nb.Advance(4)
 
-		return fmt.Sprintf(
-			"%d.%d.%d.%d",
-			uint8(addr>>24),
-			uint8(addr>>16),
-			uint8(addr>>8),
-			uint8(addr>>0),
-		), nil
+		return &A{Addr: netip.AddrFrom4(*(*[4]byte)(buf))}, nil
 
 	case QTypeNS:
-		// A domain name which specifies a host which should be
-		// authoritative for the specified class and domain.
-
 		// NS records cause both the usual additional section processing to locate
 		// a type A record, and, when used in a referral, a special search of the
 		// zone in which they reside for glue information.
 
-		name, err := decodeName(nb)
+		name, err := dec.decodeName(nb)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
-		return name, nil
+		return &NS{Host: name}, nil
 
 	case QTypeMD:
-		// A <domain-name> which specifies a host which has a mail
-		// agent for the domain which should be able to deliver
-		// mail for the domain.
-
 		// MD records cause additional section processing which looks
 		// up an A type record corresponding to MADNAME.
 
-		// MD is obsolete.
-
-		name, err := decodeName(nb)
+		name, err := dec.decodeName(nb)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
-		return name, nil
+		return &MD{Host: name}, nil
 
 	case QTypeMF:
-		// A <domain-name> which specifies a host which has a mail
-		// agent for the domain which will accept mail for
-		// forwarding to the domain.
-
-		// MF is obsolete.
-
-		name, err := decodeName(nb)
+		name, err := dec.decodeName(nb)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
-		return name, nil
+		return &MF{Host: name}, nil
 
 	case QTypeCName:
-		// A domain name which specifies the canonical or primary
-		// name for the owner. The owner name is an alias.
-		cname, err := decodeName(nb)
+		cname, err := dec.decodeName(nb)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		return cname, nil
+
+		return &CNAME{Target: cname}, nil
 
 	case QTypeSOA:
-		buf, err := nb.TakeRange(nb.Pos(), uint(length))
+		mName, err := dec.decodeName(nb)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
-		return string(buf), nil
+		rName, err := dec.decodeName(nb)
+		if err != nil {
+			return nil, err
+		}
 
-	case QTypeMB:
-		// A <domain-name> which specifies a host which has the
-		// specified mailbox.
+		var counters [5]uint32
+		for i := range counters {
+			counters[i], err = nb.TakeUint32()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return &SOA{
+			MName:   mName,
+			RName:   rName,
+			Serial:  counters[0],
+			Refresh: counters[1],
+			Retry:   counters[2],
+			Expire:  counters[3],
+			Minimum: counters[4],
+		}, nil
 
-		name, err := decodeName(nb)
+	case QTypeMB:
+		name, err := dec.decodeName(nb)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		return name, nil
+
+		return &MB{Host: name}, nil
 
 	case QTypeMG:
-		// A <domain-name> which specifies a mailbox which is a
-		// member of the mail group specified by the domain name.
-		name, err := decodeName(nb)
+		name, err := dec.decodeName(nb)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		return name, nil
+
+		return &MG{Mailbox: name}, nil
 
 	case QTypeMR:
-		// A <domain-name> which specifies a mailbox which is the
-		// proper rename of the specified mailbox.
-		name, err := decodeName(nb)
+		name, err := dec.decodeName(nb)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		return name, nil
 
-	case QTypeNULL:
-		// Anything at all may be in the RDATA field so long as it
-		// is 65535 octets or less.
+		return &MR{Mailbox: name}, nil
 
+	case QTypeNULL:
 		// NULL records cause no additional section processing.  NULL RRs are not
 		// allowed in master files.  NULLs are used as placeholders in some
 		// experimental extensions of the DNS.
 
-		bts, err := nb.TakeRange(nb.Pos(), uint(length))
+		data, err := decodeOpaque(nb, length)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
-		return string(bts), err
-
-	case QTypeWKS:
+		return &NULL{Data: data}, nil
 
 	case QTypePTR:
-		// A domain name which points to some location in the
-		// domain name space.
-		name, err := decodeName(nb)
+		name, err := dec.decodeName(nb)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
-		return name, nil
+		return &PTR{Name: name}, nil
 
 	case QTypeHINFO:
-		// CPU A <character-string> which specifies the CPU type.
-		// OS A <character-string> which specifies the operating
-		// system type.
-
-		// Standard values for CPU and OS can be found in [RFC-1010].
-		//
 		// HINFO records are used to acquire general information
 		// about a host. The main use is for protocols such as FTP
 		// that can use special procedures when talking between
@@ -324,40 +402,428 @@ func decodeResourceData(nb *bv.ByteView, queryType QType, length uint16) (string
 
 		cpu, err := decodeCharacterString(nb)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		os, err := decodeCharacterString(nb)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
-		// todo: must ensure that "|" does not occur at the cpu and the os parts.
-		return cpu + "|" + os, nil
+		return &HINFO{CPU: cpu, OS: os}, nil
 
 	case QTypeMINFO:
+		rMailBx, err := dec.decodeName(nb)
+		if err != nil {
+			return nil, err
+		}
+
+		eMailBx, err := dec.decodeName(nb)
+		if err != nil {
+			return nil, err
+		}
+
+		return &MINFO{RMailBx: rMailBx, EMailBx: eMailBx}, nil
+
 	case QTypeMX:
+		preference, err := nb.TakeUint16()
+		if err != nil {
+			return nil, err
+		}
+
+		exchange, err := dec.decodeName(nb)
+		if err != nil {
+			return nil, err
+		}
+
+		return &MX{Preference: preference, Exchange: exchange}, nil
+
 	case QTypeTXT:
+		// One or more <character-string>s, the number of strings
+		// is defined only by the RDLENGTH field.
+
+		var data []string
+		for nb.Pos() < end {
+			s, err := decodeCharacterString(nb)
+			if err != nil {
+				return nil, err
+			}
+
+			data = append(data, s)
+		}
+
+		if nb.Pos() != end {
+			return nil, fmt.Errorf("txt character strings overrun rdata by %d bytes", nb.Pos()-end)
+		}
+
+		return &TXT{Data: data}, nil
 
 	case QTypeAAAA:
 		// 128 bit IPv6 address is encoded in the data portion of an AAAA
 		// resource record in network byte order (high-order byte first).
 
-		bts, err := nb.TakeRange(nb.Pos(), 16)
+		buf, err := nb.TakeRange(nb.Pos(), 16)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
+		nb.Advance(16)
 
-		hx := ""
-		for i, b := range bts {
-			if i%2 == 0 && i != 0 {
-				hx += ":"
+		return &AAAA{Addr: netip.AddrFrom16(*(*[16]byte)(buf))}, nil
+
+	case QTypeLOC:
+		var err error
+
+		var precision [4]byte
+		for i := range precision {
+			precision[i], err = nb.Take()
+			if err != nil {
+				return nil, err
 			}
-			hx += fmt.Sprintf("%02x", b)
 		}
-		nb.Advance(16)
 
-		return hx, nil
+		var coordinates [3]uint32
+		for i := range coordinates {
+			coordinates[i], err = nb.TakeUint32()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return &LOC{
+			Version:   precision[0],
+			Size:      precision[1],
+			HorizPre:  precision[2],
+			VertPre:   precision[3],
+			Latitude:  coordinates[0],
+			Longitude: coordinates[1],
+			Altitude:  coordinates[2],
+		}, nil
+
+	case QTypeSRV:
+		var err error
+
+		var fields [3]uint16
+		for i := range fields {
+			fields[i], err = nb.TakeUint16()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		target, err := dec.decodeName(nb)
+		if err != nil {
+			return nil, err
+		}
+
+		return &SRV{
+			Priority: fields[0],
+			Weight:   fields[1],
+			Port:     fields[2],
+			Target:   target,
+		}, nil
+
+	case QTypeNAPTR:
+		order, err := nb.TakeUint16()
+		if err != nil {
+			return nil, err
+		}
+
+		preference, err := nb.TakeUint16()
+		if err != nil {
+			return nil, err
+		}
+
+		var strs [3]string
+		for i := range strs {
+			strs[i], err = decodeCharacterString(nb)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		replacement, err := dec.decodeName(nb)
+		if err != nil {
+			return nil, err
+		}
+
+		return &NAPTR{
+			Order:       order,
+			Preference:  preference,
+			Flags:       strs[0],
+			Services:    strs[1],
+			Regexp:      strs[2],
+			Replacement: replacement,
+		}, nil
+
+	case QTypeSSHFP:
+		algorithm, err := nb.Take()
+		if err != nil {
+			return nil, err
+		}
+
+		fpType, err := nb.Take()
+		if err != nil {
+			return nil, err
+		}
+
+		fingerprint, err := decodeRest(nb, end)
+		if err != nil {
+			return nil, err
+		}
+
+		return &SSHFP{Algorithm: algorithm, FPType: fpType, Fingerprint: fingerprint}, nil
+
+	case QTypeTLSA:
+		var err error
+
+		var fields [3]uint8
+		for i := range fields {
+			fields[i], err = nb.Take()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		data, err := decodeRest(nb, end)
+		if err != nil {
+			return nil, err
+		}
+
+		return &TLSA{
+			Usage:                      fields[0],
+			Selector:                   fields[1],
+			MatchingType:               fields[2],
+			CertificateAssociationData: data,
+		}, nil
+
+	case QTypeURI:
+		priority, err := nb.TakeUint16()
+		if err != nil {
+			return nil, err
+		}
+
+		weight, err := nb.TakeUint16()
+		if err != nil {
+			return nil, err
+		}
+
+		target, err := decodeRest(nb, end)
+		if err != nil {
+			return nil, err
+		}
+
+		return &URI{Priority: priority, Weight: weight, Target: string(target)}, nil
+
+	case QTypeCAA:
+		flags, err := nb.Take()
+		if err != nil {
+			return nil, err
+		}
+
+		tag, err := decodeCharacterString(nb)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := decodeRest(nb, end)
+		if err != nil {
+			return nil, err
+		}
+
+		return &CAA{Flags: flags, Tag: tag, Value: string(value)}, nil
+
+	case QTypeSVCB:
+		return dec.decodeSVCB(nb, end)
+
+	case QTypeHTTPS:
+		svcb, err := dec.decodeSVCB(nb, end)
+		if err != nil {
+			return nil, err
+		}
+
+		return &HTTPS{SVCB: *svcb}, nil
+
+	case QTypeDS:
+		keyTag, err := nb.TakeUint16()
+		if err != nil {
+			return nil, err
+		}
+
+		var fields [2]uint8
+		for i := range fields {
+			fields[i], err = nb.Take()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		digest, err := decodeRest(nb, end)
+		if err != nil {
+			return nil, err
+		}
+
+		return &DS{KeyTag: keyTag, Algorithm: fields[0], DigestType: fields[1], Digest: digest}, nil
+
+	case QTypeDNSKEY:
+		flags, err := nb.TakeUint16()
+		if err != nil {
+			return nil, err
+		}
+
+		var fields [2]uint8
+		for i := range fields {
+			fields[i], err = nb.Take()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		publicKey, err := decodeRest(nb, end)
+		if err != nil {
+			return nil, err
+		}
+
+		return &DNSKEY{Flags: flags, Protocol: fields[0], Algorithm: fields[1], PublicKey: publicKey}, nil
+
+	case QTypeRRSIG:
+		typeCovered, err := nb.TakeUint16()
+		if err != nil {
+			return nil, err
+		}
+
+		var fields [2]uint8
+		for i := range fields {
+			fields[i], err = nb.Take()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var times [3]uint32
+		for i := range times {
+			times[i], err = nb.TakeUint32()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		keyTag, err := nb.TakeUint16()
+		if err != nil {
+			return nil, err
+		}
+
+		signerName, err := dec.decodeName(nb)
+		if err != nil {
+			return nil, err
+		}
+
+		signature, err := decodeRest(nb, end)
+		if err != nil {
+			return nil, err
+		}
+
+		return &RRSIG{
+			TypeCovered: QType(typeCovered),
+			Algorithm:   fields[0],
+			Labels:      fields[1],
+			OriginalTTL: times[0],
+			Expiration:  times[1],
+			Inception:   times[2],
+			KeyTag:      keyTag,
+			SignerName:  signerName,
+			Signature:   signature,
+		}, nil
+
+	case QTypeNSEC:
+		nextDomain, err := dec.decodeName(nb)
+		if err != nil {
+			return nil, err
+		}
+
+		types, err := decodeTypeBitMaps(nb, end)
+		if err != nil {
+			return nil, err
+		}
+
+		return &NSEC{NextDomain: nextDomain, Types: types}, nil
+
+	case QTypeNSEC3:
+		var err error
+
+		var fields [2]uint8
+		for i := range fields {
+			fields[i], err = nb.Take()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		iterations, err := nb.TakeUint16()
+		if err != nil {
+			return nil, err
+		}
+
+		salt, err := decodeSalt(nb)
+		if err != nil {
+			return nil, err
+		}
+
+		// The hash length field has the same format as the salt
+		// length one.
+		nextHashedOwner, err := decodeSalt(nb)
+		if err != nil {
+			return nil, err
+		}
+
+		types, err := decodeTypeBitMaps(nb, end)
+		if err != nil {
+			return nil, err
+		}
+
+		return &NSEC3{
+			HashAlgorithm:   fields[0],
+			Flags:           fields[1],
+			Iterations:      iterations,
+			Salt:            salt,
+			NextHashedOwner: nextHashedOwner,
+			Types:           types,
+		}, nil
+
+	case QTypeNSEC3PARAM:
+		var err error
+
+		var fields [2]uint8
+		for i := range fields {
+			fields[i], err = nb.Take()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		iterations, err := nb.TakeUint16()
+		if err != nil {
+			return nil, err
+		}
+
+		salt, err := decodeSalt(nb)
+		if err != nil {
+			return nil, err
+		}
+
+		return &NSEC3PARAM{
+			HashAlgorithm: fields[0],
+			Flags:         fields[1],
+			Iterations:    iterations,
+			Salt:          salt,
+		}, nil
+
+	case QTypeOPT:
+		options, err := decodeEDNSOptions(nb, length)
+		if err != nil {
+			return nil, err
+		}
+
+		return &OPT{Options: options}, nil
 
 	case QTypeAXFR:
 	case QTypeMAILB:
@@ -366,13 +832,63 @@ func decodeResourceData(nb *bv.ByteView, queryType QType, length uint16) (string
 		// todo: how to handle a request for all records?
 	}
 
+	data, err := decodeOpaque(nb, length)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Unknown{T: queryType, Data: data}, nil
+}
+
+// decodeRest returns a copy of the rest of RDATA that
+// ends at position "end".
+func decodeRest(nb *bv.ByteView, end uint) ([]byte, error) {
+	if nb.Pos() > end {
+		return nil, fmt.Errorf("rdata overrun by %d bytes", nb.Pos()-end)
+	}
+
+	return decodeOpaque(nb, uint16(end-nb.Pos()))
+}
+
+// decodeOpaque returns a copy of the next "length" bytes of the
+// buffer. The copy is required because the data outlives the
+// buffer that the message was read into.
+func decodeOpaque(nb *bv.ByteView, length uint16) ([]byte, error) {
 	buf, err := nb.TakeRange(nb.Pos(), uint(length))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	nb.Advance(uint(length))
 
-	return string(buf), nil
+	out := make([]byte, len(buf))
+	copy(out, buf)
+
+	return out, nil
+}
+
+// decodeName decodes the name into the reusable buffer of
+// the decoder and returns the interned string of the name.
+func (dec *Decoder) decodeName(nb *bv.ByteView) (string, error) {
+	var err error
+
+	dec.name, err = appendName(dec.name[:0], nb)
+	if err != nil {
+		return "", err
+	}
+
+	// The conversion in the map index expression does not allocate.
+	if name, ok := dec.names[string(dec.name)]; ok {
+		return name, nil
+	}
+
+	if dec.names == nil || len(dec.names) >= maxInternedNames {
+		dec.names = make(map[string]string)
+	}
+
+	name := string(dec.name)
+	dec.names[name] = name
+
+	return name, nil
 }
 
 // decodeName ...
@@ -380,67 +896,100 @@ func decodeResourceData(nb *bv.ByteView, queryType QType, length uint16) (string
 // <domain-name> is a domain name represented as a series of labels, and
 // terminated by a label with zero length.
 func decodeName(nb *bv.ByteView) (string, error) {
+	var buf [limits.MaxNameSize]byte
+
+	name, err := appendName(buf[:0], nb)
+	if err != nil {
+		return "", err
+	}
+
+	return string(name), nil
+}
+
+// appendName appends the dotted name to "dst" and returns the
+// extended buffer, the labels are copied without intermediate strings.
+func appendName(dst []byte, nb *bv.ByteView) ([]byte, error) {
 	pos := nb.Pos()
 
+	// Every pointer must point strictly before the previous pointer
+	// target (or before the name for the first pointer), so a name
+	// cannot contain loops and the decoding always terminates.
+	limit := pos
 	jumped := false
-	maxJumps := 5
-	jumpsPerformed := 0
 
-	delim := ""
-	out := ""
+	// The length of the name in the wire format, including
+	// length octets and the terminating root label.
+	size := 0
+	delim := false
 
 	for {
-		if jumpsPerformed > maxJumps {
-			return "", errors.New("jumps limit reached")
-		}
-
 		length, err := nb.Index(pos)
 		if err != nil {
-			return "", err
+			return dst, err
 		}
 
-		if length&0xc0 == 0xc0 {
+		switch length & 0xc0 {
+		case 0xc0:
+			b2, err := nb.Index(pos + 1)
+			if err != nil {
+				return dst, err
+			}
+
 			if !jumped {
 				nb.Seek(pos + 2)
 			}
 
-			b2, err := nb.Index(pos + 1)
-			if err != nil {
-				return "", err
+			target := uint(length&0x3f)<<8 | uint(b2)
+			if target >= pos {
+				return dst, fmt.Errorf("%w: pointer at %d to %d", ErrForwardPointer, pos, target)
+			}
+			if target >= limit {
+				return dst, fmt.Errorf("%w: pointer at %d to %d", ErrPointerLoop, pos, target)
 			}
 
-			offset := (uint16(length^0xc0) << 8) | uint16(b2)
-			pos = uint(offset)
-
+			pos, limit = target, target
 			jumped = true
-			jumpsPerformed++
 
 			continue
-		} else {
-			pos++
 
-			if length == 0 {
-				break
-			}
+		case 0x00:
+			// Ordinary label.
 
-			out += delim
-			part, err := nb.TakeRange(pos, uint(length))
-			if err != nil {
-				return "", err
-			}
+		default:
+			return dst, fmt.Errorf("%w: length octet 0x%02x at %d", ErrLabelType, length, pos)
+		}
 
-			out += string(part)
+		pos++
 
-			delim = "."
-			pos += uint(length)
+		size += 1 + int(length)
+		if size > limits.MaxNameSize {
+			return dst, fmt.Errorf("%w: more than %d octets", ErrNameTooLong, limits.MaxNameSize)
 		}
+
+		if length == 0 {
+			break
+		}
+
+		if delim {
+			dst = append(dst, '.')
+		}
+		delim = true
+
+		part, err := nb.TakeRange(pos, uint(length))
+		if err != nil {
+			return dst, err
+		}
+
+		dst = append(dst, part...)
+
+		pos += uint(length)
 	}
 
 	if !jumped {
 		nb.Seek(pos)
 	}
 
-	return out, nil
+	return dst, nil
 }
 
 // decodeCharacterString ...
@@ -459,6 +1008,7 @@ func decodeCharacterString(nb *bv.ByteView) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	nb.Advance(uint(length))
 
 	return string(buf), nil
 }
@@ -0,0 +1,385 @@
+package proto
+
+import (
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rokkerruslan/dnska/pkg/bv"
+)
+
+// Reference - https://datatracker.ietf.org/doc/html/rfc4034
+// Reference - https://datatracker.ietf.org/doc/html/rfc5155
+
+// DNSKEY stores public key that a resolver can use to verify
+// RRSIG records.
+type DNSKEY struct {
+	// Flags has bit 7 as the Zone Key flag and bit 15 as
+	// the Secure Entry Point flag, e.g. 256 for ZSK and 257
+	// for KSK.
+	Flags uint16
+
+	// Protocol field MUST have value 3.
+	Protocol uint8
+
+	// Algorithm identifies the public key's cryptographic
+	// algorithm and determines the format of the PublicKey.
+	Algorithm uint8
+
+	PublicKey []byte
+}
+
+func (rd *DNSKEY) Type() QType { return QTypeDNSKEY }
+
+func (rd *DNSKEY) String() string {
+	return fmt.Sprintf("%d %d %d %s", rd.Flags, rd.Protocol, rd.Algorithm, base64.StdEncoding.EncodeToString(rd.PublicKey))
+}
+
+// KeyTag calculates the key tag (RFC 4034 Appendix B) of the key,
+// the value is used by RRSIG and DS records to select the key.
+func (rd *DNSKEY) KeyTag() uint16 {
+	rData := make([]byte, 0, 4+len(rd.PublicKey))
+	rData = append(rData, byte(rd.Flags>>8), byte(rd.Flags), rd.Protocol, rd.Algorithm)
+	rData = append(rData, rd.PublicKey...)
+
+	// The key tag of the obsolete RSA/MD5 algorithm is the most
+	// significant 16 bits of the least significant 24 bits of
+	// the public key modulus.
+	if rd.Algorithm == 1 {
+		if len(rd.PublicKey) < 3 {
+			return 0
+		}
+
+		return uint16(rData[len(rData)-3])<<8 | uint16(rData[len(rData)-2])
+	}
+
+	var ac uint32
+	for i, b := range rData {
+		if i&1 == 1 {
+			ac += uint32(b)
+		} else {
+			ac += uint32(b) << 8
+		}
+	}
+	ac += ac >> 16 & 0xffff
+
+	return uint16(ac & 0xffff)
+}
+
+// RRSIG stores digital signature of an RRset.
+type RRSIG struct {
+	// TypeCovered identifies the type of the RRset that
+	// is covered by this RRSIG record.
+	TypeCovered QType
+
+	// Algorithm identifies the cryptographic algorithm used
+	// to create the signature.
+	Algorithm uint8
+
+	// Labels specifies the number of labels in the original
+	// RRSIG RR owner name, it's used to detect wildcards.
+	Labels uint8
+
+	// OriginalTTL is the TTL of the covered RRset as it appears
+	// in the authoritative zone.
+	OriginalTTL uint32
+
+	// Expiration and Inception specify a validity period for the
+	// signature, in number of seconds since 1 January 1970 00:00:00
+	// UTC, using serial number arithmetic.
+	Expiration uint32
+	Inception  uint32
+
+	// KeyTag contains the key tag value of the DNSKEY RR that
+	// validates this signature.
+	KeyTag uint16
+
+	// SignerName identifies the owner name of the DNSKEY RR that
+	// a validator is supposed to use to validate this signature.
+	// A sender MUST NOT use DNS name compression on the field.
+	SignerName string
+
+	Signature []byte
+}
+
+func (rd *RRSIG) Type() QType { return QTypeRRSIG }
+
+func (rd *RRSIG) String() string {
+	return fmt.Sprintf("%s %d %d %d %s %s %d %s %s",
+		typeMnemonic(rd.TypeCovered), rd.Algorithm, rd.Labels, rd.OriginalTTL,
+		signatureTime(rd.Expiration), signatureTime(rd.Inception), rd.KeyTag,
+		fqdn(rd.SignerName), base64.StdEncoding.EncodeToString(rd.Signature))
+}
+
+// DS refers to a DNSKEY RR of the delegated zone, it's stored
+// in the parent zone.
+type DS struct {
+	KeyTag    uint16
+	Algorithm uint8
+
+	// DigestType identifies the algorithm used to construct
+	// the digest: 1 - SHA-1, 2 - SHA-256, 4 - SHA-384.
+	DigestType uint8
+
+	Digest []byte
+}
+
+func (rd *DS) Type() QType { return QTypeDS }
+
+func (rd *DS) String() string {
+	return fmt.Sprintf("%d %d %d %X", rd.KeyTag, rd.Algorithm, rd.DigestType, rd.Digest)
+}
+
+// NSEC lists the next owner name (in the canonical ordering of
+// the zone) that contains authoritative data and the set of RR
+// types present at the NSEC RR's owner name.
+type NSEC struct {
+	// NextDomain is the next owner name, it's not compressed.
+	NextDomain string
+
+	Types []QType
+}
+
+func (rd *NSEC) Type() QType { return QTypeNSEC }
+
+func (rd *NSEC) String() string {
+	return strings.TrimSuffix(fqdn(rd.NextDomain)+" "+typeList(rd.Types), " ")
+}
+
+// NSEC3 provides authenticated denial of existence with hashed
+// owner names.
+type NSEC3 struct {
+	// HashAlgorithm identifies the cryptographic hash algorithm,
+	// the only defined value is 1 - SHA-1.
+	HashAlgorithm uint8
+
+	// Flags contains 8 one-bit flags, the only defined flag is
+	// the Opt-Out flag (bit 7).
+	Flags uint8
+
+	// Iterations defines the number of additional times the
+	// hash function has been performed.
+	Iterations uint16
+
+	Salt []byte
+
+	// NextHashedOwner contains the next hashed owner name in hash
+	// order. The value is in binary format and is not a name.
+	NextHashedOwner []byte
+
+	Types []QType
+}
+
+func (rd *NSEC3) Type() QType { return QTypeNSEC3 }
+
+func (rd *NSEC3) String() string {
+	s := fmt.Sprintf("%d %d %d %s %s %s",
+		rd.HashAlgorithm, rd.Flags, rd.Iterations, saltString(rd.Salt),
+		base32HexNoPadding.EncodeToString(rd.NextHashedOwner), typeList(rd.Types))
+
+	return strings.TrimSuffix(s, " ")
+}
+
+// NSEC3PARAM contains the NSEC3 parameters needed by authoritative
+// servers to calculate hashed owner names.
+type NSEC3PARAM struct {
+	HashAlgorithm uint8
+	Flags         uint8
+	Iterations    uint16
+	Salt          []byte
+}
+
+func (rd *NSEC3PARAM) Type() QType { return QTypeNSEC3PARAM }
+
+func (rd *NSEC3PARAM) String() string {
+	return fmt.Sprintf("%d %d %d %s", rd.HashAlgorithm, rd.Flags, rd.Iterations, saltString(rd.Salt))
+}
+
+var base32HexNoPadding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// NSEC3Hash calculates hashed owner name (RFC 5155 section 5)
+// of name "name" with SHA-1 hash algorithm:
+//
+//	IH(salt, x, 0) = H(x || salt)
+//	IH(salt, x, k) = H(IH(salt, x, k-1) || salt), if k > 0
+//
+// where x is the name in canonical wire format.
+func NSEC3Hash(name string, hashAlgorithm uint8, iterations uint16, salt []byte) ([]byte, error) {
+	if hashAlgorithm != 1 {
+		return nil, fmt.Errorf("unsupported nsec3 hash algorithm %d", hashAlgorithm)
+	}
+
+	x, err := canonicalName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha1.Sum(append(x, salt...))
+	for i := 0; i < int(iterations); i++ {
+		h = sha1.Sum(append(h[:], salt...))
+	}
+
+	return h[:], nil
+}
+
+func typeList(types []QType) string {
+	parts := make([]string, 0, len(types))
+	for _, el := range types {
+		parts = append(parts, typeMnemonic(el))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func saltString(salt []byte) string {
+	if len(salt) == 0 {
+		return "-"
+	}
+
+	return fmt.Sprintf("%X", salt)
+}
+
+func signatureTime(v uint32) string {
+	return time.Unix(int64(v), 0).UTC().Format("20060102150405")
+}
+
+// Type Bit Maps Field (RFC 4034 section 4.1.2)
+//
+// The RR type space is split into 256 window blocks, each
+// representing the low-order 8 bits of the 16-bit RR type space.
+// Each block that has at least one active RR type is encoded using
+// a single octet window number (from 0 to 255), a single octet
+// bitmap length (from 1 to 32) indicating the number of octets used
+// for the window block's bitmap, and up to 32 octets (256 bits) of
+// bitmap.
+//
+//	Type Bit Maps Field = ( Window Block # | Bitmap Length | Bitmap )+
+
+func decodeTypeBitMaps(nb *bv.ByteView, end uint) ([]QType, error) {
+	var out []QType
+
+	prev := -1
+	for nb.Pos() < end {
+		window, err := nb.Take()
+		if err != nil {
+			return nil, err
+		}
+
+		if int(window) <= prev {
+			return nil, fmt.Errorf("type bitmap window %d is out of order", window)
+		}
+		prev = int(window)
+
+		length, err := nb.Take()
+		if err != nil {
+			return nil, err
+		}
+
+		if length == 0 || length > 32 || nb.Pos()+uint(length) > end {
+			return nil, fmt.Errorf("invalid type bitmap length %d", length)
+		}
+
+		bitmap, err := nb.TakeRange(nb.Pos(), uint(length))
+		if err != nil {
+			return nil, err
+		}
+		nb.Advance(uint(length))
+
+		for i, b := range bitmap {
+			for bit := 0; bit < 8; bit++ {
+				if b&(0x80>>bit) != 0 {
+					out = append(out, QType(uint16(window)<<8|uint16(i*8+bit)))
+				}
+			}
+		}
+	}
+
+	return out, nil
+}
+
+func encodeTypeBitMaps(nb *bv.ByteView, types []QType) error {
+	sorted := make([]QType, len(types))
+	copy(sorted, types)
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	for i := 0; i < len(sorted); {
+		window := uint8(sorted[i] >> 8)
+
+		var bitmap [32]byte
+		length := 0
+
+		for ; i < len(sorted) && uint8(sorted[i]>>8) == window; i++ {
+			low := uint8(sorted[i])
+
+			bitmap[low/8] |= 0x80 >> (low % 8)
+			length = int(low/8) + 1
+		}
+
+		if err := nb.PutUint8(window); err != nil {
+			return err
+		}
+
+		if err := nb.PutUint8(uint8(length)); err != nil {
+			return err
+		}
+
+		if err := encodeOpaque(nb, bitmap[:length]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeSalt(nb *bv.ByteView) ([]byte, error) {
+	length, err := nb.Take()
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeOpaque(nb, uint16(length))
+}
+
+func encodeSalt(nb *bv.ByteView, salt []byte) error {
+	if len(salt) > 255 {
+		return errors.New("salt is too long")
+	}
+
+	if err := nb.PutUint8(uint8(len(salt))); err != nil {
+		return err
+	}
+
+	return encodeOpaque(nb, salt)
+}
+
+// encodeRRSIGHeader encodes all the RRSIG RDATA fields
+// except the Signature field.
+func encodeRRSIGHeader(nb *bv.ByteView, index *labelsIndex, rd *RRSIG) error {
+	if err := nb.PutUint16(uint16(rd.TypeCovered)); err != nil {
+		return err
+	}
+
+	for _, v := range []uint8{rd.Algorithm, rd.Labels} {
+		if err := nb.PutUint8(v); err != nil {
+			return err
+		}
+	}
+
+	for _, v := range []uint32{rd.OriginalTTL, rd.Expiration, rd.Inception} {
+		if err := nb.PutUint32(v); err != nil {
+			return err
+		}
+	}
+
+	if err := nb.PutUint16(rd.KeyTag); err != nil {
+		return err
+	}
+
+	return index.EncodeNameUncompressed(nb, rd.SignerName)
+}
@@ -0,0 +1,258 @@
+package proto
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rokkerruslan/dnska/internal/limits"
+	"github.com/rokkerruslan/dnska/pkg/bv"
+)
+
+// Reference - https://datatracker.ietf.org/doc/html/rfc6891
+
+// EDNS represents the OPT pseudo-record of the Extension
+// Mechanisms for DNS (EDNS(0)).
+//
+// An OPT RR has a fixed part and a variable set of options expressed as
+// {attribute, value} pairs. The fixed part holds some DNS metadata, and
+// also a small collection of basic extension elements that we expect to
+// be so popular that it would be a waste of wire space to encode them as
+// {attribute, value} pairs.
+//
+// The OPT record lives in the additional section of a message, but the
+// decoder moves it out of Message.Additional into Message.EDNS and the
+// encoder puts it back as the last record of the section.
+//
+// The fixed part of an OPT RR is structured as follows:
+//
+//	+------------+--------------+------------------------------+
+//	| Field Name | Field Type   | Description                  |
+//	+------------+--------------+------------------------------+
+//	| NAME       | domain name  | MUST be 0 (root domain)      |
+//	| TYPE       | u_int16_t    | OPT (41)                     |
+//	| CLASS      | u_int16_t    | requestor's UDP payload size |
+//	| TTL        | u_int32_t    | extended RCODE and flags     |
+//	| RDLEN      | u_int16_t    | length of all RDATA          |
+//	| RDATA      | octet stream | {attribute,value} pairs      |
+//	+------------+--------------+------------------------------+
+type EDNS struct {
+	// UDPPayloadSize is the number of octets of the largest UDP
+	// payload that can be reassembled and delivered in the
+	// requestor's network stack. Values lower than 512 MUST be
+	// treated as equal to 512.
+	UDPPayloadSize uint16
+
+	// ExtendedRCode forms the upper 8 bits of extended 12-bit RCODE
+	// (together with the 4 bits defined in the header).
+	ExtendedRCode uint8
+
+	// Version indicates the implementation level of the setter.
+	// Full conformance with RFC 6891 is indicated by version "0".
+	Version uint8
+
+	// DNSSECOK (DO) bit indicates to the server that the resolver
+	// is able to accept DNSSEC security RRs (RFC 3225).
+	DNSSECOK bool
+
+	// Z is the rest of the flags field, MUST be set to zero by
+	// senders and ignored by receivers.
+	Z uint16
+
+	Options []EDNSOption
+}
+
+// ExtendedRCode returns the full 12-bit RCODE of the message
+// built from the header RCODE and the EDNS extended part.
+func (m Message) ExtendedRCode() uint16 {
+	rcode := uint16(m.Header.RCode)
+
+	if m.EDNS != nil {
+		rcode |= uint16(m.EDNS.ExtendedRCode) << 4
+	}
+
+	return rcode
+}
+
+// UDPPayloadSize returns the size of the largest UDP payload
+// that the sender of the message is able to receive. Without
+// EDNS(0) the size is limited by 512 octets.
+func (m Message) UDPPayloadSize() int {
+	if m.EDNS == nil || m.EDNS.UDPPayloadSize < limits.UDPPayloadSizeLimit {
+		return limits.UDPPayloadSizeLimit
+	}
+
+	return int(m.EDNS.UDPPayloadSize)
+}
+
+// EDNSOptionCode is an assigned code of an EDNS option.
+type EDNSOptionCode uint16
+
+const (
+	EDNSOptionCodeNSID         EDNSOptionCode = 3
+	EDNSOptionCodeClientSubnet EDNSOptionCode = 8
+	EDNSOptionCodeExpire       EDNSOptionCode = 9
+	EDNSOptionCodeCookie       EDNSOptionCode = 10
+	EDNSOptionCodeTCPKeepalive EDNSOptionCode = 11
+	EDNSOptionCodePadding      EDNSOptionCode = 12
+)
+
+// EDNSOption is a single {attribute, value} pair of the
+// variable part of OPT record.
+//
+//	              +0 (MSB)                            +1 (LSB)
+//	   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+//	0: |                          OPTION-CODE                          |
+//	   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+//	2: |                         OPTION-LENGTH                         |
+//	   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+//	4: |                                                               |
+//	   /                          OPTION-DATA                          /
+//	   /                                                               /
+//	   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+type EDNSOption struct {
+	Code EDNSOptionCode
+	Data []byte
+}
+
+// OPT is the RDATA of OPT pseudo-record. Typically, it's
+// available only inside the Message.EDNS field.
+type OPT struct {
+	Options []EDNSOption
+}
+
+func (rd *OPT) Type() QType { return QTypeOPT }
+
+func (rd *OPT) String() string {
+	parts := make([]string, 0, len(rd.Options))
+	for _, el := range rd.Options {
+		parts = append(parts, strconv.Itoa(int(el.Code))+":"+fmt.Sprintf("%x", el.Data))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+const ednsDNSSECOKMask = 0x8000
+
+// record builds OPT pseudo-record from the EDNS fields.
+func (e *EDNS) record() ResourceRecord {
+	flags := e.Z &^ ednsDNSSECOKMask
+	if e.DNSSECOK {
+		flags |= ednsDNSSECOKMask
+	}
+
+	return ResourceRecord{
+		Name:  "",
+		Type:  QTypeOPT,
+		Class: QClass(e.UDPPayloadSize),
+		TTL:   uint32(e.ExtendedRCode)<<24 | uint32(e.Version)<<16 | uint32(flags),
+		RData: &OPT{Options: e.Options},
+	}
+}
+
+// ednsFromRecord parses fixed part of OPT pseudo-record.
+func ednsFromRecord(r ResourceRecord) (*EDNS, error) {
+	if r.Name != "" {
+		return nil, fmt.Errorf("opt record must be owned by root domain, got %q", r.Name)
+	}
+
+	opt, ok := r.RData.(*OPT)
+	if !ok {
+		return nil, fmt.Errorf("unexpected opt record data %T", r.RData)
+	}
+
+	flags := uint16(r.TTL)
+
+	return &EDNS{
+		UDPPayloadSize: uint16(r.Class),
+		ExtendedRCode:  uint8(r.TTL >> 24),
+		Version:        uint8(r.TTL >> 16),
+		DNSSECOK:       flags&ednsDNSSECOKMask != 0,
+		Z:              flags &^ ednsDNSSECOKMask,
+		Options:        opt.Options,
+	}, nil
+}
+
+// extractEDNS moves OPT pseudo-record from the additional section
+// into a separate value. If a query has more than one OPT RR, the
+// message is malformed.
+func extractEDNS(additional []ResourceRecord) ([]ResourceRecord, *EDNS, error) {
+	var edns *EDNS
+
+	out := additional[:0]
+	for _, el := range additional {
+		if el.Type != QTypeOPT {
+			out = append(out, el)
+			continue
+		}
+
+		if edns != nil {
+			return nil, nil, errors.New("message contains more than one opt record")
+		}
+
+		var err error
+		edns, err = ednsFromRecord(el)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return out, edns, nil
+}
+
+func decodeEDNSOptions(nb *bv.ByteView, length uint16) ([]EDNSOption, error) {
+	end := nb.Pos() + uint(length)
+
+	var out []EDNSOption
+	for nb.Pos() < end {
+		code, err := nb.TakeUint16()
+		if err != nil {
+			return nil, err
+		}
+
+		optLength, err := nb.TakeUint16()
+		if err != nil {
+			return nil, err
+		}
+
+		if nb.Pos()+uint(optLength) > end {
+			return nil, fmt.Errorf("edns option %d overruns rdata", code)
+		}
+
+		data, err := decodeOpaque(nb, optLength)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, EDNSOption{Code: EDNSOptionCode(code), Data: data})
+	}
+
+	if nb.Pos() != end {
+		return nil, errors.New("edns options overrun rdata")
+	}
+
+	return out, nil
+}
+
+func encodeEDNSOptions(nb *bv.ByteView, options []EDNSOption) error {
+	for _, el := range options {
+		if len(el.Data) > 0xffff {
+			return fmt.Errorf("edns option %d is too big", el.Code)
+		}
+
+		if err := nb.PutUint16(uint16(el.Code)); err != nil {
+			return err
+		}
+
+		if err := nb.PutUint16(uint16(len(el.Data))); err != nil {
+			return err
+		}
+
+		if err := encodeOpaque(nb, el.Data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
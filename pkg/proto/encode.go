@@ -2,52 +2,95 @@ package proto
 
 import (
 	"fmt"
-	"strconv"
-	"strings"
+	"sync"
 
 	"github.com/rokkerruslan/dnska/internal/limits"
 	"github.com/rokkerruslan/dnska/pkg/bv"
 )
 
 type Encoder struct {
-	bv     *bv.ByteView
-	index  *labelsIndex // deprecated
-	index2 map[string]uint16
+	bv    bv.ByteView
+	index labelsIndex
 }
 
 func NewEncoder(to []byte) *Encoder {
-	return &Encoder{
-		bv:    bv.NewByteView(to),
-		index: &labelsIndex{nameIndex: map[string]uint{}},
-	}
+	enc := Encoder{}
+	enc.Reset(to)
+
+	return &enc
+}
+
+// Reset prepares the encoder to encode a new message into "to",
+// the memory of the compression index is reused.
+func (enc *Encoder) Reset(to []byte) {
+	enc.bv.Reset(to)
+	enc.index.reset()
+}
+
+var encoders = sync.Pool{
+	New: func() any {
+		return &Encoder{}
+	},
+}
+
+// AcquireEncoder returns an Encoder from the pool, the encoder
+// must be returned by ReleaseEncoder when it is no longer used.
+func AcquireEncoder(to []byte) *Encoder {
+	enc := encoders.Get().(*Encoder)
+	enc.Reset(to)
+
+	return enc
+}
+
+// ReleaseEncoder returns the encoder to the pool, the encoder must
+// not be used after release. The buffer passed to AcquireEncoder is
+// still owned by the caller.
+func ReleaseEncoder(enc *Encoder) {
+	enc.Reset(nil)
+	encoders.Put(enc)
 }
 
 // Encode encodes message "m".
 func (enc *Encoder) Encode(m Message) ([]byte, error) {
-	if err := encodeHeader(enc.bv, m.Header); err != nil {
+	header := m.Header
+	header.QDCount = uint16(len(m.Question))
+	header.ANCount = uint16(len(m.Answer))
+	header.NSCount = uint16(len(m.Authority))
+	header.ARCount = uint16(len(m.Additional))
+	if m.EDNS != nil {
+		header.ARCount++
+	}
+
+	if err := encodeHeader(&enc.bv, header); err != nil {
 		return enc.bv.Bytes(), err
 	}
 
 	for _, question := range m.Question {
-		if err := encodeQuestion(enc.bv, enc.index, question); err != nil {
+		if err := encodeQuestion(&enc.bv, &enc.index, question); err != nil {
 			return enc.bv.Bytes(), err
 		}
 	}
 
 	for _, record := range m.Answer {
-		if err := encodeRecord(enc.bv, enc.index, record); err != nil {
+		if err := encodeRecord(&enc.bv, &enc.index, record); err != nil {
 			return enc.bv.Bytes(), err
 		}
 	}
 
 	for _, record := range m.Authority {
-		if err := encodeRecord(enc.bv, enc.index, record); err != nil {
+		if err := encodeRecord(&enc.bv, &enc.index, record); err != nil {
 			return enc.bv.Bytes(), err
 		}
 	}
 
 	for _, record := range m.Additional {
-		if err := encodeRecord(enc.bv, enc.index, record); err != nil {
+		if err := encodeRecord(&enc.bv, &enc.index, record); err != nil {
+			return enc.bv.Bytes(), err
+		}
+	}
+
+	if m.EDNS != nil {
+		if err := encodeRecord(&enc.bv, &enc.index, m.EDNS.record()); err != nil {
 			return enc.bv.Bytes(), err
 		}
 	}
@@ -77,6 +120,13 @@ func encodeHeader(buf *bv.ByteView, h Header) error {
 	if h.RecursionAvailable {
 		flags |= 0x80
 	}
+	flags |= uint16(h.Z&0b1) << 6
+	if h.AuthenticData {
+		flags |= 0x20
+	}
+	if h.CheckingDisabled {
+		flags |= 0x10
+	}
 	flags |= uint16(h.RCode)
 
 	if err := buf.PutUint8(uint8(flags >> 8)); err != nil {
@@ -139,10 +189,12 @@ func encodeRecord(b *bv.ByteView, index *labelsIndex, r ResourceRecord) error {
 		return err
 	}
 
-	b.Seek(b.Pos() + 2)
-	//if err := b.PutUint16(r.RDLength); err != nil {
-	//	return err
-	//}
+	// RDLENGTH is reserved, the value is put when RDATA is
+	// encoded. The put is checked, so the record which does not
+	// fit into the buffer is reported by ErrBuf.
+	if err := b.PutUint16(0); err != nil {
+		return err
+	}
 
 	start := b.Pos()
 
@@ -152,10 +204,6 @@ func encodeRecord(b *bv.ByteView, index *labelsIndex, r ResourceRecord) error {
 
 	end := b.Pos()
 
-	// todo: Workaround. We can't put a value of RDLength field because it
-	//       can produce malformed message packet. Length must be calculated
-	//       based on encodeResourceData function call below.
-
 	b.Seek(start - 2) // seek to the RDLength position.
 
 	if err := b.PutUint16(uint16(end - start)); err != nil {
@@ -168,102 +216,282 @@ func encodeRecord(b *bv.ByteView, index *labelsIndex, r ResourceRecord) error {
 }
 
 func encodeResourceData(nb *bv.ByteView, index *labelsIndex, r ResourceRecord) error {
-	switch r.Type {
-	case QTypeA:
-		for _, part := range strings.Split(r.RData, ".") {
-			i, _ := strconv.Atoi(part)
-			if err := nb.PutUint8(uint8(i)); err != nil {
+	switch rd := r.RData.(type) {
+	case *A:
+		if !rd.Addr.Is4() {
+			return fmt.Errorf("A record requires IPv4 address, got %v", rd.Addr)
+		}
+
+		addr := rd.Addr.As4()
+
+		return encodeOpaque(nb, addr[:])
+
+	case *NS:
+		return index.EncodeName(nb, rd.Host)
+
+	case *MD:
+		return index.EncodeName(nb, rd.Host)
+
+	case *MF:
+		return index.EncodeName(nb, rd.Host)
+
+	case *CNAME:
+		return index.EncodeName(nb, rd.Target)
+
+	case *SOA:
+		if err := index.EncodeName(nb, rd.MName); err != nil {
+			return err
+		}
+
+		if err := index.EncodeName(nb, rd.RName); err != nil {
+			return err
+		}
+
+		for _, v := range []uint32{rd.Serial, rd.Refresh, rd.Retry, rd.Expire, rd.Minimum} {
+			if err := nb.PutUint32(v); err != nil {
 				return err
 			}
 		}
 
 		return nil
 
-	case QTypeNS:
-		return index.EncodeName(nb, r.RData)
+	case *MB:
+		return index.EncodeName(nb, rd.Host)
 
-	case QTypeMD:
-		return index.EncodeName(nb, r.RData)
+	case *MG:
+		return index.EncodeName(nb, rd.Mailbox)
 
-	case QTypeMF:
-		return index.EncodeName(nb, r.RData)
+	case *MR:
+		return index.EncodeName(nb, rd.Mailbox)
 
-	case QTypeCName:
-		return index.EncodeName(nb, r.RData)
+	case *NULL:
+		return encodeOpaque(nb, rd.Data)
 
-	case QTypeSOA:
+	case *PTR:
+		return index.EncodeName(nb, rd.Name)
 
-	case QTypeMB:
-		return index.EncodeName(nb, r.RData)
+	case *HINFO:
+		if err := encodeCharacterString(nb, rd.CPU); err != nil {
+			return err
+		}
+
+		if err := encodeCharacterString(nb, rd.OS); err != nil {
+			return err
+		}
+
+		return nil
+
+	case *MINFO:
+		if err := index.EncodeName(nb, rd.RMailBx); err != nil {
+			return err
+		}
+
+		return index.EncodeName(nb, rd.EMailBx)
+
+	case *MX:
+		if err := nb.PutUint16(rd.Preference); err != nil {
+			return err
+		}
+
+		return index.EncodeName(nb, rd.Exchange)
+
+	case *TXT:
+		for _, s := range rd.Data {
+			if err := encodeCharacterString(nb, s); err != nil {
+				return err
+			}
+		}
 
-	case QTypeMG:
-		return index.EncodeName(nb, r.RData)
+		return nil
+
+	case *AAAA:
+		if !rd.Addr.Is6() {
+			return fmt.Errorf("AAAA record requires IPv6 address, got %v", rd.Addr)
+		}
 
-	case QTypeMR:
-		return index.EncodeName(nb, r.RData)
+		addr := rd.Addr.As16()
 
-	case QTypeNULL:
-		for _, b := range []byte(r.RData) {
-			if err := nb.PutUint8(b); err != nil {
+		return encodeOpaque(nb, addr[:])
+
+	case *LOC:
+		for _, v := range []uint8{rd.Version, rd.Size, rd.HorizPre, rd.VertPre} {
+			if err := nb.PutUint8(v); err != nil {
+				return err
+			}
+		}
+
+		for _, v := range []uint32{rd.Latitude, rd.Longitude, rd.Altitude} {
+			if err := nb.PutUint32(v); err != nil {
 				return err
 			}
 		}
 
 		return nil
 
-	case QTypeWKS:
-	case QTypePTR:
-		return index.EncodeName(nb, r.RData)
+	case *SRV:
+		for _, v := range []uint16{rd.Priority, rd.Weight, rd.Port} {
+			if err := nb.PutUint16(v); err != nil {
+				return err
+			}
+		}
 
-	case QTypeHINFO:
-		parts := strings.Split(r.RData, "|")
+		return index.EncodeNameUncompressed(nb, rd.Target)
 
-		if err := encodeCharacterString(nb, parts[0]); err != nil {
+	case *NAPTR:
+		if err := nb.PutUint16(rd.Order); err != nil {
 			return err
 		}
 
-		if err := encodeCharacterString(nb, parts[1]); err != nil {
+		if err := nb.PutUint16(rd.Preference); err != nil {
 			return err
 		}
 
-		return nil
+		for _, s := range []string{rd.Flags, rd.Services, rd.Regexp} {
+			if err := encodeCharacterString(nb, s); err != nil {
+				return err
+			}
+		}
+
+		return index.EncodeNameUncompressed(nb, rd.Replacement)
+
+	case *SSHFP:
+		if err := nb.PutUint8(rd.Algorithm); err != nil {
+			return err
+		}
 
-	case QTypeMINFO:
-	case QTypeMX:
-	case QTypeTXT:
+		if err := nb.PutUint8(rd.FPType); err != nil {
+			return err
+		}
 
-	case QTypeAAAA:
-		for _, part := range strings.Split(r.RData, ":") {
-			a, b := part[:2], part[2:]
-			ai, _ := strconv.ParseUint(a, 16, 8)
-			bi, _ := strconv.ParseUint(b, 16, 8)
+		return encodeOpaque(nb, rd.Fingerprint)
 
-			if err := nb.PutUint8(uint8(ai)); err != nil {
+	case *TLSA:
+		for _, v := range []uint8{rd.Usage, rd.Selector, rd.MatchingType} {
+			if err := nb.PutUint8(v); err != nil {
 				return err
 			}
+		}
+
+		return encodeOpaque(nb, rd.CertificateAssociationData)
+
+	case *URI:
+		if err := nb.PutUint16(rd.Priority); err != nil {
+			return err
+		}
+
+		if err := nb.PutUint16(rd.Weight); err != nil {
+			return err
+		}
+
+		return nb.PutString(rd.Target)
+
+	case *CAA:
+		if err := nb.PutUint8(rd.Flags); err != nil {
+			return err
+		}
+
+		if err := encodeCharacterString(nb, rd.Tag); err != nil {
+			return err
+		}
+
+		return nb.PutString(rd.Value)
 
-			if err := nb.PutUint8(uint8(bi)); err != nil {
+	case *SVCB:
+		return encodeSVCB(nb, index, rd)
+
+	case *HTTPS:
+		return encodeSVCB(nb, index, &rd.SVCB)
+
+	case *DS:
+		if err := nb.PutUint16(rd.KeyTag); err != nil {
+			return err
+		}
+
+		for _, v := range []uint8{rd.Algorithm, rd.DigestType} {
+			if err := nb.PutUint8(v); err != nil {
 				return err
 			}
 		}
 
-		return nil
+		return encodeOpaque(nb, rd.Digest)
 
-	case QTypeAXFR:
-	case QTypeMAILB:
-	case QTypeMAILA:
-	case QTypeALL:
-	}
+	case *DNSKEY:
+		if err := nb.PutUint16(rd.Flags); err != nil {
+			return err
+		}
 
-	// Default encoding.
+		for _, v := range []uint8{rd.Protocol, rd.Algorithm} {
+			if err := nb.PutUint8(v); err != nil {
+				return err
+			}
+		}
 
-	for _, b := range []byte(r.RData) {
-		if err := nb.PutUint8(b); err != nil {
+		return encodeOpaque(nb, rd.PublicKey)
+
+	case *RRSIG:
+		if err := encodeRRSIGHeader(nb, index, rd); err != nil {
 			return err
 		}
+
+		return encodeOpaque(nb, rd.Signature)
+
+	case *NSEC:
+		if err := index.EncodeNameUncompressed(nb, rd.NextDomain); err != nil {
+			return err
+		}
+
+		return encodeTypeBitMaps(nb, rd.Types)
+
+	case *NSEC3:
+		for _, v := range []uint8{rd.HashAlgorithm, rd.Flags} {
+			if err := nb.PutUint8(v); err != nil {
+				return err
+			}
+		}
+
+		if err := nb.PutUint16(rd.Iterations); err != nil {
+			return err
+		}
+
+		if err := encodeSalt(nb, rd.Salt); err != nil {
+			return err
+		}
+
+		if err := encodeSalt(nb, rd.NextHashedOwner); err != nil {
+			return err
+		}
+
+		return encodeTypeBitMaps(nb, rd.Types)
+
+	case *NSEC3PARAM:
+		for _, v := range []uint8{rd.HashAlgorithm, rd.Flags} {
+			if err := nb.PutUint8(v); err != nil {
+				return err
+			}
+		}
+
+		if err := nb.PutUint16(rd.Iterations); err != nil {
+			return err
+		}
+
+		return encodeSalt(nb, rd.Salt)
+
+	case *OPT:
+		return encodeEDNSOptions(nb, rd.Options)
+
+	case *Unknown:
+		return encodeOpaque(nb, rd.Data)
+
+	case nil:
+		// Records without data, e.g. in update messages.
+		return nil
 	}
 
-	return nil
+	return fmt.Errorf("unsupported resource data %T", r.RData)
+}
+
+func encodeOpaque(nb *bv.ByteView, data []byte) error {
+	return nb.PutBytes(data)
 }
 
 func encodeCharacterString(nb *bv.ByteView, s string) error {
@@ -278,16 +506,5 @@ func encodeCharacterString(nb *bv.ByteView, s string) error {
 		return err
 	}
 
-	for _, b := range []byte(s) {
-		if err := nb.PutUint8(b); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-type Part struct {
-	Label  string
-	Offset uint
+	return nb.PutString(s)
 }
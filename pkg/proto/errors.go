@@ -0,0 +1,69 @@
+package proto
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rokkerruslan/dnska/pkg/bv"
+)
+
+// ErrFormat means that a message is malformed, the name server
+// responds to such queries with RCODE format error (FORMERR).
+var ErrFormat = errors.New("format error")
+
+// A FormatError is returned by Decoder for malformed messages. The
+// error matches ErrFormat and the error of the malformed part, e.g.
+// ErrTruncated or ErrPointerLoop.
+type FormatError struct {
+	Err error
+}
+
+func (e *FormatError) Error() string {
+	return ErrFormat.Error() + ": " + e.Err.Error()
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+func (e *FormatError) Is(target error) bool {
+	return target == ErrFormat
+}
+
+// Errors of decoding malformed messages, the errors returned by
+// Decoder are wrapped, use errors.Is to check them.
+var (
+	// ErrTruncated is returned when the message ends before
+	// all fields (e.g. records announced by the header) are read.
+	ErrTruncated = errors.New("message is truncated")
+
+	// ErrPointerLoop is returned when compression pointers of a
+	// name do not point strictly backward of the previous pointer.
+	ErrPointerLoop = errors.New("compression pointer loop")
+
+	// ErrForwardPointer is returned when compression pointer
+	// points to itself or to the data after the pointer.
+	ErrForwardPointer = errors.New("compression pointer points forward")
+
+	// ErrNameTooLong is returned when the name is longer than
+	// 255 octets in the wire format (RFC 1035 section 2.3.4).
+	ErrNameTooLong = errors.New("name is too long")
+
+	// ErrLabelType is returned for the labels with the reserved
+	// (0b01 and 0b10) upper bits of the length octet.
+	ErrLabelType = errors.New("unsupported label type")
+
+	// ErrRDataLength is returned when RDATA of a known
+	// type does not take exactly RDLENGTH octets.
+	ErrRDataLength = errors.New("rdata length mismatch")
+)
+
+// truncated wraps the buffer overrun errors of bv into ErrTruncated.
+func truncated(err error) error {
+	var bufErr *bv.ErrBuf
+	if errors.As(err, &bufErr) {
+		return fmt.Errorf("%w: %v", ErrTruncated, err)
+	}
+
+	return err
+}
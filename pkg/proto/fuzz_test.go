@@ -0,0 +1,65 @@
+package proto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// FuzzDecode checks that decoding of arbitrary data never panics and
+// that the decoded messages survive the encoding and decoding again.
+//
+// The corpus is seeded by the testdata messages and by the malformed
+// packets of testdata/fuzz/FuzzDecode, the latter are added by go test.
+func FuzzDecode(f *testing.F) {
+	malformed, err := filepath.Glob("testdata/fuzz/FuzzDecode/*")
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	if len(malformed) == 0 {
+		f.Fatal("no malformed packets in testdata/fuzz/FuzzDecode")
+	}
+
+	names, err := filepath.Glob("testdata/*")
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	messages := 0
+	for _, name := range names {
+		if info, err := os.Stat(name); err != nil || info.IsDir() {
+			continue
+		}
+
+		buf, err := os.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+
+		f.Add(buf)
+		messages++
+	}
+
+	if messages == 0 {
+		f.Fatal("no messages in testdata")
+	}
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		m, err := NewDecoder().Decode(in)
+		if err != nil {
+			return
+		}
+
+		// Not every decoded message can be encoded (e.g. names
+		// with dots inside labels), but it must not panic either.
+		buf, err := NewEncoder(make([]byte, 0xffff)).Encode(m)
+		if err != nil {
+			return
+		}
+
+		if _, err := NewDecoder().Decode(buf); err != nil {
+			t.Fatalf("failed to decode encoded message: %v\n%s", err, m)
+		}
+	})
+}
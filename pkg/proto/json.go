@@ -0,0 +1,339 @@
+package proto
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rokkerruslan/dnska/pkg/bv"
+)
+
+// Reference - https://datatracker.ietf.org/doc/html/rfc8427
+
+// JSON Representation
+//
+// Messages are represented as JSON objects with the members named
+// after the header fields:
+//
+//	{
+//	  "ID": 1, "QR": true, "Opcode": 0, "AA": false, "TC": false,
+//	  "RD": true, "RA": true, "AD": false, "CD": false, "RCODE": 0,
+//	  "QDCOUNT": 1, "ANCOUNT": 1, "NSCOUNT": 0, "ARCOUNT": 0,
+//	  "questionRRs": [
+//	    {"NAME": "example.com.", "TYPE": 1, "TYPEname": "A", "CLASS": 1, "CLASSname": "IN"}
+//	  ],
+//	  "answerRRs": [
+//	    {
+//	      "NAME": "example.com.", "TYPE": 1, "TYPEname": "A", "CLASS": 1, "CLASSname": "IN",
+//	      "TTL": 300, "rdataA": "93.184.216.34"
+//	    }
+//	  ]
+//	}
+//
+// The RDATA is represented by the "rdata<TYPE>" member in the
+// presentation format, e.g. "rdataMX": "10 mail.example.com.". The
+// data without presentation format (unknown types, NULL and OPT)
+// is represented by the "RDATAHEX" member.
+//
+// The EDNS of a message is the OPT record of the additional section,
+// as it is on the wire. The count members are calculated based on
+// the sections and are ignored by the decoder, as in the wire format.
+
+type jsonMessage struct {
+	ID     uint16 `json:"ID"`
+	QR     bool   `json:"QR"`
+	Opcode Opcode `json:"Opcode"`
+	AA     bool   `json:"AA"`
+	TC     bool   `json:"TC"`
+	RD     bool   `json:"RD"`
+	RA     bool   `json:"RA"`
+	AD     bool   `json:"AD"`
+	CD     bool   `json:"CD"`
+	RCODE  RCode  `json:"RCODE"`
+
+	QDCOUNT uint16 `json:"QDCOUNT"`
+	ANCOUNT uint16 `json:"ANCOUNT"`
+	NSCOUNT uint16 `json:"NSCOUNT"`
+	ARCOUNT uint16 `json:"ARCOUNT"`
+
+	QuestionRRs   []Question       `json:"questionRRs,omitempty"`
+	AnswerRRs     []ResourceRecord `json:"answerRRs,omitempty"`
+	AuthorityRRs  []ResourceRecord `json:"authorityRRs,omitempty"`
+	AdditionalRRs []ResourceRecord `json:"additionalRRs,omitempty"`
+}
+
+// MarshalJSON encodes the message in the RFC 8427 format.
+func (m Message) MarshalJSON() ([]byte, error) {
+	additional := m.Additional
+	if m.EDNS != nil {
+		additional = append(append([]ResourceRecord{}, m.Additional...), m.EDNS.record())
+	}
+
+	return json.Marshal(jsonMessage{
+		ID:            m.Header.ID,
+		QR:            m.Header.Response,
+		Opcode:        m.Header.Opcode,
+		AA:            m.Header.AuthoritativeAnswer,
+		TC:            m.Header.TruncateCation,
+		RD:            m.Header.RecursionDesired,
+		RA:            m.Header.RecursionAvailable,
+		AD:            m.Header.AuthenticData,
+		CD:            m.Header.CheckingDisabled,
+		RCODE:         m.Header.RCode,
+		QDCOUNT:       uint16(len(m.Question)),
+		ANCOUNT:       uint16(len(m.Answer)),
+		NSCOUNT:       uint16(len(m.Authority)),
+		ARCOUNT:       uint16(len(additional)),
+		QuestionRRs:   m.Question,
+		AnswerRRs:     m.Answer,
+		AuthorityRRs:  m.Authority,
+		AdditionalRRs: additional,
+	})
+}
+
+// UnmarshalJSON decodes the message in the RFC 8427 format.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var in jsonMessage
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	additional, edns, err := extractEDNS(in.AdditionalRRs)
+	if err != nil {
+		return err
+	}
+
+	*m = Message{
+		Header: Header{
+			ID:                  in.ID,
+			Response:            in.QR,
+			Opcode:              in.Opcode,
+			AuthoritativeAnswer: in.AA,
+			TruncateCation:      in.TC,
+			RecursionDesired:    in.RD,
+			RecursionAvailable:  in.RA,
+			AuthenticData:       in.AD,
+			CheckingDisabled:    in.CD,
+			RCode:               in.RCODE,
+			QDCount:             in.QDCOUNT,
+			ANCount:             in.ANCOUNT,
+			NSCount:             in.NSCOUNT,
+			ARCount:             in.ARCOUNT,
+		},
+		Question:   in.QuestionRRs,
+		Answer:     in.AnswerRRs,
+		Authority:  in.AuthorityRRs,
+		Additional: additional,
+		EDNS:       edns,
+	}
+
+	return nil
+}
+
+type jsonQuestion struct {
+	NAME      string  `json:"NAME"`
+	TYPE      *QType  `json:"TYPE,omitempty"`
+	TYPEname  string  `json:"TYPEname,omitempty"`
+	CLASS     *QClass `json:"CLASS,omitempty"`
+	CLASSname string  `json:"CLASSname,omitempty"`
+}
+
+func (q Question) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonQuestion{
+		NAME:      fqdn(q.Name),
+		TYPE:      &q.Type,
+		TYPEname:  typeMnemonic(q.Type),
+		CLASS:     &q.Class,
+		CLASSname: classMnemonic(q.Class),
+	})
+}
+
+func (q *Question) UnmarshalJSON(data []byte) error {
+	var in jsonQuestion
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	name, qType, class, err := in.decode()
+	if err != nil {
+		return err
+	}
+
+	*q = Question{Name: name, Type: qType, Class: class}
+
+	return nil
+}
+
+// decode returns the name, type and class of a question or a record,
+// either the numeric or the mnemonic member is enough.
+func (q jsonQuestion) decode() (string, QType, QClass, error) {
+	name, err := parseName(token{raw: q.NAME})
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	var qType QType
+	switch {
+	case q.TYPE != nil:
+		qType = *q.TYPE
+	case q.TYPEname != "":
+		var ok bool
+		if qType, ok = parseType(q.TYPEname); !ok {
+			return "", 0, 0, fmt.Errorf("unknown type %q", q.TYPEname)
+		}
+	default:
+		return "", 0, 0, fmt.Errorf("%q has no type", q.NAME)
+	}
+
+	class := ClassIN
+	switch {
+	case q.CLASS != nil:
+		class = *q.CLASS
+	case q.CLASSname != "":
+		var ok bool
+		if class, ok = parseClass(q.CLASSname); !ok {
+			return "", 0, 0, fmt.Errorf("unknown class %q", q.CLASSname)
+		}
+	}
+
+	return name, qType, class, nil
+}
+
+const (
+	jsonRDataPrefix = "rdata"
+	jsonRDataHex    = "RDATAHEX"
+)
+
+// MarshalJSON encodes the record in the RFC 8427 format.
+func (r ResourceRecord) MarshalJSON() ([]byte, error) {
+	out := map[string]any{
+		"NAME":      fqdn(r.Name),
+		"TYPE":      r.Type,
+		"TYPEname":  typeMnemonic(r.Type),
+		"CLASS":     r.Class,
+		"CLASSname": classMnemonic(r.Class),
+		"TTL":       r.TTL,
+	}
+
+	if r.RDLength != 0 {
+		out["RDLENGTH"] = r.RDLength
+	}
+
+	switch r.RData.(type) {
+	case nil:
+	case *Unknown, *NULL, *OPT:
+		data, err := encodeRDataBytes(r)
+		if err != nil {
+			return nil, err
+		}
+
+		out[jsonRDataHex] = strings.ToUpper(hex.EncodeToString(data))
+	default:
+		out[jsonRDataPrefix+typeMnemonic(r.Type)] = r.RData.String()
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes the record in the RFC 8427 format.
+func (r *ResourceRecord) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	var in struct {
+		jsonQuestion
+		TTL      uint32 `json:"TTL"`
+		RDLENGTH uint16 `json:"RDLENGTH"`
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	name, qType, class, err := in.decode()
+	if err != nil {
+		return err
+	}
+
+	out := ResourceRecord{Name: name, Type: qType, Class: class, TTL: in.TTL, RDLength: in.RDLENGTH}
+
+	if raw, ok := fields[jsonRDataHex]; ok {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+
+		buf, err := hex.DecodeString(s)
+		if err != nil {
+			return fmt.Errorf("invalid %s of %q: %v", jsonRDataHex, in.NAME, err)
+		}
+
+		if out.RData, err = decodeRDataBytes(qType, buf); err != nil {
+			return err
+		}
+	}
+
+	for key, raw := range fields {
+		if !strings.HasPrefix(key, jsonRDataPrefix) {
+			continue
+		}
+
+		if t, ok := parseType(strings.TrimPrefix(key, jsonRDataPrefix)); !ok || t != qType {
+			return fmt.Errorf("%s member does not match type %s", key, typeMnemonic(qType))
+		}
+
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+
+		tokens, err := tokenize(s)
+		if err != nil {
+			return err
+		}
+
+		if out.RData, err = parseRData(qType, tokens); err != nil {
+			return err
+		}
+	}
+
+	*r = out
+
+	return nil
+}
+
+// encodeRDataBytes returns RDATA of the record in the wire format
+// without compression.
+func encodeRDataBytes(r ResourceRecord) ([]byte, error) {
+	nb := bv.NewByteView(make([]byte, 0xffff))
+
+	if err := encodeResourceData(nb, &labelsIndex{canonical: true}, r); err != nil {
+		return nil, err
+	}
+
+	return nb.Bytes(), nil
+}
+
+// decodeRDataBytes decodes RDATA of type "t" from the standalone
+// buffer, the data must not contain compression pointers.
+func decodeRDataBytes(t QType, data []byte) (RData, error) {
+	if len(data) > 0xffff {
+		return nil, errors.New("rdata is too long")
+	}
+
+	nb := bv.NewByteView(data)
+
+	rData, err := NewDecoder().decodeResourceData(nb, t, uint16(len(data)))
+	if err != nil {
+		return nil, truncated(err)
+	}
+
+	if nb.Pos() != uint(len(data)) {
+		return nil, fmt.Errorf("%w: %s record rdata length is %d, but %d bytes decoded", ErrRDataLength, typeMnemonic(t), len(data), nb.Pos())
+	}
+
+	return rData, nil
+}
@@ -0,0 +1,106 @@
+package proto
+
+import (
+	"encoding/json"
+	"net/netip"
+	"os"
+	"testing"
+
+	testing2 "github.com/rokkerruslan/dnska/testing"
+)
+
+func TestMessageJSON(t *testing.T) {
+	m := Message{
+		Header: Header{ID: 1, Response: true, RecursionDesired: true, RecursionAvailable: true},
+		Question: []Question{
+			{Name: "example.com", Type: QTypeA, Class: ClassIN},
+		},
+		Answer: []ResourceRecord{
+			{Name: "example.com", Type: QTypeA, Class: ClassIN, TTL: 300, RData: &A{Addr: netip.MustParseAddr("93.184.216.34")}},
+		},
+	}
+
+	want := `{"ID":1,"QR":true,"Opcode":0,"AA":false,"TC":false,"RD":true,"RA":true,"AD":false,"CD":false,"RCODE":0,` +
+		`"QDCOUNT":1,"ANCOUNT":1,"NSCOUNT":0,"ARCOUNT":0,` +
+		`"questionRRs":[{"NAME":"example.com.","TYPE":1,"TYPEname":"A","CLASS":1,"CLASSname":"IN"}],` +
+		`"answerRRs":[{"CLASS":1,"CLASSname":"IN","NAME":"example.com.","TTL":300,"TYPE":1,"TYPEname":"A","rdataA":"93.184.216.34"}]}`
+
+	buf, err := json.Marshal(m)
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, string(buf), want)
+
+	var got Message
+	testing2.FailIfError(t, json.Unmarshal(buf, &got))
+
+	m.Header.QDCount = 1
+	m.Header.ANCount = 1
+
+	testing2.Assert(t, got, m)
+}
+
+func TestMessageJSONRoundTrip(t *testing.T) {
+	for _, name := range []string{
+		"testdata/standard-query.query.A.yahoo.com.opt.cookie",
+		"testdata/standard-query.response.A.yahoo.com.opt.cookie",
+		"testdata/standard-query.response.soa.com",
+	} {
+		t.Run(name, func(t *testing.T) {
+			buf, err := os.ReadFile(name)
+			testing2.FailIfError(t, err)
+
+			m, err := NewDecoder().Decode(buf)
+			testing2.FailIfError(t, err)
+
+			data, err := json.Marshal(m)
+			testing2.FailIfError(t, err)
+
+			var got Message
+			testing2.FailIfError(t, json.Unmarshal(data, &got))
+
+			// The empty sections are decoded as nil slices,
+			// so compare the messages in the wire format.
+			want, err := NewEncoder(make([]byte, 4096)).Encode(m)
+			testing2.FailIfError(t, err)
+
+			gotBuf, err := NewEncoder(make([]byte, 4096)).Encode(got)
+			testing2.FailIfError(t, err)
+
+			testing2.Assert(t, gotBuf, want)
+			testing2.Assert(t, got.Header, m.Header)
+		})
+	}
+}
+
+func TestResourceRecordUnmarshalJSON(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		want ResourceRecord
+	}{
+		{
+			name: "mnemonics only",
+			data: `{"NAME": "example.com.", "TYPEname": "MX", "TTL": 60, "rdataMX": "10 mail.example.com."}`,
+			want: ResourceRecord{Name: "example.com", Type: QTypeMX, Class: ClassIN, TTL: 60, RData: &MX{Preference: 10, Exchange: "mail.example.com"}},
+		},
+		{
+			name: "hex data",
+			data: `{"NAME": "example.com.", "TYPE": 1, "CLASS": 1, "RDATAHEX": "C0000201"}`,
+			want: ResourceRecord{Name: "example.com", Type: QTypeA, Class: ClassIN, RData: &A{Addr: netip.MustParseAddr("192.0.2.1")}},
+		},
+		{
+			name: "unknown type",
+			data: `{"NAME": "example.com.", "TYPE": 65280, "CLASS": 1, "RDATAHEX": "CAFE"}`,
+			want: ResourceRecord{Name: "example.com", Type: QType(65280), Class: ClassIN, RData: &Unknown{T: QType(65280), Data: []byte{0xca, 0xfe}}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got ResourceRecord
+			testing2.FailIfError(t, json.Unmarshal([]byte(tc.data), &got))
+
+			testing2.Assert(t, got, tc.want)
+		})
+	}
+}
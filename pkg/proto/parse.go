@@ -0,0 +1,1316 @@
+package proto
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseResourceRecord parses a record in the presentation format
+// (RFC 1035 section 5.1):
+//
+//	<domain-name> [<TTL>] [<class>] <type> <RDATA>
+//
+// The TTL and the class are optional and can go in any order, the
+// default class is IN. The RDATA can be split over multiple lines
+// with parentheses, comments (from ";" to the end of a line) are
+// ignored. The generic RDATA format (RFC 3597) is accepted for any
+// type.
+//
+// There is no origin, so all the names are treated as absolute
+// ones, the trailing dot is optional.
+func ParseResourceRecord(s string) (ResourceRecord, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return ResourceRecord{}, err
+	}
+
+	if len(tokens) < 2 {
+		return ResourceRecord{}, fmt.Errorf("record %q is too short", s)
+	}
+
+	name, err := parseName(tokens[0])
+	if err != nil {
+		return ResourceRecord{}, err
+	}
+
+	out := ResourceRecord{Name: name, Class: ClassIN}
+
+	tokens = tokens[1:]
+
+	var hasTTL, hasClass bool
+	for len(tokens) > 0 && !(hasTTL && hasClass) {
+		if ttl, err := strconv.ParseUint(tokens[0].raw, 10, 32); err == nil && !hasTTL {
+			out.TTL = uint32(ttl)
+			hasTTL = true
+		} else if class, ok := parseClass(tokens[0].raw); ok && !hasClass {
+			out.Class = class
+			hasClass = true
+		} else {
+			break
+		}
+
+		tokens = tokens[1:]
+	}
+
+	if len(tokens) == 0 {
+		return ResourceRecord{}, fmt.Errorf("record %q has no type", s)
+	}
+
+	qType, ok := parseType(tokens[0].raw)
+	if !ok {
+		return ResourceRecord{}, fmt.Errorf("unknown record type %q", tokens[0].raw)
+	}
+
+	out.Type = qType
+
+	out.RData, err = parseRData(qType, tokens[1:])
+	if err != nil {
+		return ResourceRecord{}, err
+	}
+
+	return out, nil
+}
+
+// token is a single field of the presentation format, the
+// escape sequences are kept as is.
+type token struct {
+	raw    string
+	quoted bool
+}
+
+func tokenize(s string) ([]token, error) {
+	var out []token
+
+	var cur strings.Builder
+	inToken := false
+
+	flush := func() {
+		if inToken {
+			out = append(out, token{raw: cur.String()})
+			cur.Reset()
+			inToken = false
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+
+		switch ch {
+		case ' ', '\t', '\r', '\n', '(', ')':
+			flush()
+
+		case ';':
+			flush()
+
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+
+		case '"':
+			flush()
+
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+
+			if j >= len(s) {
+				return nil, errors.New("unterminated quoted string")
+			}
+
+			out = append(out, token{raw: s[i+1 : j], quoted: true})
+			i = j
+
+		case '\\':
+			cur.WriteByte(ch)
+			if i+1 < len(s) {
+				i++
+				cur.WriteByte(s[i])
+			}
+			inToken = true
+
+		default:
+			cur.WriteByte(ch)
+			inToken = true
+		}
+	}
+
+	flush()
+
+	return out, nil
+}
+
+// unescape replaces \X and \DDD escape sequences with the
+// characters they stand for.
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		if i+1 >= len(s) {
+			return "", fmt.Errorf("dangling escape in %q", s)
+		}
+
+		if isDigit(s[i+1]) {
+			if i+3 >= len(s) || !isDigit(s[i+2]) || !isDigit(s[i+3]) {
+				return "", fmt.Errorf("invalid escape in %q", s)
+			}
+
+			v, _ := strconv.Atoi(s[i+1 : i+4])
+			if v > 0xff {
+				return "", fmt.Errorf("invalid escape in %q", s)
+			}
+
+			b.WriteByte(byte(v))
+			i += 3
+
+			continue
+		}
+
+		b.WriteByte(s[i+1])
+		i++
+	}
+
+	return b.String(), nil
+}
+
+func isDigit(ch byte) bool { return ch >= '0' && ch <= '9' }
+
+func parseName(t token) (string, error) {
+	if t.raw == "@" {
+		return "", errors.New("relative names are not supported")
+	}
+
+	// The name is split into labels before unescaping, the names
+	// are kept as the labels joined with dots, so the label with
+	// an escaped dot ("\." or "\046") can not be represented.
+	labels := splitLabels(t.raw)
+
+	// The empty label after the trailing dot is the root.
+	if len(labels) > 1 && labels[len(labels)-1] == "" {
+		labels = labels[:len(labels)-1]
+	}
+
+	for i, label := range labels {
+		v, err := unescape(label)
+		if err != nil {
+			return "", err
+		}
+
+		if strings.Contains(v, ".") {
+			return "", fmt.Errorf("escaped dot in label %q is not supported", label)
+		}
+
+		labels[i] = v
+	}
+
+	return strings.Join(labels, "."), nil
+}
+
+// splitLabels splits the name in presentation format
+// by the dots which are not escaped.
+func splitLabels(s string) []string {
+	var (
+		out   []string
+		start int
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '.':
+			out = append(out, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(out, s[start:])
+}
+
+var typesByMnemonic = func() map[string]QType {
+	out := map[string]QType{}
+
+	for t := QType(1); t < 512; t++ {
+		if s := typeMnemonic(t); !strings.HasPrefix(s, "TYPE") {
+			out[s] = t
+		}
+	}
+
+	return out
+}()
+
+func parseType(s string) (QType, bool) {
+	s = strings.ToUpper(s)
+
+	if t, ok := typesByMnemonic[s]; ok {
+		return t, true
+	}
+
+	if v, ok := strings.CutPrefix(s, "TYPE"); ok {
+		t, err := strconv.ParseUint(v, 10, 16)
+		return QType(t), err == nil
+	}
+
+	return 0, false
+}
+
+func parseClass(s string) (QClass, bool) {
+	s = strings.ToUpper(s)
+
+	for class, mnemonic := range classMnemonics {
+		if mnemonic == s {
+			return class, true
+		}
+	}
+
+	if v, ok := strings.CutPrefix(s, "CLASS"); ok {
+		c, err := strconv.ParseUint(v, 10, 16)
+		return QClass(c), err == nil
+	}
+
+	return 0, false
+}
+
+func parseRData(t QType, tokens []token) (RData, error) {
+	if len(tokens) > 0 && !tokens[0].quoted && tokens[0].raw == `\#` {
+		return parseGenericRData(t, tokens[1:])
+	}
+
+	s := &rdataScanner{t: t, tokens: tokens}
+
+	var out RData
+
+	switch t {
+	case QTypeA:
+		addr := s.addr()
+		if s.err == nil && !addr.Is4() {
+			s.fail("%v is not an IPv4 address", addr)
+		}
+
+		out = &A{Addr: addr}
+
+	case QTypeNS:
+		out = &NS{Host: s.name()}
+
+	case QTypeMD:
+		out = &MD{Host: s.name()}
+
+	case QTypeMF:
+		out = &MF{Host: s.name()}
+
+	case QTypeCName:
+		out = &CNAME{Target: s.name()}
+
+	case QTypeSOA:
+		out = &SOA{
+			MName:   s.name(),
+			RName:   s.name(),
+			Serial:  s.uint32(),
+			Refresh: s.uint32(),
+			Retry:   s.uint32(),
+			Expire:  s.uint32(),
+			Minimum: s.uint32(),
+		}
+
+	case QTypeMB:
+		out = &MB{Host: s.name()}
+
+	case QTypeMG:
+		out = &MG{Mailbox: s.name()}
+
+	case QTypeMR:
+		out = &MR{Mailbox: s.name()}
+
+	case QTypePTR:
+		out = &PTR{Name: s.name()}
+
+	case QTypeHINFO:
+		out = &HINFO{CPU: s.characterString(), OS: s.characterString()}
+
+	case QTypeMINFO:
+		out = &MINFO{RMailBx: s.name(), EMailBx: s.name()}
+
+	case QTypeMX:
+		out = &MX{Preference: s.uint16(), Exchange: s.name()}
+
+	case QTypeTXT:
+		rd := &TXT{Data: []string{s.characterString()}}
+		for s.err == nil && len(s.tokens) > 0 {
+			rd.Data = append(rd.Data, s.characterString())
+		}
+
+		out = rd
+
+	case QTypeAAAA:
+		addr := s.addr()
+		if s.err == nil && !addr.Is6() {
+			s.fail("%v is not an IPv6 address", addr)
+		}
+
+		out = &AAAA{Addr: addr}
+
+	case QTypeLOC:
+		out = s.loc()
+
+	case QTypeSRV:
+		out = &SRV{Priority: s.uint16(), Weight: s.uint16(), Port: s.uint16(), Target: s.name()}
+
+	case QTypeNAPTR:
+		out = &NAPTR{
+			Order:       s.uint16(),
+			Preference:  s.uint16(),
+			Flags:       s.characterString(),
+			Services:    s.characterString(),
+			Regexp:      s.characterString(),
+			Replacement: s.name(),
+		}
+
+	case QTypeSSHFP:
+		out = &SSHFP{Algorithm: s.uint8(), FPType: s.uint8(), Fingerprint: s.hex()}
+
+	case QTypeTLSA:
+		out = &TLSA{Usage: s.uint8(), Selector: s.uint8(), MatchingType: s.uint8(), CertificateAssociationData: s.hex()}
+
+	case QTypeURI:
+		out = &URI{Priority: s.uint16(), Weight: s.uint16(), Target: s.text()}
+
+	case QTypeCAA:
+		out = &CAA{Flags: s.uint8(), Tag: s.text(), Value: s.text()}
+
+	case QTypeSVCB:
+		out = s.svcb()
+
+	case QTypeHTTPS:
+		out = &HTTPS{SVCB: *s.svcb()}
+
+	case QTypeDS:
+		out = &DS{KeyTag: s.uint16(), Algorithm: s.uint8(), DigestType: s.uint8(), Digest: s.hex()}
+
+	case QTypeDNSKEY:
+		out = &DNSKEY{Flags: s.uint16(), Protocol: s.uint8(), Algorithm: s.uint8(), PublicKey: s.base64()}
+
+	case QTypeRRSIG:
+		out = &RRSIG{
+			TypeCovered: s.qType(),
+			Algorithm:   s.uint8(),
+			Labels:      s.uint8(),
+			OriginalTTL: s.uint32(),
+			Expiration:  s.signatureTime(),
+			Inception:   s.signatureTime(),
+			KeyTag:      s.uint16(),
+			SignerName:  s.name(),
+			Signature:   s.base64(),
+		}
+
+	case QTypeNSEC:
+		out = &NSEC{NextDomain: s.name(), Types: s.types()}
+
+	case QTypeNSEC3:
+		out = &NSEC3{
+			HashAlgorithm:   s.uint8(),
+			Flags:           s.uint8(),
+			Iterations:      s.uint16(),
+			Salt:            s.salt(),
+			NextHashedOwner: s.base32Hex(),
+			Types:           s.types(),
+		}
+
+	case QTypeNSEC3PARAM:
+		out = &NSEC3PARAM{HashAlgorithm: s.uint8(), Flags: s.uint8(), Iterations: s.uint16(), Salt: s.salt()}
+
+	default:
+		return nil, fmt.Errorf("%s record data can be only in the generic format", typeMnemonic(t))
+	}
+
+	if err := s.done(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// parseGenericRData parses the generic RDATA format (RFC 3597):
+//
+//	\# <length> <hex data>
+//
+// The data of the known types is decoded as usual.
+func parseGenericRData(t QType, tokens []token) (RData, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("generic rdata has no length")
+	}
+
+	length, err := strconv.ParseUint(tokens[0].raw, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid generic rdata length %q", tokens[0].raw)
+	}
+
+	var hexData strings.Builder
+	for _, el := range tokens[1:] {
+		hexData.WriteString(el.raw)
+	}
+
+	data, err := hex.DecodeString(hexData.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid generic rdata: %v", err)
+	}
+
+	if len(data) != int(length) {
+		return nil, fmt.Errorf("generic rdata length is %d, but %d bytes given", length, len(data))
+	}
+
+	return decodeRDataBytes(t, data)
+}
+
+// rdataScanner reads RDATA fields from the tokens one by one. The
+// first error is kept, and all the subsequent calls do nothing.
+type rdataScanner struct {
+	t      QType
+	tokens []token
+	err    error
+}
+
+func (s *rdataScanner) fail(format string, args ...any) {
+	if s.err == nil {
+		s.err = fmt.Errorf("%s record: %s", typeMnemonic(s.t), fmt.Sprintf(format, args...))
+	}
+}
+
+func (s *rdataScanner) next() (token, bool) {
+	if s.err != nil {
+		return token{}, false
+	}
+
+	if len(s.tokens) == 0 {
+		s.fail("not enough fields")
+		return token{}, false
+	}
+
+	tok := s.tokens[0]
+	s.tokens = s.tokens[1:]
+
+	return tok, true
+}
+
+func (s *rdataScanner) done() error {
+	if s.err == nil && len(s.tokens) > 0 {
+		s.fail("unexpected field %q", s.tokens[0].raw)
+	}
+
+	return s.err
+}
+
+func (s *rdataScanner) uint(bitSize int) uint64 {
+	tok, ok := s.next()
+	if !ok {
+		return 0
+	}
+
+	v, err := strconv.ParseUint(tok.raw, 10, bitSize)
+	if err != nil {
+		s.fail("invalid %d-bit number %q", bitSize, tok.raw)
+	}
+
+	return v
+}
+
+func (s *rdataScanner) uint8() uint8   { return uint8(s.uint(8)) }
+func (s *rdataScanner) uint16() uint16 { return uint16(s.uint(16)) }
+func (s *rdataScanner) uint32() uint32 { return uint32(s.uint(32)) }
+
+func (s *rdataScanner) name() string {
+	tok, ok := s.next()
+	if !ok {
+		return ""
+	}
+
+	name, err := parseName(tok)
+	if err != nil {
+		s.fail("%v", err)
+	}
+
+	return name
+}
+
+// text returns an unescaped field, the field can be quoted.
+func (s *rdataScanner) text() string {
+	tok, ok := s.next()
+	if !ok {
+		return ""
+	}
+
+	v, err := unescape(tok.raw)
+	if err != nil {
+		s.fail("%v", err)
+	}
+
+	return v
+}
+
+func (s *rdataScanner) characterString() string {
+	v := s.text()
+	if len(v) > 255 {
+		s.fail("character string is too long")
+	}
+
+	return v
+}
+
+func (s *rdataScanner) addr() netip.Addr {
+	tok, ok := s.next()
+	if !ok {
+		return netip.Addr{}
+	}
+
+	addr, err := netip.ParseAddr(tok.raw)
+	if err != nil {
+		s.fail("%v", err)
+	}
+
+	return addr
+}
+
+func (s *rdataScanner) qType() QType {
+	tok, ok := s.next()
+	if !ok {
+		return 0
+	}
+
+	t, ok := parseType(tok.raw)
+	if !ok {
+		s.fail("unknown type %q", tok.raw)
+	}
+
+	return t
+}
+
+// types returns all the rest fields as types.
+func (s *rdataScanner) types() []QType {
+	var out []QType
+	for s.err == nil && len(s.tokens) > 0 {
+		out = append(out, s.qType())
+	}
+
+	return out
+}
+
+// rest returns all the rest fields concatenated, binary data can
+// be split into several fields by whitespaces.
+func (s *rdataScanner) rest() string {
+	if s.err != nil {
+		return ""
+	}
+
+	if len(s.tokens) == 0 {
+		s.fail("not enough fields")
+		return ""
+	}
+
+	var b strings.Builder
+	for _, el := range s.tokens {
+		b.WriteString(el.raw)
+	}
+	s.tokens = nil
+
+	return b.String()
+}
+
+func (s *rdataScanner) hex() []byte {
+	v, err := hex.DecodeString(s.rest())
+	if err != nil {
+		s.fail("%v", err)
+	}
+
+	return v
+}
+
+func (s *rdataScanner) base64() []byte {
+	v, err := base64.StdEncoding.DecodeString(s.rest())
+	if err != nil {
+		s.fail("%v", err)
+	}
+
+	return v
+}
+
+func (s *rdataScanner) base32Hex() []byte {
+	tok, ok := s.next()
+	if !ok {
+		return nil
+	}
+
+	v, err := base32HexNoPadding.DecodeString(strings.ToUpper(tok.raw))
+	if err != nil {
+		s.fail("%v", err)
+	}
+
+	return v
+}
+
+func (s *rdataScanner) salt() []byte {
+	tok, ok := s.next()
+	if !ok || tok.raw == "-" {
+		return nil
+	}
+
+	v, err := hex.DecodeString(tok.raw)
+	if err != nil {
+		s.fail("%v", err)
+	}
+
+	return v
+}
+
+// signatureTime parses time in either YYYYMMDDHHmmSS format
+// or as number of seconds since 1 January 1970 00:00:00 UTC.
+func (s *rdataScanner) signatureTime() uint32 {
+	tok, ok := s.next()
+	if !ok {
+		return 0
+	}
+
+	if len(tok.raw) == 14 {
+		v, err := time.Parse("20060102150405", tok.raw)
+		if err != nil {
+			s.fail("%v", err)
+		}
+
+		return uint32(v.Unix())
+	}
+
+	v, err := strconv.ParseUint(tok.raw, 10, 32)
+	if err != nil {
+		s.fail("invalid signature time %q", tok.raw)
+	}
+
+	return uint32(v)
+}
+
+// loc parses LOC record data (RFC 1876 section 3):
+//
+//	d1 [m1 [s1]] {"N"|"S"} d2 [m2 [s2]] {"E"|"W"} alt["m"] [siz["m"] [hp["m"] [vp["m"]]]]
+func (s *rdataScanner) loc() *LOC {
+	const (
+		equator      = 1 << 31
+		altitudeBase = 100000 * 100
+	)
+
+	coordinate := func(positive, negative string) uint32 {
+		var parts []float64
+
+		for {
+			tok, ok := s.next()
+			if !ok {
+				return 0
+			}
+
+			switch strings.ToUpper(tok.raw) {
+			case positive, negative:
+				if len(parts) == 0 {
+					s.fail("coordinate has no degrees")
+				}
+
+				for len(parts) < 3 {
+					parts = append(parts, 0)
+				}
+
+				millis := int64(math.Round(((parts[0]*60+parts[1])*60 + parts[2]) * 1000))
+				if strings.ToUpper(tok.raw) == negative {
+					millis = -millis
+				}
+
+				return uint32(equator + millis)
+			}
+
+			if len(parts) == 3 {
+				s.fail("unexpected coordinate field %q", tok.raw)
+				return 0
+			}
+
+			v, err := strconv.ParseFloat(tok.raw, 64)
+			if err != nil {
+				s.fail("invalid coordinate field %q", tok.raw)
+				return 0
+			}
+
+			parts = append(parts, v)
+		}
+	}
+
+	centimeters := func(tok token) int64 {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(tok.raw, "m"), 64)
+		if err != nil {
+			s.fail("invalid distance %q", tok.raw)
+		}
+
+		return int64(math.Round(v * 100))
+	}
+
+	precision := func(tok token) uint8 {
+		cm := centimeters(tok)
+
+		var exponent uint8
+		for cm > 9 && exponent < 9 {
+			cm /= 10
+			exponent++
+		}
+
+		if cm > 9 || cm < 0 {
+			s.fail("invalid precision %q", tok.raw)
+		}
+
+		return uint8(cm)<<4 | exponent
+	}
+
+	out := &LOC{
+		Latitude:  coordinate("N", "S"),
+		Longitude: coordinate("E", "W"),
+
+		// Defaults are 1m for size, 10000m for horizontal
+		// precision and 10m for vertical one.
+		Size:     0x12,
+		HorizPre: 0x16,
+		VertPre:  0x13,
+	}
+
+	if tok, ok := s.next(); ok {
+		out.Altitude = uint32(centimeters(tok) + altitudeBase)
+	}
+
+	for _, field := range []*uint8{&out.Size, &out.HorizPre, &out.VertPre} {
+		if s.err != nil || len(s.tokens) == 0 {
+			break
+		}
+
+		tok, _ := s.next()
+		*field = precision(tok)
+	}
+
+	return out
+}
+
+// svcb parses SVCB record data (RFC 9460 section 2.1):
+//
+//	SvcPriority TargetName SvcParams
+//
+// where SvcParams is a whitespace-separated list of key=value
+// pairs. A value can be quoted.
+func (s *rdataScanner) svcb() *SVCB {
+	out := &SVCB{Priority: s.uint16(), Target: s.name()}
+
+	for s.err == nil && len(s.tokens) > 0 {
+		tok, _ := s.next()
+
+		key, value, hasValue := strings.Cut(tok.raw, "=")
+
+		// The tokenizer splits key="value" into two tokens.
+		if hasValue && value == "" && len(s.tokens) > 0 && s.tokens[0].quoted {
+			value = s.tokens[0].raw
+			s.tokens = s.tokens[1:]
+		}
+
+		param, err := parseSVCBParam(key, value, hasValue)
+		if err != nil {
+			s.fail("%v", err)
+			break
+		}
+
+		out.Params = append(out.Params, param)
+	}
+
+	return out
+}
+
+func parseSVCBParamKey(s string) (SVCBParamKey, error) {
+	for key, name := range svcbParamKeyNames {
+		if name == s {
+			return key, nil
+		}
+	}
+
+	if v, ok := strings.CutPrefix(s, "key"); ok {
+		key, err := strconv.ParseUint(v, 10, 16)
+		if err == nil {
+			return SVCBParamKey(key), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown svcb param key %q", s)
+}
+
+func parseSVCBParam(k, value string, hasValue bool) (SVCBParam, error) {
+	key, err := parseSVCBParamKey(k)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == SVCBParamKeyNoDefaultALPN {
+		if hasValue {
+			return nil, errors.New("svcb no-default-alpn param has no value")
+		}
+
+		return &SVCBNoDefaultALPN{}, nil
+	}
+
+	if !hasValue {
+		return nil, fmt.Errorf("svcb %v param requires value", key)
+	}
+
+	items, err := splitSVCBList(value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key {
+	case SVCBParamKeyMandatory:
+		var p SVCBMandatory
+		for _, el := range items {
+			k, err := parseSVCBParamKey(el)
+			if err != nil {
+				return nil, err
+			}
+
+			p.Keys = append(p.Keys, k)
+		}
+
+		return &p, nil
+
+	case SVCBParamKeyALPN:
+		return &SVCBALPN{IDs: items}, nil
+
+	case SVCBParamKeyPort:
+		port, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid svcb port %q", value)
+		}
+
+		return &SVCBPort{Port: uint16(port)}, nil
+
+	case SVCBParamKeyIPv4Hint, SVCBParamKeyIPv6Hint:
+		var addrs []netip.Addr
+		for _, el := range items {
+			addr, err := netip.ParseAddr(el)
+			if err != nil {
+				return nil, err
+			}
+
+			if addr.Is4() != (key == SVCBParamKeyIPv4Hint) {
+				return nil, fmt.Errorf("unexpected address %v in svcb %v param", addr, key)
+			}
+
+			addrs = append(addrs, addr)
+		}
+
+		if key == SVCBParamKeyIPv4Hint {
+			return &SVCBIPv4Hint{Addrs: addrs}, nil
+		}
+
+		return &SVCBIPv6Hint{Addrs: addrs}, nil
+
+	case SVCBParamKeyECH:
+		config, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return &SVCBECH{Config: config}, nil
+	}
+
+	data, err := unescape(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SVCBUnknownParam{K: key, Data: []byte(data)}, nil
+}
+
+// splitSVCBList splits comma-separated list of values, the
+// escaped commas do not separate elements.
+func splitSVCBList(s string) ([]string, error) {
+	var out []string
+
+	start := 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) && s[i] == '\\' {
+			i++
+			continue
+		}
+
+		if i == len(s) || s[i] == ',' {
+			item, err := unescape(s[start:i])
+			if err != nil {
+				return nil, err
+			}
+
+			out = append(out, item)
+			start = i + 1
+		}
+	}
+
+	return out, nil
+}
+
+// ParseMessage parses a message in the dig-style layout of the
+// Message.String method:
+//
+//	;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 1
+//	;; flags: qr rd ra; QUERY: 1, ANSWER: 1, AUTHORITY: 0, ADDITIONAL: 0
+//
+//	;; OPT PSEUDOSECTION:
+//	; EDNS: version: 0, flags: do; udp: 1232
+//	; COOKIE: 5E63DC37D68E6F68
+//
+//	;; QUESTION SECTION:
+//	;example.com. IN A
+//
+//	;; ANSWER SECTION:
+//	example.com. 300 IN A 93.184.216.34
+//
+// Every part is optional, the counts are ignored. Other lines that
+// start with ";" are comments. A record can be split over multiple
+// lines with parentheses.
+func ParseMessage(s string) (Message, error) {
+	var m Message
+
+	var section *[]ResourceRecord
+	inQuestion := false
+	inOPT := false
+
+	lines := strings.Split(s, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+
+		switch {
+		case line == "":
+			inOPT = false
+			continue
+
+		case strings.HasPrefix(line, ";; ->>HEADER<<-"):
+			if err := parseHeaderLine(&m, strings.TrimPrefix(line, ";; ->>HEADER<<-")); err != nil {
+				return Message{}, err
+			}
+
+		case strings.HasPrefix(line, ";; flags:"):
+			if err := parseFlagsLine(&m.Header, strings.TrimPrefix(line, ";; flags:")); err != nil {
+				return Message{}, err
+			}
+
+		case line == ";; OPT PSEUDOSECTION:":
+			inOPT = true
+			if m.EDNS == nil {
+				m.EDNS = &EDNS{}
+			}
+
+		case inOPT && strings.HasPrefix(line, ";"):
+			if err := parseOPTLine(m.EDNS, strings.TrimSpace(strings.TrimPrefix(line, ";"))); err != nil {
+				return Message{}, err
+			}
+
+		case strings.HasPrefix(line, ";;") && strings.HasSuffix(line, " SECTION:"):
+			inQuestion = false
+			section = nil
+
+			switch strings.TrimSuffix(strings.TrimPrefix(line, ";; "), " SECTION:") {
+			case "QUESTION":
+				inQuestion = true
+			case "ANSWER":
+				section = &m.Answer
+			case "AUTHORITY":
+				section = &m.Authority
+			case "ADDITIONAL":
+				section = &m.Additional
+			default:
+				return Message{}, fmt.Errorf("unknown section %q", line)
+			}
+
+		case inQuestion && strings.HasPrefix(line, ";") && !strings.HasPrefix(line, ";;"):
+			q, err := parseQuestionText(strings.TrimPrefix(line, ";"))
+			if err != nil {
+				return Message{}, err
+			}
+
+			m.Question = append(m.Question, q)
+
+		case strings.HasPrefix(line, ";"):
+			// A comment.
+
+		case section != nil:
+			// Join lines of a record split with parentheses.
+			for depth := parenDepth(line); depth > 0 && i+1 < len(lines); depth += parenDepth(lines[i]) {
+				i++
+				line += "\n" + lines[i]
+			}
+
+			r, err := ParseResourceRecord(line)
+			if err != nil {
+				return Message{}, err
+			}
+
+			*section = append(*section, r)
+
+		default:
+			return Message{}, fmt.Errorf("unexpected line %q outside of sections", line)
+		}
+	}
+
+	// OPT record in the additional section, e.g. from a zone
+	// file like input, is moved as it is done by the decoder.
+	additional, edns, err := extractEDNS(m.Additional)
+	if err != nil {
+		return Message{}, err
+	}
+
+	if edns != nil {
+		if m.EDNS != nil {
+			return Message{}, errors.New("message contains more than one opt record")
+		}
+
+		m.EDNS = edns
+	}
+
+	m.Additional = additional
+
+	return m, nil
+}
+
+// parseHeaderLine parses "opcode: QUERY, status: NOERROR, id: 1".
+func parseHeaderLine(m *Message, s string) error {
+	for _, field := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(field, ":")
+		if !ok {
+			return fmt.Errorf("invalid header field %q", field)
+		}
+
+		value = strings.TrimSpace(value)
+
+		switch strings.TrimSpace(key) {
+		case "opcode":
+			opcode, ok := parseMnemonic(opcodeMnemonics, value, "OPCODE", 15)
+			if !ok {
+				return fmt.Errorf("unknown opcode %q", value)
+			}
+
+			m.Header.Opcode = opcode
+
+		case "status":
+			rcode, ok := parseMnemonic(rcodeMnemonics, value, "RCODE", 0xfff)
+			if !ok {
+				return fmt.Errorf("unknown status %q", value)
+			}
+
+			m.Header.RCode = RCode(rcode & 0x0f)
+
+			if extended := uint8(rcode >> 4); extended != 0 {
+				if m.EDNS == nil {
+					m.EDNS = &EDNS{}
+				}
+
+				m.EDNS.ExtendedRCode = extended
+			}
+
+		case "id":
+			id, err := strconv.ParseUint(value, 10, 16)
+			if err != nil {
+				return fmt.Errorf("invalid id %q", value)
+			}
+
+			m.Header.ID = uint16(id)
+
+		default:
+			return fmt.Errorf("unknown header field %q", key)
+		}
+	}
+
+	return nil
+}
+
+// parseFlagsLine parses "qr rd ra; QUERY: 1, ANSWER: 1, ...",
+// the counts are ignored.
+func parseFlagsLine(h *Header, s string) error {
+	flags, _, _ := strings.Cut(s, ";")
+
+	for _, flag := range strings.Fields(flags) {
+		switch flag {
+		case "qr":
+			h.Response = true
+		case "aa":
+			h.AuthoritativeAnswer = true
+		case "tc":
+			h.TruncateCation = true
+		case "rd":
+			h.RecursionDesired = true
+		case "ra":
+			h.RecursionAvailable = true
+		case "ad":
+			h.AuthenticData = true
+		case "cd":
+			h.CheckingDisabled = true
+		default:
+			return fmt.Errorf("unknown header flag %q", flag)
+		}
+	}
+
+	return nil
+}
+
+// parseOPTLine parses a line of the OPT pseudo-section, either
+// "EDNS: version: 0, flags: do; udp: 1232" or an option.
+func parseOPTLine(e *EDNS, s string) error {
+	key, value, ok := strings.Cut(s, ":")
+	if !ok {
+		return fmt.Errorf("invalid opt line %q", s)
+	}
+
+	value = strings.TrimSpace(value)
+
+	if key != "EDNS" {
+		code, ok := parseMnemonic(ednsOptionMnemonics, key, "OPT", 0xffff)
+		if !ok {
+			return fmt.Errorf("unknown edns option %q", key)
+		}
+
+		data, err := hex.DecodeString(value)
+		if err != nil {
+			return fmt.Errorf("invalid edns option %s: %v", key, err)
+		}
+
+		e.Options = append(e.Options, EDNSOption{Code: code, Data: data})
+
+		return nil
+	}
+
+	for _, part := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+		name, v, _ := strings.Cut(part, ":")
+		v = strings.TrimSpace(v)
+
+		switch strings.TrimSpace(name) {
+		case "version":
+			version, err := strconv.ParseUint(v, 10, 8)
+			if err != nil {
+				return fmt.Errorf("invalid edns version %q", v)
+			}
+
+			e.Version = uint8(version)
+
+		case "flags":
+			for _, flag := range strings.Fields(v) {
+				if flag != "do" {
+					return fmt.Errorf("unknown edns flag %q", flag)
+				}
+
+				e.DNSSECOK = true
+			}
+
+		case "udp":
+			size, err := strconv.ParseUint(v, 10, 16)
+			if err != nil {
+				return fmt.Errorf("invalid edns udp payload size %q", v)
+			}
+
+			e.UDPPayloadSize = uint16(size)
+
+		default:
+			return fmt.Errorf("unknown edns field %q", name)
+		}
+	}
+
+	return nil
+}
+
+// parseQuestionText parses "example.com. IN A", the class is optional.
+func parseQuestionText(s string) (Question, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return Question{}, err
+	}
+
+	if len(tokens) < 2 || len(tokens) > 3 {
+		return Question{}, fmt.Errorf("invalid question %q", s)
+	}
+
+	name, err := parseName(tokens[0])
+	if err != nil {
+		return Question{}, err
+	}
+
+	q := Question{Name: name, Class: ClassIN}
+
+	if len(tokens) == 3 {
+		class, ok := parseClass(tokens[1].raw)
+		if !ok {
+			return Question{}, fmt.Errorf("unknown class %q", tokens[1].raw)
+		}
+
+		q.Class = class
+	}
+
+	qType, ok := parseType(tokens[len(tokens)-1].raw)
+	if !ok {
+		return Question{}, fmt.Errorf("unknown type %q", tokens[len(tokens)-1].raw)
+	}
+
+	q.Type = qType
+
+	return q, nil
+}
+
+// parseMnemonic looks up value "s" in "mnemonics", the values
+// without mnemonic are accepted in the "<prefix><n>" form.
+func parseMnemonic[K ~uint8 | ~uint16](mnemonics map[K]string, s, prefix string, max uint64) (K, bool) {
+	for k, mnemonic := range mnemonics {
+		if mnemonic == s {
+			return k, true
+		}
+	}
+
+	if v, ok := strings.CutPrefix(s, prefix); ok {
+		n, err := strconv.ParseUint(v, 10, 16)
+		if err == nil && n <= max {
+			return K(n), true
+		}
+	}
+
+	return 0, false
+}
+
+// parenDepth returns the difference between the number of opening
+// and closing parentheses outside of quotes and comments.
+func parenDepth(line string) int {
+	depth := 0
+	quoted := false
+
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; {
+		case ch == '\\':
+			i++
+		case ch == '"':
+			quoted = !quoted
+		case quoted:
+		case ch == ';':
+			return depth
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+		}
+	}
+
+	return depth
+}
@@ -26,6 +26,10 @@ type Message struct {
 	Answer     []ResourceRecord
 	Authority  []ResourceRecord
 	Additional []ResourceRecord
+
+	// EDNS is the OPT pseudo-record of the additional section,
+	// nil if the message does not use EDNS(0). See EDNS type.
+	EDNS *EDNS
 }
 
 // Header Section Format
@@ -35,7 +39,7 @@ type Message struct {
 //	+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 //	|                      ID                       |
 //	+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
-//	|QR|   Opcode  |AA|TC|RD|RA|   Z    |   RCODE   |
+//	|QR|   Opcode  |AA|TC|RD|RA| Z|AD|CD|   RCODE   |
 //	+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 //	|                    QDCOUNT                    |
 //	+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
@@ -91,8 +95,20 @@ type Header struct {
 	// recursive query support is available in the name server.
 	RecursionAvailable bool
 
+	// Z is reserved for future use. Must be zero in all queries
+	// and responses. Only the lowest bit of the value is used.
 	Z byte
 
+	// AuthenticData (AD) bit indicates in a response that all
+	// the data included in the answer and authority sections
+	// has been authenticated by the server (RFC 4035 section 3.2.3).
+	AuthenticData bool
+
+	// CheckingDisabled (CD) bit indicates in a query that
+	// pending (non-authenticated) data is acceptable to the
+	// resolver sending the query (RFC 4035 section 3.2.2).
+	CheckingDisabled bool
+
 	// RCode is a 4 bit field is set as part of responses. The
 	// values have the following interpretation:
 	//
@@ -125,6 +141,10 @@ type Header struct {
 
 	// QDCount is an integer specifying the number of
 	// entries in the question section.
+	//
+	// The count fields are filled by the decoder, the encoder
+	// calculates them based on the message sections itself
+	// and ignores the values.
 	QDCount uint16
 
 	// ANCount is an integer specifying the number of
@@ -137,7 +157,8 @@ type Header struct {
 	NSCount uint16
 
 	// ARCount is an integer specifying the number of
-	// resource records in the additional records section.
+	// resource records in the additional records section
+	// including the OPT pseudo-record.
 	ARCount uint16
 }
 
@@ -209,8 +230,14 @@ type ResourceRecord struct {
 	// increased back to its former value following the change.
 	TTL uint32
 
+	// RDLength is the length in octets of the RData field. It is
+	// filled by the decoder, the encoder calculates the length
+	// itself and ignores the value.
 	RDLength uint16
-	RData    string
+
+	// RData describes the resource. See RData interface and its
+	// implementations for details.
+	RData RData
 }
 
 //go:generate stringer -type=QClass
@@ -251,10 +278,64 @@ const (
 	// to the Internet class that stores a single IPv6 address.
 	QTypeAAAA QType = 28
 
+	// QTypeLOC (RFC 1876) stores geographical location of a host.
+	QTypeLOC QType = 29
+
+	// QTypeSRV (RFC 2782) specifies the location of the server(s)
+	// for a specific protocol and domain.
+	QTypeSRV QType = 33
+
+	// QTypeNAPTR (RFC 3403) is the Naming Authority Pointer record.
+	QTypeNAPTR QType = 35
+
+	// QTypeOPT (RFC 6891) is a pseudo-record type of EDNS(0).
+	QTypeOPT QType = 41
+
+	// QTypeDS (RFC 4034) is the Delegation Signer record.
+	QTypeDS QType = 43
+
+	// QTypeSSHFP (RFC 4255) publishes SSH public key fingerprints.
+	QTypeSSHFP QType = 44
+
+	// QTypeRRSIG (RFC 4034) stores a DNSSEC signature of an RRset.
+	QTypeRRSIG QType = 46
+
+	// QTypeNSEC (RFC 4034) is used for authenticated denial of existence.
+	QTypeNSEC QType = 47
+
+	// QTypeDNSKEY (RFC 4034) stores a public key of a zone.
+	QTypeDNSKEY QType = 48
+
+	// QTypeNSEC3 (RFC 5155) is used for authenticated denial of
+	// existence with hashed owner names.
+	QTypeNSEC3 QType = 50
+
+	// QTypeNSEC3PARAM (RFC 5155) contains the NSEC3 parameters
+	// of a zone.
+	QTypeNSEC3PARAM QType = 51
+
+	// QTypeTLSA (RFC 6698) associates a TLS server certificate
+	// or public key with the domain name (DANE).
+	QTypeTLSA QType = 52
+
+	// QTypeSVCB (RFC 9460) is the general-purpose Service Binding record.
+	QTypeSVCB QType = 64
+
+	// QTypeHTTPS (RFC 9460) is the SVCB-compatible record type for
+	// the "https" and "http" schemes.
+	QTypeHTTPS QType = 65
+
 	QTypeAXFR  QType = 252
 	QTypeMAILB QType = 253
 	QTypeMAILA QType = 254
 	QTypeALL   QType = 255
+
+	// QTypeURI (RFC 7553) maps a domain name to an URI.
+	QTypeURI QType = 256
+
+	// QTypeCAA (RFC 8659) specifies the Certification Authorities
+	// authorized to issue certificates for the domain.
+	QTypeCAA QType = 257
 )
 
 //go:generate stringer -type RCode
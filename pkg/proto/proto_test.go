@@ -1,7 +1,11 @@
 package proto
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"net"
+	"net/netip"
 	"os"
 	"testing"
 
@@ -95,7 +99,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      63,
 					RDLength: 4,
-					RData:    "142.250.150.100",
+					RData:    &A{Addr: netip.MustParseAddr("142.250.150.100")},
 				},
 				{
 					Name:     "google.com",
@@ -103,7 +107,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      63,
 					RDLength: 4,
-					RData:    "142.250.150.138",
+					RData:    &A{Addr: netip.MustParseAddr("142.250.150.138")},
 				},
 				{
 					Name:     "google.com",
@@ -111,7 +115,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      63,
 					RDLength: 4,
-					RData:    "142.250.150.139",
+					RData:    &A{Addr: netip.MustParseAddr("142.250.150.139")},
 				},
 				{
 					Name:     "google.com",
@@ -119,7 +123,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      63,
 					RDLength: 4,
-					RData:    "142.250.150.102",
+					RData:    &A{Addr: netip.MustParseAddr("142.250.150.102")},
 				},
 				{
 					Name:     "google.com",
@@ -127,7 +131,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      63,
 					RDLength: 4,
-					RData:    "142.250.150.101",
+					RData:    &A{Addr: netip.MustParseAddr("142.250.150.101")},
 				},
 				{
 					Name:     "google.com",
@@ -135,7 +139,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      63,
 					RDLength: 4,
-					RData:    "142.250.150.113",
+					RData:    &A{Addr: netip.MustParseAddr("142.250.150.113")},
 				},
 			},
 			Authority:  []ResourceRecord{},
@@ -153,8 +157,6 @@ func TestDecodeEncodeMessage(t *testing.T) {
 	})
 
 	t.Run("standard-query.query.A.yahoo.com.opt.cookie", func(t *testing.T) {
-		t.Skipf("fail without EDNS implementation")
-
 		buf, err := os.ReadFile("testdata/standard-query.query.A.yahoo.com.opt.cookie")
 		testing2.FailIfError(t, err)
 
@@ -171,6 +173,8 @@ func TestDecodeEncodeMessage(t *testing.T) {
 				TruncateCation:      false,
 				RecursionDesired:    true,
 				RecursionAvailable:  false,
+				Z:                   0,
+				AuthenticData:       true,
 				RCode:               RCodeNoErrorCondition,
 				QDCount:             1,
 				ARCount:             1,
@@ -182,21 +186,31 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class: ClassIN,
 				},
 			},
-			Answer:    []ResourceRecord{},
-			Authority: []ResourceRecord{},
-			Additional: []ResourceRecord{
-				{
-					Type: 41, // todo: EDNS
+			Answer:     []ResourceRecord{},
+			Authority:  []ResourceRecord{},
+			Additional: []ResourceRecord{},
+			EDNS: &EDNS{
+				UDPPayloadSize: 4096,
+				Options: []EDNSOption{
+					{
+						Code: EDNSOptionCodeCookie,
+						Data: []byte{0x5e, 0x63, 0x37, 0x26, 0xd6, 0x8e, 0x6f, 0x68},
+					},
 				},
 			},
 		}
 
 		testing2.Assert(t, got, want)
+
+		enc := NewEncoder(make([]byte, 512))
+		outBuf, err := enc.Encode(got)
+
+		testing2.ThisIsFine(t, err)
+
+		testing2.Assert(t, outBuf, buf)
 	})
 
 	t.Run("standard-query.response.A.yahoo.com.opt.cookie", func(t *testing.T) {
-		t.Skipf("fail without ENDS implementation")
-
 		buf, err := os.ReadFile("testdata/standard-query.response.A.yahoo.com.opt.cookie")
 		testing2.FailIfError(t, err)
 
@@ -228,22 +242,28 @@ func TestDecodeEncodeMessage(t *testing.T) {
 				},
 			},
 			Answer: []ResourceRecord{
-				{Name: "yahoo.com", Type: QTypeA, Class: ClassIN, TTL: 1214, RDLength: 4, RData: "74.6.143.25"},
-				{Name: "yahoo.com", Type: QTypeA, Class: ClassIN, TTL: 1214, RDLength: 4, RData: "98.137.11.164"},
-				{Name: "yahoo.com", Type: QTypeA, Class: ClassIN, TTL: 1214, RDLength: 4, RData: "98.137.11.163"},
-				{Name: "yahoo.com", Type: QTypeA, Class: ClassIN, TTL: 1214, RDLength: 4, RData: "74.6.231.21"},
-				{Name: "yahoo.com", Type: QTypeA, Class: ClassIN, TTL: 1214, RDLength: 4, RData: "74.6.231.20"},
-				{Name: "yahoo.com", Type: QTypeA, Class: ClassIN, TTL: 1214, RDLength: 4, RData: "74.6.143.26"},
-			},
-			Authority: []ResourceRecord{},
-			Additional: []ResourceRecord{
-				{
-					Type: 41, // todo: EDNS
-				},
+				{Name: "yahoo.com", Type: QTypeA, Class: ClassIN, TTL: 1214, RDLength: 4, RData: &A{Addr: netip.MustParseAddr("74.6.143.25")}},
+				{Name: "yahoo.com", Type: QTypeA, Class: ClassIN, TTL: 1214, RDLength: 4, RData: &A{Addr: netip.MustParseAddr("98.137.11.164")}},
+				{Name: "yahoo.com", Type: QTypeA, Class: ClassIN, TTL: 1214, RDLength: 4, RData: &A{Addr: netip.MustParseAddr("98.137.11.163")}},
+				{Name: "yahoo.com", Type: QTypeA, Class: ClassIN, TTL: 1214, RDLength: 4, RData: &A{Addr: netip.MustParseAddr("74.6.231.21")}},
+				{Name: "yahoo.com", Type: QTypeA, Class: ClassIN, TTL: 1214, RDLength: 4, RData: &A{Addr: netip.MustParseAddr("74.6.231.20")}},
+				{Name: "yahoo.com", Type: QTypeA, Class: ClassIN, TTL: 1214, RDLength: 4, RData: &A{Addr: netip.MustParseAddr("74.6.143.26")}},
+			},
+			Authority:  []ResourceRecord{},
+			Additional: []ResourceRecord{},
+			EDNS: &EDNS{
+				UDPPayloadSize: 512,
 			},
 		}
 
 		testing2.Assert(t, got, want)
+
+		enc := NewEncoder(make([]byte, 512))
+		outBuf, err := enc.Encode(got)
+
+		testing2.ThisIsFine(t, err)
+
+		testing2.Assert(t, outBuf, buf)
 	})
 
 	t.Run("standard-query.response.soa.com", func(t *testing.T) {
@@ -285,7 +305,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 20,
-					RData:    "a.gtld-servers.net",
+					RData:    &NS{Host: "a.gtld-servers.net"},
 				},
 				{
 					Name:     "com",
@@ -293,7 +313,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "b.gtld-servers.net",
+					RData:    &NS{Host: "b.gtld-servers.net"},
 				},
 				{
 					Name:     "com",
@@ -301,7 +321,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "c.gtld-servers.net",
+					RData:    &NS{Host: "c.gtld-servers.net"},
 				},
 				{
 					Name:     "com",
@@ -309,7 +329,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "d.gtld-servers.net",
+					RData:    &NS{Host: "d.gtld-servers.net"},
 				},
 				{
 					Name:     "com",
@@ -317,7 +337,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "e.gtld-servers.net",
+					RData:    &NS{Host: "e.gtld-servers.net"},
 				},
 				{
 					Name:     "com",
@@ -325,7 +345,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "f.gtld-servers.net",
+					RData:    &NS{Host: "f.gtld-servers.net"},
 				},
 				{
 					Name:     "com",
@@ -333,7 +353,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "g.gtld-servers.net",
+					RData:    &NS{Host: "g.gtld-servers.net"},
 				},
 				{
 					Name:     "com",
@@ -341,7 +361,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "h.gtld-servers.net",
+					RData:    &NS{Host: "h.gtld-servers.net"},
 				},
 				{
 					Name:     "com",
@@ -349,7 +369,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "i.gtld-servers.net",
+					RData:    &NS{Host: "i.gtld-servers.net"},
 				},
 				{
 					Name:     "com",
@@ -357,7 +377,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "j.gtld-servers.net",
+					RData:    &NS{Host: "j.gtld-servers.net"},
 				},
 				{
 					Name:     "com",
@@ -365,7 +385,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "k.gtld-servers.net",
+					RData:    &NS{Host: "k.gtld-servers.net"},
 				},
 				{
 					Name:     "com",
@@ -373,7 +393,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "l.gtld-servers.net",
+					RData:    &NS{Host: "l.gtld-servers.net"},
 				},
 				{
 					Name:     "com",
@@ -381,7 +401,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "m.gtld-servers.net",
+					RData:    &NS{Host: "m.gtld-servers.net"},
 				},
 			},
 			Additional: []ResourceRecord{
@@ -391,7 +411,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "192.5.6.30",
+					RData:    &A{Addr: netip.MustParseAddr("192.5.6.30")},
 				},
 				{
 					Name:     "b.gtld-servers.net",
@@ -399,7 +419,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "192.33.14.30",
+					RData:    &A{Addr: netip.MustParseAddr("192.33.14.30")},
 				},
 				{
 					Name:     "c.gtld-servers.net",
@@ -407,7 +427,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "192.26.92.30",
+					RData:    &A{Addr: netip.MustParseAddr("192.26.92.30")},
 				},
 				{
 					Name:     "d.gtld-servers.net",
@@ -415,7 +435,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "192.31.80.30",
+					RData:    &A{Addr: netip.MustParseAddr("192.31.80.30")},
 				},
 				{
 					Name:     "e.gtld-servers.net",
@@ -423,7 +443,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "192.12.94.30",
+					RData:    &A{Addr: netip.MustParseAddr("192.12.94.30")},
 				},
 				{
 					Name:     "f.gtld-servers.net",
@@ -431,7 +451,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "192.35.51.30",
+					RData:    &A{Addr: netip.MustParseAddr("192.35.51.30")},
 				},
 				{
 					Name:     "g.gtld-servers.net",
@@ -439,7 +459,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "192.42.93.30",
+					RData:    &A{Addr: netip.MustParseAddr("192.42.93.30")},
 				},
 				{
 					Name:     "h.gtld-servers.net",
@@ -447,7 +467,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "192.54.112.30",
+					RData:    &A{Addr: netip.MustParseAddr("192.54.112.30")},
 				},
 				{
 					Name:     "i.gtld-servers.net",
@@ -455,7 +475,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "192.43.172.30",
+					RData:    &A{Addr: netip.MustParseAddr("192.43.172.30")},
 				},
 				{
 					Name:     "j.gtld-servers.net",
@@ -463,7 +483,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "192.48.79.30",
+					RData:    &A{Addr: netip.MustParseAddr("192.48.79.30")},
 				},
 				{
 					Name:     "k.gtld-servers.net",
@@ -471,7 +491,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "192.52.178.30",
+					RData:    &A{Addr: netip.MustParseAddr("192.52.178.30")},
 				},
 				{
 					Name:     "l.gtld-servers.net",
@@ -479,7 +499,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "192.41.162.30",
+					RData:    &A{Addr: netip.MustParseAddr("192.41.162.30")},
 				},
 				{
 					Name:     "m.gtld-servers.net",
@@ -487,7 +507,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 4,
-					RData:    "192.55.83.30",
+					RData:    &A{Addr: netip.MustParseAddr("192.55.83.30")},
 				},
 				{
 					Name:     "a.gtld-servers.net",
@@ -495,7 +515,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 16,
-					RData:    "2001:0503:a83e:0000:0000:0000:0002:0030",
+					RData:    &AAAA{Addr: netip.MustParseAddr("2001:503:a83e::2:30")},
 				},
 				{
 					Name:     "b.gtld-servers.net",
@@ -503,7 +523,7 @@ func TestDecodeEncodeMessage(t *testing.T) {
 					Class:    ClassIN,
 					TTL:      172800,
 					RDLength: 16,
-					RData:    "2001:0503:231d:0000:0000:0000:0002:0030",
+					RData:    &AAAA{Addr: netip.MustParseAddr("2001:503:231d::2:30")},
 				},
 			},
 		}
@@ -523,6 +543,729 @@ func TestDecodeEncodeMessage(t *testing.T) {
 	})
 }
 
+func TestEncodeDecodeResourceData(t *testing.T) {
+	cases := []struct {
+		name  string
+		rData RData
+	}{
+		{
+			name: "mx",
+			rData: &MX{
+				Preference: 10,
+				Exchange:   "mail.example.com",
+			},
+		},
+		{
+			name: "txt",
+			rData: &TXT{
+				Data: []string{"v=spf1 -all", "", "second string"},
+			},
+		},
+		{
+			name: "minfo",
+			rData: &MINFO{
+				RMailBx: "admin.example.com",
+				EMailBx: "errors.example.com",
+			},
+		},
+		{
+			name: "soa",
+			rData: &SOA{
+				MName:   "ns.example.com",
+				RName:   "hostmaster.example.com",
+				Serial:  2022061101,
+				Refresh: 7200,
+				Retry:   3600,
+				Expire:  1209600,
+				Minimum: 3600,
+			},
+		},
+		{
+			name: "hinfo",
+			rData: &HINFO{
+				CPU: "ARM64",
+				OS:  "Linux",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := Message{
+				Header: Header{
+					ID:       1,
+					Response: true,
+					QDCount:  1,
+					ANCount:  1,
+				},
+				Question: []Question{
+					{Name: "example.com", Type: tc.rData.Type(), Class: ClassIN},
+				},
+				Answer: []ResourceRecord{
+					{Name: "example.com", Type: tc.rData.Type(), Class: ClassIN, TTL: 300, RData: tc.rData},
+				},
+			}
+
+			buf, err := NewEncoder(make([]byte, 512)).Encode(in)
+			testing2.FailIfError(t, err)
+
+			got, err := NewDecoder().Decode(buf)
+			testing2.FailIfError(t, err)
+
+			testing2.Assert(t, got.Answer[0].RData, tc.rData)
+			testing2.Assert(t, int(got.Answer[0].RDLength), len(buf)-headerAndAnswerPrefixSize)
+		})
+	}
+}
+
+func TestEncodeDecodeEDNS(t *testing.T) {
+	in := Message{
+		Header: Header{ID: 1, RecursionDesired: true},
+		Question: []Question{
+			{Name: "example.com", Type: QTypeA, Class: ClassIN},
+		},
+		EDNS: &EDNS{
+			UDPPayloadSize: 1232,
+			ExtendedRCode:  1,
+			DNSSECOK:       true,
+			Options: []EDNSOption{
+				{Code: EDNSOptionCodePadding, Data: []byte{0, 0, 0}},
+				{Code: EDNSOptionCodeTCPKeepalive, Data: []byte{}},
+			},
+		},
+	}
+
+	buf, err := NewEncoder(make([]byte, 512)).Encode(in)
+	testing2.FailIfError(t, err)
+
+	got, err := NewDecoder().Decode(buf)
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, got.Header.ARCount, uint16(1))
+	testing2.Assert(t, got.Additional, []ResourceRecord{})
+	testing2.Assert(t, got.EDNS, in.EDNS)
+	testing2.Assert(t, got.ExtendedRCode(), uint16(16))
+}
+
+func TestDecodeEncodeUnknownType(t *testing.T) {
+	buf := []byte{
+		0x00, 0x01, 0x84, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, // header
+		0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x00, // name
+		0xff, 0x00, 0x00, 0x01, 0x00, 0x00, 0x0e, 0x10, 0x00, 0x05, // TYPE65280 IN 3600
+		0xc0, 0x0c, 0x01, 0x02, 0x03, // rdata that looks like a pointer
+		0xc0, 0x0c, // name
+		0xff, 0x01, 0x00, 0x01, 0x00, 0x00, 0x0e, 0x10, 0x00, 0x00, // TYPE65281 IN 3600
+	}
+
+	got, err := NewDecoder().Decode(buf)
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, got.Answer[0].RData, RData(&Unknown{T: 65280, Data: []byte{0xc0, 0x0c, 0x01, 0x02, 0x03}}))
+	testing2.Assert(t, got.Answer[0].RData.String(), `\# 5 c00c010203`)
+	testing2.Assert(t, got.Answer[1].RData, RData(&Unknown{T: 65281, Data: []byte{}}))
+	testing2.Assert(t, got.Answer[1].RData.String(), `\# 0`)
+
+	outBuf, err := NewEncoder(make([]byte, 512)).Encode(got)
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, outBuf, buf)
+}
+
+func TestDecodeRDLengthMismatch(t *testing.T) {
+	buf := []byte{
+		0x00, 0x01, 0x84, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, // header
+		0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x00, // name
+		0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x0e, 0x10, 0x00, 0x05, // A IN 3600, RDLENGTH is 5
+		0x7f, 0x00, 0x00, 0x01, 0x00,
+	}
+
+	if _, err := NewDecoder().Decode(buf); !errors.Is(err, ErrRDataLength) {
+		t.Fatalf("decoder must fail on A record with 5 bytes of rdata, got %v", err)
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	header := func(qd, an uint16) []byte {
+		return []byte{0x00, 0x01, 0x00, 0x00, byte(qd >> 8), byte(qd), byte(an >> 8), byte(an), 0x00, 0x00, 0x00, 0x00}
+	}
+	question := func(name ...byte) []byte {
+		return append(append(header(1, 0), name...), 0x00, 0x01, 0x00, 0x01)
+	}
+
+	long := header(1, 0)
+	for i := 0; i < 5; i++ {
+		long = append(long, 63)
+		long = append(long, make([]byte, 63)...)
+	}
+	long = append(long, 0x00, 0x00, 0x01, 0x00, 0x01)
+
+	// The NULL record data at offset 23 is a label followed by a pointer
+	// to the label, the owner of the second record points to the data.
+	loop := append(header(0, 2), 0x00, 0x00, 0x0a, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04)
+	loop = append(loop, 0x01, 'a', 0xc0, 23)
+	loop = append(loop, 0xc0, 23, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00)
+
+	cases := []struct {
+		name string
+		in   []byte
+		want error
+	}{
+		{name: "empty", in: nil, want: ErrTruncated},
+		{name: "short header", in: header(0, 0)[:11], want: ErrTruncated},
+		{name: "forged counts", in: append(header(0xffff, 0xffff), 0x00), want: ErrTruncated},
+		{name: "truncated name", in: question(0x07, 'e', 'x'), want: ErrTruncated},
+		{name: "pointer to itself", in: question(0xc0, 0x0c), want: ErrForwardPointer},
+		{name: "forward pointer", in: question(0xc0, 0x20), want: ErrForwardPointer},
+		{name: "pointer loop", in: question(0x01, 'a', 0xc0, 0x0c), want: ErrPointerLoop},
+		{name: "two pointers loop", in: loop, want: ErrPointerLoop},
+		{name: "reserved label type", in: question(0x40, 'a', 0x00), want: ErrLabelType},
+		{name: "name too long", in: long, want: ErrNameTooLong},
+		{name: "rdata overflow", in: answerPacket(QTypeA, []byte{0x7f, 0x00, 0x00, 0x01})[:37], want: ErrTruncated},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewDecoder().Decode(tc.in)
+			if !errors.Is(err, tc.want) || !errors.Is(err, ErrFormat) {
+				t.Fatalf("want %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestDecodeEncodeModernTypes(t *testing.T) {
+	fingerprint := []byte{
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+	}
+
+	cases := []struct {
+		name  string
+		qType QType
+		rData []byte
+		want  RData
+		text  string
+	}{
+		{
+			name:  "srv",
+			qType: QTypeSRV,
+			rData: []byte{
+				0x00, 0x0a, 0x00, 0x3c, 0x13, 0xc4, 0x03, 0x73, 0x69, 0x70, 0x07, 0x65, 0x78, 0x61, 0x6d, 0x70,
+				0x6c, 0x65, 0x03, 0x63, 0x6f, 0x6d, 0x00,
+			},
+			want: &SRV{Priority: 10, Weight: 60, Port: 5060, Target: "sip.example.com"},
+			text: "10 60 5060 sip.example.com.",
+		},
+		{
+			name:  "naptr",
+			qType: QTypeNAPTR,
+			rData: []byte{
+				0x00, 0x64, 0x00, 0x0a, 0x01, 0x53, 0x07, 0x53, 0x49, 0x50, 0x2b, 0x44, 0x32, 0x55, 0x00, 0x04,
+				0x5f, 0x73, 0x69, 0x70, 0x04, 0x5f, 0x75, 0x64, 0x70, 0x07, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c,
+				0x65, 0x03, 0x63, 0x6f, 0x6d, 0x00,
+			},
+			want: &NAPTR{
+				Order:       100,
+				Preference:  10,
+				Flags:       "S",
+				Services:    "SIP+D2U",
+				Regexp:      "",
+				Replacement: "_sip._udp.example.com",
+			},
+			text: `100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`,
+		},
+		{
+			name:  "sshfp",
+			qType: QTypeSSHFP,
+			rData: append([]byte{0x04, 0x02}, fingerprint...),
+			want:  &SSHFP{Algorithm: 4, FPType: 2, Fingerprint: fingerprint},
+			text:  "4 2 101112131415161718191A1B1C1D1E1F202122232425262728292A2B2C2D2E2F",
+		},
+		{
+			name:  "tlsa",
+			qType: QTypeTLSA,
+			rData: append([]byte{0x03, 0x01, 0x01}, fingerprint...),
+			want:  &TLSA{Usage: 3, Selector: 1, MatchingType: 1, CertificateAssociationData: fingerprint},
+			text:  "3 1 1 101112131415161718191A1B1C1D1E1F202122232425262728292A2B2C2D2E2F",
+		},
+		{
+			name:  "uri",
+			qType: QTypeURI,
+			rData: []byte{
+				0x00, 0x0a, 0x00, 0x01, 0x66, 0x74, 0x70, 0x3a, 0x2f, 0x2f, 0x66, 0x74, 0x70, 0x31, 0x2e, 0x65,
+				0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x70, 0x75, 0x62, 0x6c, 0x69,
+				0x63,
+			},
+			want: &URI{Priority: 10, Weight: 1, Target: "ftp://ftp1.example.com/public"},
+			text: `10 1 "ftp://ftp1.example.com/public"`,
+		},
+		{
+			name:  "caa",
+			qType: QTypeCAA,
+			rData: []byte{
+				0x00, 0x05, 0x69, 0x73, 0x73, 0x75, 0x65, 0x6c, 0x65, 0x74, 0x73, 0x65, 0x6e, 0x63, 0x72, 0x79,
+				0x70, 0x74, 0x2e, 0x6f, 0x72, 0x67,
+			},
+			want: &CAA{Flags: 0, Tag: "issue", Value: "letsencrypt.org"},
+			text: `0 issue "letsencrypt.org"`,
+		},
+		{
+			name:  "loc",
+			qType: QTypeLOC,
+			rData: []byte{
+				0x00, 0x00, 0x16, 0x13, 0x8b, 0x3c, 0xf0, 0x18, 0x81, 0x0c, 0xbc, 0xe0, 0x00, 0x98, 0x95, 0xb8,
+			},
+			want: &LOC{
+				Version:   0,
+				Size:      0x00,
+				HorizPre:  0x16,
+				VertPre:   0x13,
+				Latitude:  2336026648,
+				Longitude: 2165095648,
+				Altitude:  9999800,
+			},
+			text: "52 22 23.000 N 4 53 32.000 E -2.00m 0.00m 10000.00m 10.00m",
+		},
+		{
+			name:  "svcb-alias-mode",
+			qType: QTypeSVCB,
+			rData: []byte{
+				0x00, 0x00, 0x03, 0x77, 0x77, 0x77, 0x07, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x03, 0x63,
+				0x6f, 0x6d, 0x00,
+			},
+			want: &SVCB{Priority: 0, Target: "www.example.com"},
+			text: "0 www.example.com.",
+		},
+		{
+			name:  "https-service-mode",
+			qType: QTypeHTTPS,
+			rData: []byte{
+				0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00, 0x01, 0x00, 0x01, 0x00, 0x06, 0x02, 0x68, 0x32,
+				0x02, 0x68, 0x33, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03, 0x00, 0x02, 0x20, 0xfb, 0x00, 0x04, 0x00,
+				0x04, 0xc0, 0x00, 0x02, 0x01, 0x00, 0x05, 0x00, 0x03, 0x01, 0x02, 0x03, 0x00, 0x06, 0x00, 0x10,
+				0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+			},
+			want: &HTTPS{SVCB{
+				Priority: 1,
+				Target:   "",
+				Params: []SVCBParam{
+					&SVCBMandatory{Keys: []SVCBParamKey{SVCBParamKeyALPN}},
+					&SVCBALPN{IDs: []string{"h2", "h3"}},
+					&SVCBNoDefaultALPN{},
+					&SVCBPort{Port: 8443},
+					&SVCBIPv4Hint{Addrs: []netip.Addr{netip.MustParseAddr("192.0.2.1")}},
+					&SVCBECH{Config: []byte{0x01, 0x02, 0x03}},
+					&SVCBIPv6Hint{Addrs: []netip.Addr{netip.MustParseAddr("2001:db8::1")}},
+				},
+			}},
+			text: "1 . mandatory=alpn alpn=h2,h3 no-default-alpn port=8443 ipv4hint=192.0.2.1 ech=AQID ipv6hint=2001:db8::1",
+		},
+		{
+			name:  "ds",
+			qType: QTypeDS,
+			rData: []byte{
+				0xec, 0x45, 0x05, 0x01, 0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b,
+				0x1c, 0x1d, 0x1e, 0x1f, 0x20, 0x21, 0x22, 0x23,
+			},
+			want: &DS{KeyTag: 60485, Algorithm: 5, DigestType: 1, Digest: fingerprint[:20]},
+			text: "60485 5 1 101112131415161718191A1B1C1D1E1F20212223",
+		},
+		{
+			name:  "dnskey",
+			qType: QTypeDNSKEY,
+			rData: append([]byte{0x01, 0x01, 0x03, 0x0d}, fingerprint...),
+			want:  &DNSKEY{Flags: 257, Protocol: 3, Algorithm: 13, PublicKey: fingerprint},
+			text:  "257 3 13 EBESExQVFhcYGRobHB0eHyAhIiMkJSYnKCkqKywtLi8=",
+		},
+		{
+			name:  "rrsig",
+			qType: QTypeRRSIG,
+			rData: []byte{
+				0x00, 0x01, 0x0d, 0x02, 0x00, 0x00, 0x0e, 0x10, 0x65, 0x53, 0xf1, 0x00, 0x64, 0xbb, 0x5a, 0x80,
+				0x30, 0x39, 0x07, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x03, 0x63, 0x6f, 0x6d, 0x00, 0x10,
+				0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f, 0x20,
+				0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+			},
+			want: &RRSIG{
+				TypeCovered: QTypeA,
+				Algorithm:   13,
+				Labels:      2,
+				OriginalTTL: 3600,
+				Expiration:  1700000000,
+				Inception:   1690000000,
+				KeyTag:      12345,
+				SignerName:  "example.com",
+				Signature:   fingerprint,
+			},
+			text: "A 13 2 3600 20231114221320 20230722042640 12345 example.com. EBESExQVFhcYGRobHB0eHyAhIiMkJSYnKCkqKywtLi8=",
+		},
+		{
+			// RFC 4034 section 4.3 example.
+			name:  "nsec",
+			qType: QTypeNSEC,
+			rData: []byte{
+				0x04, 0x68, 0x6f, 0x73, 0x74, 0x07, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x03, 0x63, 0x6f,
+				0x6d, 0x00, 0x00, 0x06, 0x40, 0x01, 0x00, 0x00, 0x00, 0x03, 0x04, 0x1b, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20,
+			},
+			want: &NSEC{
+				NextDomain: "host.example.com",
+				Types:      []QType{QTypeA, QTypeMX, QTypeRRSIG, QTypeNSEC, QType(1234)},
+			},
+			text: "host.example.com. A MX RRSIG NSEC TYPE1234",
+		},
+		{
+			name:  "nsec3",
+			qType: QTypeNSEC3,
+			rData: []byte{
+				0x01, 0x01, 0x00, 0x0c, 0x04, 0xaa, 0xbb, 0xcc, 0xdd, 0x14, 0x17, 0x4e, 0xb2, 0x40, 0x9f, 0xe2,
+				0x8b, 0xcb, 0x48, 0x87, 0xa1, 0x83, 0x6f, 0x95, 0x7f, 0x0a, 0x84, 0x25, 0xe2, 0x7b, 0x00, 0x06,
+				0x40, 0x00, 0x00, 0x00, 0x00, 0x02,
+			},
+			want: &NSEC3{
+				HashAlgorithm: 1,
+				Flags:         1,
+				Iterations:    12,
+				Salt:          []byte{0xaa, 0xbb, 0xcc, 0xdd},
+				NextHashedOwner: []byte{
+					0x17, 0x4e, 0xb2, 0x40, 0x9f, 0xe2, 0x8b, 0xcb, 0x48, 0x87,
+					0xa1, 0x83, 0x6f, 0x95, 0x7f, 0x0a, 0x84, 0x25, 0xe2, 0x7b,
+				},
+				Types: []QType{QTypeA, QTypeRRSIG},
+			},
+			text: "1 1 12 AABBCCDD 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR A RRSIG",
+		},
+		{
+			name:  "nsec3param",
+			qType: QTypeNSEC3PARAM,
+			rData: []byte{0x01, 0x00, 0x00, 0x0c, 0x04, 0xaa, 0xbb, 0xcc, 0xdd},
+			want:  &NSEC3PARAM{HashAlgorithm: 1, Flags: 0, Iterations: 12, Salt: []byte{0xaa, 0xbb, 0xcc, 0xdd}},
+			text:  "1 0 12 AABBCCDD",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := answerPacket(tc.qType, tc.rData)
+
+			got, err := NewDecoder().Decode(buf)
+			testing2.FailIfError(t, err)
+
+			testing2.Assert(t, got.Answer[0].RData, tc.want)
+			testing2.Assert(t, got.Answer[0].RData.String(), tc.text)
+
+			// The presentation format must be parsed back
+			// into the same record.
+			record := got.Answer[0]
+			record.RDLength = 0
+
+			parsed, err := ParseResourceRecord(record.String())
+			testing2.FailIfError(t, err)
+
+			testing2.Assert(t, parsed, record)
+
+			// Names in RDATA of the types must not be compressed,
+			// so the message must be encoded byte-for-byte.
+			outBuf, err := NewEncoder(make([]byte, 512)).Encode(got)
+			testing2.FailIfError(t, err)
+
+			testing2.Assert(t, outBuf, buf)
+		})
+	}
+}
+
+func TestDecodeSVCBMalformedParam(t *testing.T) {
+	buf := answerPacket(QTypeHTTPS, []byte{
+		0x00, 0x01, 0x00, // priority, target
+		0x00, 0x01, 0x00, 0x03, 0x05, 0x68, 0x32, // alpn, the id overruns the value
+		0x00, 0x03, 0x00, 0x02, 0x01, 0xbb, // port
+		0x00, 0x04, 0x00, 0x05, 0xc0, 0x00, 0x02, 0x01, 0x01, // ipv4hint, the length is not multiple of 4
+	})
+
+	got, err := NewDecoder().Decode(buf)
+	testing2.FailIfError(t, err)
+
+	// The malformed params are kept as opaque data.
+	testing2.Assert(t, got.Answer[0].RData, &HTTPS{SVCB{
+		Priority: 1,
+		Params: []SVCBParam{
+			&SVCBUnknownParam{K: SVCBParamKeyALPN, Data: []byte{0x05, 0x68, 0x32}},
+			&SVCBPort{Port: 443},
+			&SVCBUnknownParam{K: SVCBParamKeyIPv4Hint, Data: []byte{0xc0, 0x00, 0x02, 0x01, 0x01}},
+		},
+	}})
+	testing2.Assert(t, got.Answer[0].RData.String(), `1 . key1=\005h2 port=443 key4=\192\000\002\001\001`)
+
+	outBuf, err := NewEncoder(make([]byte, 512)).Encode(got)
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, outBuf, buf)
+}
+
+// answerPacket builds a response message with a single answer
+// record of type "qType" owned by "example.com" in wire format.
+func answerPacket(qType QType, rData []byte) []byte {
+	buf := []byte{
+		0x00, 0x01, 0x84, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, // header
+		0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x03, 'c', 'o', 'm', 0x00, // name
+		byte(qType >> 8), byte(qType), 0x00, 0x01, 0x00, 0x00, 0x0e, 0x10, // type, class IN, ttl 3600
+		byte(len(rData) >> 8), byte(len(rData)),
+	}
+
+	return append(buf, rData...)
+}
+
+// headerAndAnswerPrefixSize is a size of the messages built in
+// TestEncodeDecodeResourceData without RDATA of the answer: header,
+// "example.com" question and answer owner (a pointer), type, class,
+// ttl and rdlength fields.
+const headerAndAnswerPrefixSize = 12 + 17 + 2 + 2 + 2 + 4 + 2
+
+func TestEncodeSOACompression(t *testing.T) {
+	in := Message{
+		Header: Header{ID: 1, Response: true, QDCount: 1, ANCount: 1},
+		Question: []Question{
+			{Name: "example.com", Type: QTypeSOA, Class: ClassIN},
+		},
+		Answer: []ResourceRecord{
+			{
+				Name:  "example.com",
+				Type:  QTypeSOA,
+				Class: ClassIN,
+				TTL:   300,
+				RData: &SOA{MName: "ns.example.com", RName: "hostmaster.example.com", Serial: 1},
+			},
+		},
+	}
+
+	buf, err := NewEncoder(make([]byte, 512)).Encode(in)
+	testing2.FailIfError(t, err)
+
+	// Both MNAME and RNAME must reuse "example.com" from the question
+	// section: one label and a pointer for each.
+	rdLength := (1 + len("ns") + 2) + (1 + len("hostmaster") + 2) + 5*4
+
+	testing2.Assert(t, len(buf), headerAndAnswerPrefixSize+rdLength)
+}
+
+func TestDecodeEncodeHeaderDNSSECBits(t *testing.T) {
+	in := Message{
+		Header: Header{ID: 1, RecursionDesired: true, AuthenticData: true, CheckingDisabled: true},
+	}
+
+	buf, err := NewEncoder(make([]byte, 512)).Encode(in)
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, buf[2:4], []byte{0x01, 0x30})
+
+	out, err := NewDecoder().Decode(buf)
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, out.Header, in.Header)
+}
+
+func TestEncodeTruncated(t *testing.T) {
+	records := func(name string, n int) []ResourceRecord {
+		out := make([]ResourceRecord, 0, n)
+		for i := 0; i < n; i++ {
+			out = append(out, ResourceRecord{
+				Name:  name,
+				Type:  QTypeA,
+				Class: ClassIN,
+				TTL:   300,
+				RData: &A{Addr: netip.AddrFrom4([4]byte{10, 0, 0, byte(i)})},
+			})
+		}
+
+		return out
+	}
+
+	in := Message{
+		Header:   Header{ID: 1, Response: true},
+		Question: []Question{{Name: "example.com", Type: QTypeA, Class: ClassIN}},
+		Answer:   append(records("example.com", 20), records("www.example.com", 20)...),
+		EDNS:     &EDNS{UDPPayloadSize: 1232},
+	}
+
+	// Every A record takes 16 octets with the compressed name.
+	buf, err := NewEncoder(make([]byte, 512)).EncodeTruncated(in)
+	testing2.FailIfError(t, err)
+
+	out, err := NewDecoder().Decode(buf)
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, out.Header.TruncateCation, true)
+	testing2.Assert(t, len(out.Answer), 20)
+	testing2.Assert(t, out.Answer[19].Name, "example.com")
+	testing2.Assert(t, out.EDNS != nil, true)
+
+	in.Answer = in.Answer[:20]
+	in.Additional = records("ns.example.com", 20)
+
+	buf, err = NewEncoder(make([]byte, 512)).EncodeTruncated(in)
+	testing2.FailIfError(t, err)
+
+	out, err = NewDecoder().Decode(buf)
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, out.Header.TruncateCation, false)
+	testing2.Assert(t, len(out.Answer), 20)
+	testing2.Assert(t, len(out.Additional), 0)
+}
+
+func TestEncodeTruncatedAtRecordBoundary(t *testing.T) {
+	in := Message{
+		Header:   Header{ID: 1, Response: true},
+		Question: []Question{{Name: "example.com", Type: QTypeA, Class: ClassIN}},
+	}
+
+	// Every record is a separate RRset, so the records
+	// are removed one by one.
+	for i := 0; i < 4; i++ {
+		in.Answer = append(in.Answer, ResourceRecord{
+			Name:  fmt.Sprintf("host%d.example.com", i),
+			Type:  QTypeA,
+			Class: ClassIN,
+			TTL:   300,
+			RData: &A{Addr: netip.AddrFrom4([4]byte{10, 0, 0, byte(i)})},
+		})
+	}
+
+	full, err := NewEncoder(make([]byte, 512)).Encode(in)
+	testing2.FailIfError(t, err)
+
+	// The last record takes the compressed owner name "host3"
+	// (8 octets), type, class, TTL (8 octets), RDLENGTH and RDATA
+	// (6 octets). The fixed fields end 6 octets before the end.
+	fixedEnd := len(full) - 6
+
+	for _, tc := range []struct {
+		name string
+		size int
+	}{
+		{"rdlength fits", fixedEnd + 2},
+		{"half of rdlength fits", fixedEnd + 1},
+		{"fixed fields fit", fixedEnd},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			buf, err := NewEncoder(make([]byte, tc.size)).EncodeTruncated(in)
+			testing2.FailIfError(t, err)
+
+			out, err := NewDecoder().Decode(buf)
+			testing2.FailIfError(t, err)
+
+			testing2.Assert(t, out.Header.TruncateCation, true)
+			testing2.Assert(t, len(out.Answer), 3)
+		})
+	}
+
+	// No size of the buffer breaks the encoder.
+	for size := 0; size <= len(full); size++ {
+		buf, err := NewEncoder(make([]byte, size)).EncodeTruncated(in)
+		if err != nil {
+			continue
+		}
+
+		_, err = NewDecoder().Decode(buf)
+		testing2.FailIfError(t, err)
+	}
+}
+
+func TestDNSKEYKeyTag(t *testing.T) {
+	// RFC 4034 section 5.4 example.
+	key, err := base64.StdEncoding.DecodeString(
+		"AQOeiiR0GOMYkDshWoSKz9XzfwJr1AYtsmx3TGkJaNXVbfi/2pHm822aJ5iI9BMzNXxeYCmZ" +
+			"DRD99WYwYqUSdjMmmAphXdvxegXd/M5+X7OrzKBaMbCVdFLUUh6DhweJBjEVv5f2wwjM9Xzc" +
+			"nOf+EPbtG9DMBmADjFDc2w/rljwvFw==",
+	)
+	testing2.FailIfError(t, err)
+
+	rd := &DNSKEY{Flags: 256, Protocol: 3, Algorithm: 5, PublicKey: key}
+
+	testing2.Assert(t, rd.KeyTag(), uint16(60485))
+}
+
+func TestNSEC3Hash(t *testing.T) {
+	// RFC 5155 Appendix A.
+	salt := []byte{0xaa, 0xbb, 0xcc, 0xdd}
+
+	for name, want := range map[string]string{
+		"example":       "0P9MHAVEQVM6T7VBL5LOP2U3T2RP3TOM",
+		"a.example":     "35MTHGPGCU1QG68FAB165KLNSNK3DPVL",
+		"A.EXAMPLE.":    "35MTHGPGCU1QG68FAB165KLNSNK3DPVL",
+		"*.w.example":   "R53BQ7CC2UVMUBFU5OCMM6PERS9TK9EN",
+		"xx.example":    "T644EBQK9BIBCNA874GIVR6JOJ62MLHV",
+		"ns1.example":   "2T7B4G4VSA5SMI47K61MV5BV1A22BOJR",
+		"ai.example":    "GJEQE526PLBF1G8MKLP59ENFD789NJGI",
+		"y.w.example":   "JI6NEOAEPV8B5O6K4EV33ABHA8HT9FGC",
+		"x.y.w.example": "2VPTU5TIMAMQTTGL4LUU9KG21E0AOR3S",
+	} {
+		got, err := NSEC3Hash(name, 1, 12, salt)
+		testing2.FailIfError(t, err)
+
+		testing2.Assert(t, base32HexNoPadding.EncodeToString(got), want)
+	}
+}
+
+func TestCanonicalRRSet(t *testing.T) {
+	// The records must be lowercased, sorted by RDATA and
+	// deduplicated, TTL must be replaced by the original one.
+	rrset := []ResourceRecord{
+		{Name: "Example.COM", Type: QTypeMX, Class: ClassIN, TTL: 10, RData: &MX{Preference: 20, Exchange: "MAIL2.Example.com"}},
+		{Name: "example.com", Type: QTypeMX, Class: ClassIN, TTL: 20, RData: &MX{Preference: 10, Exchange: "mail1.example.com"}},
+		{Name: "example.com", Type: QTypeMX, Class: ClassIN, TTL: 30, RData: &MX{Preference: 20, Exchange: "mail2.example.com"}},
+	}
+
+	got, err := CanonicalRRSet(rrset, 3600)
+	testing2.FailIfError(t, err)
+
+	owner := []byte{0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x03, 'c', 'o', 'm', 0x00}
+	fixed := []byte{0x00, 0x0f, 0x00, 0x01, 0x00, 0x00, 0x0e, 0x10} // type MX, class IN, ttl 3600
+
+	var want []byte
+	for _, rData := range [][]byte{
+		{0x00, 0x0a, 0x05, 'm', 'a', 'i', 'l', '1', 0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x03, 'c', 'o', 'm', 0x00},
+		{0x00, 0x14, 0x05, 'm', 'a', 'i', 'l', '2', 0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x03, 'c', 'o', 'm', 0x00},
+	} {
+		want = append(want, owner...)
+		want = append(want, fixed...)
+		want = append(want, 0x00, byte(len(rData)))
+		want = append(want, rData...)
+	}
+
+	testing2.Assert(t, got, want)
+}
+
+func TestSignedDataWildcard(t *testing.T) {
+	sig := &RRSIG{
+		TypeCovered: QTypeA,
+		Algorithm:   13,
+		Labels:      2,
+		OriginalTTL: 300,
+		Expiration:  1700000000,
+		Inception:   1690000000,
+		KeyTag:      12345,
+		SignerName:  "Example.com",
+	}
+
+	rrset := []ResourceRecord{
+		{Name: "a.b.example.com", Type: QTypeA, Class: ClassIN, TTL: 10, RData: &A{Addr: netip.MustParseAddr("192.0.2.1")}},
+	}
+
+	got, err := SignedData(sig, rrset)
+	testing2.FailIfError(t, err)
+
+	want := []byte{
+		0x00, 0x01, 0x0d, 0x02, 0x00, 0x00, 0x01, 0x2c, 0x65, 0x53, 0xf1, 0x00, 0x64, 0xbb, 0x5a, 0x80,
+		0x30, 0x39, 0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x03, 'c', 'o', 'm', 0x00, // rrsig rdata
+		0x01, '*', 0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x03, 'c', 'o', 'm', 0x00, // wildcard owner
+		0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x01, 0x2c, 0x00, 0x04, 0xc0, 0x00, 0x02, 0x01,
+	}
+
+	testing2.Assert(t, got, want)
+}
+
 func BenchmarkUDPResolveAddr_Name(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		_, _ = net.ResolveUDPAddr("udp", "google.com:53")
@@ -534,3 +1277,140 @@ func BenchmarkUDPResolveAddr_IP(b *testing.B) {
 		_, _ = net.ResolveUDPAddr("udp", "1.1.1.1:53")
 	}
 }
+
+func TestDecodeAllocs(t *testing.T) {
+	buf, err := os.ReadFile("testdata/standard-query.response.soa.com")
+	testing2.FailIfError(t, err)
+
+	m, err := NewDecoder().Decode(buf)
+	testing2.FailIfError(t, err)
+
+	records := len(m.Answer) + len(m.Authority) + len(m.Additional)
+
+	dec := NewDecoder()
+
+	// The owner and RDATA names are interned by the decoder, only
+	// RDATA of every record and the slices of sections are allocated.
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := dec.Decode(buf); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if limit := float64(records + 4); allocs > limit {
+		t.Errorf("decode of %d records allocates %v times, limit is %v", records, allocs, limit)
+	}
+}
+
+func benchmarkMessage(b *testing.B, name string) ([]byte, Message) {
+	b.Helper()
+
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	m, err := NewDecoder().Decode(buf)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return buf, m
+}
+
+func BenchmarkDecodeQuery(b *testing.B) {
+	buf, _ := benchmarkMessage(b, "testdata/standard-query.query.A.yahoo.com.opt.cookie")
+
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if _, err := NewDecoder().Decode(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeResponse(b *testing.B) {
+	buf, _ := benchmarkMessage(b, "testdata/standard-query.response.soa.com")
+
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if _, err := NewDecoder().Decode(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeResponse(b *testing.B) {
+	_, m := benchmarkMessage(b, "testdata/standard-query.response.soa.com")
+	out := make([]byte, 4096)
+
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if _, err := NewEncoder(out).Encode(m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeQueryPooled(b *testing.B) {
+	buf, _ := benchmarkMessage(b, "testdata/standard-query.query.A.yahoo.com.opt.cookie")
+
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		dec := AcquireDecoder()
+		if _, err := dec.Decode(buf); err != nil {
+			b.Fatal(err)
+		}
+		ReleaseDecoder(dec)
+	}
+}
+
+func BenchmarkDecodeResponsePooled(b *testing.B) {
+	buf, _ := benchmarkMessage(b, "testdata/standard-query.response.soa.com")
+
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		dec := AcquireDecoder()
+		if _, err := dec.Decode(buf); err != nil {
+			b.Fatal(err)
+		}
+		ReleaseDecoder(dec)
+	}
+}
+
+func BenchmarkEncodeResponsePooled(b *testing.B) {
+	_, m := benchmarkMessage(b, "testdata/standard-query.response.soa.com")
+	out := make([]byte, 4096)
+
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		enc := AcquireEncoder(out)
+		if _, err := enc.Encode(m); err != nil {
+			b.Fatal(err)
+		}
+		ReleaseEncoder(enc)
+	}
+}
+
+// BenchmarkQueryRoundTrip decodes a query and encodes it back as
+// the endpoints do for every request.
+func BenchmarkQueryRoundTrip(b *testing.B) {
+	buf, _ := benchmarkMessage(b, "testdata/standard-query.query.A.yahoo.com.opt.cookie")
+	out := make([]byte, 4096)
+
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		dec := AcquireDecoder()
+		m, err := dec.Decode(buf)
+		if err != nil {
+			b.Fatal(err)
+		}
+		ReleaseDecoder(dec)
+
+		enc := AcquireEncoder(out)
+		if _, err := enc.Encode(m); err != nil {
+			b.Fatal(err)
+		}
+		ReleaseEncoder(enc)
+	}
+}
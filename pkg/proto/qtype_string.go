@@ -26,32 +26,79 @@ func _() {
 	_ = x[QTypeMX-15]
 	_ = x[QTypeTXT-16]
 	_ = x[QTypeAAAA-28]
+	_ = x[QTypeLOC-29]
+	_ = x[QTypeSRV-33]
+	_ = x[QTypeNAPTR-35]
+	_ = x[QTypeOPT-41]
+	_ = x[QTypeDS-43]
+	_ = x[QTypeSSHFP-44]
+	_ = x[QTypeRRSIG-46]
+	_ = x[QTypeNSEC-47]
+	_ = x[QTypeDNSKEY-48]
+	_ = x[QTypeNSEC3-50]
+	_ = x[QTypeNSEC3PARAM-51]
+	_ = x[QTypeTLSA-52]
+	_ = x[QTypeSVCB-64]
+	_ = x[QTypeHTTPS-65]
 	_ = x[QTypeAXFR-252]
 	_ = x[QTypeMAILB-253]
 	_ = x[QTypeMAILA-254]
 	_ = x[QTypeALL-255]
+	_ = x[QTypeURI-256]
+	_ = x[QTypeCAA-257]
 }
 
 const (
 	_QType_name_0 = "QTypeUnknownQTypeAQTypeNSQTypeMDQTypeMFQTypeCNameQTypeSOAQTypeMBQTypeMGQTypeMRQTypeNULLQTypeWKSQTypePTRQTypeHINFOQTypeMINFOQTypeMXQTypeTXT"
-	_QType_name_1 = "QTypeAAAA"
-	_QType_name_2 = "QTypeAXFRQTypeMAILBQTypeMAILAQTypeALL"
+	_QType_name_1 = "QTypeAAAAQTypeLOC"
+	_QType_name_2 = "QTypeSRV"
+	_QType_name_3 = "QTypeNAPTR"
+	_QType_name_4 = "QTypeOPT"
+	_QType_name_5 = "QTypeDSQTypeSSHFP"
+	_QType_name_6 = "QTypeRRSIGQTypeNSECQTypeDNSKEY"
+	_QType_name_7 = "QTypeNSEC3QTypeNSEC3PARAMQTypeTLSA"
+	_QType_name_8 = "QTypeSVCBQTypeHTTPS"
+	_QType_name_9 = "QTypeAXFRQTypeMAILBQTypeMAILAQTypeALLQTypeURIQTypeCAA"
 )
 
 var (
 	_QType_index_0 = [...]uint8{0, 12, 18, 25, 32, 39, 49, 57, 64, 71, 78, 87, 95, 103, 113, 123, 130, 138}
-	_QType_index_2 = [...]uint8{0, 9, 19, 29, 37}
+	_QType_index_1 = [...]uint8{0, 9, 17}
+	_QType_index_5 = [...]uint8{0, 7, 17}
+	_QType_index_6 = [...]uint8{0, 10, 19, 30}
+	_QType_index_7 = [...]uint8{0, 10, 25, 34}
+	_QType_index_8 = [...]uint8{0, 9, 19}
+	_QType_index_9 = [...]uint8{0, 9, 19, 29, 37, 45, 53}
 )
 
 func (i QType) String() string {
 	switch {
 	case i <= 16:
 		return _QType_name_0[_QType_index_0[i]:_QType_index_0[i+1]]
-	case i == 28:
-		return _QType_name_1
-	case 252 <= i && i <= 255:
+	case 28 <= i && i <= 29:
+		i -= 28
+		return _QType_name_1[_QType_index_1[i]:_QType_index_1[i+1]]
+	case i == 33:
+		return _QType_name_2
+	case i == 35:
+		return _QType_name_3
+	case i == 41:
+		return _QType_name_4
+	case 43 <= i && i <= 44:
+		i -= 43
+		return _QType_name_5[_QType_index_5[i]:_QType_index_5[i+1]]
+	case 46 <= i && i <= 48:
+		i -= 46
+		return _QType_name_6[_QType_index_6[i]:_QType_index_6[i+1]]
+	case 50 <= i && i <= 52:
+		i -= 50
+		return _QType_name_7[_QType_index_7[i]:_QType_index_7[i+1]]
+	case 64 <= i && i <= 65:
+		i -= 64
+		return _QType_name_8[_QType_index_8[i]:_QType_index_8[i+1]]
+	case 252 <= i && i <= 257:
 		i -= 252
-		return _QType_name_2[_QType_index_2[i]:_QType_index_2[i+1]]
+		return _QType_name_9[_QType_index_9[i]:_QType_index_9[i+1]]
 	default:
 		return "QType(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
@@ -0,0 +1,511 @@
+package proto
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// RData is a type specific part of a resource record. The
+// format of this information varies according to the TYPE
+// and CLASS of the resource record. Every supported record
+// type has its own implementation of the interface, use type
+// switch or type assertion to inspect data of a record.
+type RData interface {
+	// Type returns type of the resource record that
+	// the data belongs to.
+	Type() QType
+
+	// String returns a textual representation of the data.
+	String() string
+}
+
+// A is a 32 bit Internet address.
+//
+// Hosts that have multiple Internet addresses will have
+// multiple A records.
+type A struct {
+	Addr netip.Addr
+}
+
+func (rd *A) Type() QType { return QTypeA }
+
+func (rd *A) String() string { return rd.Addr.String() }
+
+// NS is a domain name which specifies a host which should be
+// authoritative for the specified class and domain.
+type NS struct {
+	Host string
+}
+
+func (rd *NS) Type() QType { return QTypeNS }
+
+func (rd *NS) String() string { return fqdn(rd.Host) }
+
+// MD is a domain name which specifies a host which has a mail
+// agent for the domain which should be able to deliver mail
+// for the domain. MD is obsolete.
+type MD struct {
+	Host string
+}
+
+func (rd *MD) Type() QType { return QTypeMD }
+
+func (rd *MD) String() string { return fqdn(rd.Host) }
+
+// MF is a domain name which specifies a host which has a mail
+// agent for the domain which will accept mail for forwarding
+// to the domain. MF is obsolete.
+type MF struct {
+	Host string
+}
+
+func (rd *MF) Type() QType { return QTypeMF }
+
+func (rd *MF) String() string { return fqdn(rd.Host) }
+
+// CNAME is a domain name which specifies the canonical or
+// primary name for the owner. The owner name is an alias.
+type CNAME struct {
+	Target string
+}
+
+func (rd *CNAME) Type() QType { return QTypeCName }
+
+func (rd *CNAME) String() string { return fqdn(rd.Target) }
+
+// SOA marks the start of a zone of authority.
+type SOA struct {
+	// MName is the domain name of the name server that was
+	// the original or primary source of data for this zone.
+	MName string
+
+	// RName is a domain name which specifies the mailbox of
+	// the person responsible for this zone.
+	RName string
+
+	// Serial is the unsigned 32 bit version number of the original
+	// copy of the zone. Zone transfers preserve this value. This
+	// value wraps and should be compared using sequence space
+	// arithmetic.
+	Serial uint32
+
+	// Refresh is a 32 bit time interval before the zone
+	// should be refreshed.
+	Refresh uint32
+
+	// Retry is a 32 bit time interval that should elapse
+	// before a failed refresh should be retried.
+	Retry uint32
+
+	// Expire is a 32 bit time value that specifies the upper
+	// limit on the time interval that can elapse before the
+	// zone is no longer authoritative.
+	Expire uint32
+
+	// Minimum is the unsigned 32 bit minimum TTL field that
+	// should be exported with any RR from this zone.
+	Minimum uint32
+}
+
+func (rd *SOA) Type() QType { return QTypeSOA }
+
+func (rd *SOA) String() string {
+	return fmt.Sprintf("%s %s %d %d %d %d %d",
+		fqdn(rd.MName), fqdn(rd.RName), rd.Serial, rd.Refresh, rd.Retry, rd.Expire, rd.Minimum)
+}
+
+// MB is a domain name which specifies a host which has the
+// specified mailbox.
+type MB struct {
+	Host string
+}
+
+func (rd *MB) Type() QType { return QTypeMB }
+
+func (rd *MB) String() string { return fqdn(rd.Host) }
+
+// MG is a domain name which specifies a mailbox which is a
+// member of the mail group specified by the domain name.
+type MG struct {
+	Mailbox string
+}
+
+func (rd *MG) Type() QType { return QTypeMG }
+
+func (rd *MG) String() string { return fqdn(rd.Mailbox) }
+
+// MR is a domain name which specifies a mailbox which is the
+// proper rename of the specified mailbox.
+type MR struct {
+	Mailbox string
+}
+
+func (rd *MR) Type() QType { return QTypeMR }
+
+func (rd *MR) String() string { return fqdn(rd.Mailbox) }
+
+// NULL is anything at all so long as it is 65535 octets or less.
+type NULL struct {
+	Data []byte
+}
+
+func (rd *NULL) Type() QType { return QTypeNULL }
+
+// String returns the data in the generic format (RFC 3597), the
+// NULL records have no own presentation format.
+func (rd *NULL) String() string { return genericRData(rd.Data) }
+
+// PTR is a domain name which points to some location in the
+// domain name space.
+type PTR struct {
+	Name string
+}
+
+func (rd *PTR) Type() QType { return QTypePTR }
+
+func (rd *PTR) String() string { return fqdn(rd.Name) }
+
+// HINFO records are used to acquire general information about
+// a host. Standard values for CPU and OS can be found in [RFC-1010].
+type HINFO struct {
+	CPU string
+	OS  string
+}
+
+func (rd *HINFO) Type() QType { return QTypeHINFO }
+
+func (rd *HINFO) String() string {
+	return characterString(rd.CPU) + " " + characterString(rd.OS)
+}
+
+// MINFO specifies mailbox or mail list information.
+type MINFO struct {
+	// RMailBx is a domain name which specifies a mailbox which is
+	// responsible for the mailing list or mailbox. If this domain
+	// name names the root, the owner of the MINFO RR is responsible
+	// for itself.
+	RMailBx string
+
+	// EMailBx is a domain name which specifies a mailbox which is
+	// to receive error messages related to the mailing list or
+	// mailbox specified by the owner of the MINFO RR. If this
+	// domain name names the root, errors should be returned to
+	// the sender of the message.
+	EMailBx string
+}
+
+func (rd *MINFO) Type() QType { return QTypeMINFO }
+
+func (rd *MINFO) String() string { return fqdn(rd.RMailBx) + " " + fqdn(rd.EMailBx) }
+
+// MX records cause type A additional section processing for
+// the host specified by Exchange.
+type MX struct {
+	// Preference is a 16 bit integer which specifies the preference
+	// given to this RR among others at the same owner. Lower values
+	// are preferred.
+	Preference uint16
+
+	// Exchange is a domain name which specifies a host willing
+	// to act as a mail exchange for the owner name.
+	Exchange string
+}
+
+func (rd *MX) Type() QType { return QTypeMX }
+
+func (rd *MX) String() string { return strconv.Itoa(int(rd.Preference)) + " " + fqdn(rd.Exchange) }
+
+// TXT records are used to hold descriptive text. The semantics
+// of the text depends on the domain where it is found.
+type TXT struct {
+	// Data is one or more character strings.
+	Data []string
+}
+
+func (rd *TXT) Type() QType { return QTypeTXT }
+
+func (rd *TXT) String() string {
+	parts := make([]string, 0, len(rd.Data))
+	for _, el := range rd.Data {
+		parts = append(parts, characterString(el))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// AAAA (RFC 3596) is a 128 bit IPv6 address.
+type AAAA struct {
+	Addr netip.Addr
+}
+
+func (rd *AAAA) Type() QType { return QTypeAAAA }
+
+func (rd *AAAA) String() string { return rd.Addr.String() }
+
+// LOC (RFC 1876) describes geographical location of a host,
+// network or subnet.
+type LOC struct {
+	// Version number of the representation. This must be zero.
+	Version uint8
+
+	// Size is the diameter of a sphere enclosing the described
+	// entity, in centimeters, expressed as a pair of four-bit
+	// unsigned integers, each ranging from zero to nine, with the
+	// most significant four bits representing the base and the
+	// second number representing the power of ten by which to
+	// multiply the base.
+	Size uint8
+
+	// HorizPre is the horizontal precision of the data, in
+	// centimeters, expressed using the same representation
+	// as Size.
+	HorizPre uint8
+
+	// VertPre is the vertical precision of the data, in
+	// centimeters, expressed using the same representation
+	// as Size.
+	VertPre uint8
+
+	// Latitude of the center of the sphere, expressed as a 32-bit
+	// integer, most significant octet first, in thousandths of a
+	// second of arc. 2^31 represents the equator; numbers above
+	// that are north latitude.
+	Latitude uint32
+
+	// Longitude of the center of the sphere, expressed in the same
+	// way as Latitude. 2^31 represents the prime meridian; numbers
+	// above that are east longitude.
+	Longitude uint32
+
+	// Altitude of the center of the sphere, in centimeters, from
+	// a base of 100,000m below the WGS 84 reference spheroid.
+	Altitude uint32
+}
+
+func (rd *LOC) Type() QType { return QTypeLOC }
+
+func (rd *LOC) String() string {
+	const (
+		equator      = 1 << 31
+		altitudeBase = 100000 * 100
+		arcSecMillis = 1000
+		arcMinMillis = 60 * arcSecMillis
+		arcDegMillis = 60 * arcMinMillis
+		cmInMeter    = 100
+	)
+
+	coordinate := func(v uint32, positive, negative string) string {
+		d := int64(v) - equator
+
+		hemisphere := positive
+		if d < 0 {
+			hemisphere = negative
+			d = -d
+		}
+
+		return fmt.Sprintf("%d %d %d.%03d %s",
+			d/arcDegMillis, d%arcDegMillis/arcMinMillis, d%arcMinMillis/arcSecMillis, d%arcSecMillis, hemisphere)
+	}
+
+	meters := func(cm int64) string {
+		sign := ""
+		if cm < 0 {
+			sign = "-"
+			cm = -cm
+		}
+
+		return fmt.Sprintf("%s%d.%02dm", sign, cm/cmInMeter, cm%cmInMeter)
+	}
+
+	precision := func(v uint8) string {
+		cm := int64(v >> 4)
+		for i := uint8(0); i < v&0x0f; i++ {
+			cm *= 10
+		}
+
+		return meters(cm)
+	}
+
+	return strings.Join([]string{
+		coordinate(rd.Latitude, "N", "S"),
+		coordinate(rd.Longitude, "E", "W"),
+		meters(int64(rd.Altitude) - altitudeBase),
+		precision(rd.Size),
+		precision(rd.HorizPre),
+		precision(rd.VertPre),
+	}, " ")
+}
+
+// SRV (RFC 2782) specifies the location of the server(s) for
+// a specific protocol and domain.
+type SRV struct {
+	// Priority of this target host. A client MUST attempt to contact
+	// the target host with the lowest-numbered priority it can reach.
+	Priority uint16
+
+	// Weight specifies a relative weight for entries with the same
+	// priority. Larger weights SHOULD be given a proportionately
+	// higher probability of being selected.
+	Weight uint16
+
+	// Port on this target host of this service.
+	Port uint16
+
+	// Target is the domain name of the target host. Name
+	// compression is not to be used for this field.
+	Target string
+}
+
+func (rd *SRV) Type() QType { return QTypeSRV }
+
+func (rd *SRV) String() string {
+	return fmt.Sprintf("%d %d %d %s", rd.Priority, rd.Weight, rd.Port, fqdn(rd.Target))
+}
+
+// NAPTR (RFC 3403) is the Naming Authority Pointer record of
+// Dynamic Delegation Discovery System (DDDS).
+type NAPTR struct {
+	// Order specifies the order in which the NAPTR records MUST
+	// be processed.
+	Order uint16
+
+	// Preference specifies the order in which NAPTR records with
+	// equal Order values SHOULD be processed.
+	Preference uint16
+
+	// Flags control aspects of the rewriting and interpretation
+	// of the fields in the record.
+	Flags string
+
+	// Services specifies the Service Parameters applicable
+	// to this delegation path.
+	Services string
+
+	// Regexp is a substitution expression that is applied to the
+	// original string held by the client.
+	Regexp string
+
+	// Replacement is the next domain name to query for, it must
+	// not be compressed.
+	Replacement string
+}
+
+func (rd *NAPTR) Type() QType { return QTypeNAPTR }
+
+func (rd *NAPTR) String() string {
+	return fmt.Sprintf("%d %d %s %s %s %s",
+		rd.Order, rd.Preference, characterString(rd.Flags), characterString(rd.Services), characterString(rd.Regexp), fqdn(rd.Replacement))
+}
+
+// SSHFP (RFC 4255) publishes SSH public host key fingerprint.
+type SSHFP struct {
+	// Algorithm describes the algorithm of the public key:
+	// 1 - RSA, 2 - DSA, 3 - ECDSA, 4 - Ed25519.
+	Algorithm uint8
+
+	// FPType describes the message-digest algorithm used to
+	// calculate the fingerprint: 1 - SHA-1, 2 - SHA-256.
+	FPType uint8
+
+	Fingerprint []byte
+}
+
+func (rd *SSHFP) Type() QType { return QTypeSSHFP }
+
+func (rd *SSHFP) String() string {
+	return fmt.Sprintf("%d %d %X", rd.Algorithm, rd.FPType, rd.Fingerprint)
+}
+
+// TLSA (RFC 6698) associates a TLS server certificate or public
+// key with the domain name where the record is found.
+type TLSA struct {
+	// Usage specifies the provided association that will be
+	// used to match the certificate presented in the TLS
+	// handshake.
+	Usage uint8
+
+	// Selector specifies which part of the TLS certificate
+	// presented by the server will be matched against the
+	// association data.
+	Selector uint8
+
+	// MatchingType specifies how the certificate association
+	// is presented.
+	MatchingType uint8
+
+	CertificateAssociationData []byte
+}
+
+func (rd *TLSA) Type() QType { return QTypeTLSA }
+
+func (rd *TLSA) String() string {
+	return fmt.Sprintf("%d %d %d %X", rd.Usage, rd.Selector, rd.MatchingType, rd.CertificateAssociationData)
+}
+
+// URI (RFC 7553) publishes mappings from hostnames to URIs.
+type URI struct {
+	// Priority of the target URI in this RR. A client MUST attempt
+	// to contact the target URI with the lowest-numbered priority
+	// it can reach.
+	Priority uint16
+
+	// Weight is a server selection mechanism among entries with
+	// the same priority.
+	Weight uint16
+
+	// Target is the URI of the target. It takes the rest of the
+	// RDATA and is not a <character-string>.
+	Target string
+}
+
+func (rd *URI) Type() QType { return QTypeURI }
+
+func (rd *URI) String() string {
+	return fmt.Sprintf("%d %d %s", rd.Priority, rd.Weight, characterString(rd.Target))
+}
+
+// CAA (RFC 8659) allows a DNS domain name holder to specify the
+// Certification Authorities authorized to issue certificates
+// for that domain name.
+type CAA struct {
+	// Flags is one octet containing, currently, only the Issuer
+	// Critical Flag (bit 7).
+	Flags uint8
+
+	// Tag is the property identifier, a sequence of ASCII
+	// letters and numbers, e.g. "issue", "issuewild", "iodef".
+	Tag string
+
+	// Value is the property value. It takes the rest of the RDATA.
+	Value string
+}
+
+func (rd *CAA) Type() QType { return QTypeCAA }
+
+func (rd *CAA) String() string {
+	return fmt.Sprintf("%d %s %s", rd.Flags, rd.Tag, characterString(rd.Value))
+}
+
+// Unknown holds data of a record type that the package does
+// not know how to interpret (RFC 3597). The data is kept
+// as is, so it can be re-encoded byte-for-byte.
+//
+// Names inside RDATA of unknown types can not be compressed
+// or decompressed, a compression pointer in such data would
+// point to a wrong place after re-encoding. That is why, new
+// RR types must not use compression at all.
+type Unknown struct {
+	T    QType
+	Data []byte
+}
+
+func (rd *Unknown) Type() QType { return rd.T }
+
+// String returns RDATA in the generic presentation format:
+//
+//	\# <length> <hex data>
+//
+// where the hex data is omitted for zero length data.
+func (rd *Unknown) String() string { return genericRData(rd.Data) }
@@ -0,0 +1,481 @@
+package proto
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rokkerruslan/dnska/pkg/bv"
+)
+
+// Reference - https://datatracker.ietf.org/doc/html/rfc9460
+
+// SVCB is the Service Binding record. The record delivers
+// configuration information and parameters for how to access
+// a service.
+//
+// The RDATA for the SVCB RR consists of:
+//
+//   - a 2 octet field for SvcPriority as an integer in network byte order.
+//   - the uncompressed, fully-qualified TargetName, represented as a
+//     sequence of length-prefixed labels per Section 3.1 of [RFC1035].
+//   - the SvcParams, consuming the remainder of the record (so smaller
+//     than 65535 octets and constrained by the RDATA and DNS message sizes).
+type SVCB struct {
+	// Priority is the priority of this record (relative to others,
+	// with lower values preferred). A value of 0 indicates AliasMode.
+	Priority uint16
+
+	// Target is the domain name of either the alias target (for
+	// AliasMode) or the alternative endpoint (for ServiceMode).
+	// The empty name or "." means the owner name of the record.
+	Target string
+
+	// Params is a list of key=value pairs describing the alternative
+	// endpoint at TargetName (only used in ServiceMode and otherwise
+	// ignored).
+	Params []SVCBParam
+}
+
+func (rd *SVCB) Type() QType { return QTypeSVCB }
+
+func (rd *SVCB) String() string {
+	parts := []string{strconv.Itoa(int(rd.Priority)), fqdn(rd.Target)}
+	for _, el := range rd.Params {
+		parts = append(parts, svcbParamString(el))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// HTTPS is the SVCB-compatible RR type, specific to the "https"
+// and "http" schemes. It has the same RDATA format as SVCB.
+type HTTPS struct {
+	SVCB
+}
+
+func (rd *HTTPS) Type() QType { return QTypeHTTPS }
+
+// SVCBParamKey is the numeric key of an SvcParam.
+type SVCBParamKey uint16
+
+const (
+	SVCBParamKeyMandatory     SVCBParamKey = 0
+	SVCBParamKeyALPN          SVCBParamKey = 1
+	SVCBParamKeyNoDefaultALPN SVCBParamKey = 2
+	SVCBParamKeyPort          SVCBParamKey = 3
+	SVCBParamKeyIPv4Hint      SVCBParamKey = 4
+	SVCBParamKeyECH           SVCBParamKey = 5
+	SVCBParamKeyIPv6Hint      SVCBParamKey = 6
+)
+
+var svcbParamKeyNames = map[SVCBParamKey]string{
+	SVCBParamKeyMandatory:     "mandatory",
+	SVCBParamKeyALPN:          "alpn",
+	SVCBParamKeyNoDefaultALPN: "no-default-alpn",
+	SVCBParamKeyPort:          "port",
+	SVCBParamKeyIPv4Hint:      "ipv4hint",
+	SVCBParamKeyECH:           "ech",
+	SVCBParamKeyIPv6Hint:      "ipv6hint",
+}
+
+// String returns the presentation name of the key, unnamed keys
+// are represented as "keyNNNNN".
+func (k SVCBParamKey) String() string {
+	if name, ok := svcbParamKeyNames[k]; ok {
+		return name
+	}
+
+	return "key" + strconv.Itoa(int(k))
+}
+
+// SVCBParam is a single SvcParam of SVCB and HTTPS records.
+type SVCBParam interface {
+	Key() SVCBParamKey
+
+	// Value returns presentation form of the value, the
+	// empty string is returned for keys without value.
+	Value() string
+}
+
+// SVCBMandatory lists keys that the client must understand to
+// use the record.
+type SVCBMandatory struct {
+	Keys []SVCBParamKey
+}
+
+func (p *SVCBMandatory) Key() SVCBParamKey { return SVCBParamKeyMandatory }
+
+func (p *SVCBMandatory) Value() string {
+	keys := make([]string, 0, len(p.Keys))
+	for _, el := range p.Keys {
+		keys = append(keys, el.String())
+	}
+
+	return strings.Join(keys, ",")
+}
+
+// SVCBALPN is the set of Application-Layer Protocol Negotiation
+// (ALPN) protocol identifiers supported by the endpoint.
+type SVCBALPN struct {
+	IDs []string
+}
+
+func (p *SVCBALPN) Key() SVCBParamKey { return SVCBParamKeyALPN }
+
+func (p *SVCBALPN) Value() string {
+	ids := make([]string, 0, len(p.IDs))
+	for _, el := range p.IDs {
+		ids = append(ids, escapeSVCBValue(el, true))
+	}
+
+	return strings.Join(ids, ",")
+}
+
+// SVCBNoDefaultALPN indicates that the default ALPN of the
+// scheme is not supported by the endpoint.
+type SVCBNoDefaultALPN struct{}
+
+func (p *SVCBNoDefaultALPN) Key() SVCBParamKey { return SVCBParamKeyNoDefaultALPN }
+
+func (p *SVCBNoDefaultALPN) Value() string { return "" }
+
+// SVCBPort is the TCP or UDP port that should be used to reach
+// this alternative endpoint.
+type SVCBPort struct {
+	Port uint16
+}
+
+func (p *SVCBPort) Key() SVCBParamKey { return SVCBParamKeyPort }
+
+func (p *SVCBPort) Value() string { return strconv.Itoa(int(p.Port)) }
+
+// SVCBIPv4Hint conveys IPv4 addresses that clients may use to
+// reach the service.
+type SVCBIPv4Hint struct {
+	Addrs []netip.Addr
+}
+
+func (p *SVCBIPv4Hint) Key() SVCBParamKey { return SVCBParamKeyIPv4Hint }
+
+func (p *SVCBIPv4Hint) Value() string { return joinAddrs(p.Addrs) }
+
+// SVCBECH is the TLS Encrypted ClientHello configuration list.
+type SVCBECH struct {
+	Config []byte
+}
+
+func (p *SVCBECH) Key() SVCBParamKey { return SVCBParamKeyECH }
+
+func (p *SVCBECH) Value() string { return base64.StdEncoding.EncodeToString(p.Config) }
+
+// SVCBIPv6Hint conveys IPv6 addresses that clients may use to
+// reach the service.
+type SVCBIPv6Hint struct {
+	Addrs []netip.Addr
+}
+
+func (p *SVCBIPv6Hint) Key() SVCBParamKey { return SVCBParamKeyIPv6Hint }
+
+func (p *SVCBIPv6Hint) Value() string { return joinAddrs(p.Addrs) }
+
+// SVCBUnknownParam holds value of a key the package does
+// not know how to interpret. The malformed values of the known
+// keys are kept the same way, as the opaque data of the key.
+type SVCBUnknownParam struct {
+	K    SVCBParamKey
+	Data []byte
+}
+
+func (p *SVCBUnknownParam) Key() SVCBParamKey { return p.K }
+
+func (p *SVCBUnknownParam) Value() string { return escapeSVCBValue(string(p.Data), false) }
+
+func svcbParamString(p SVCBParam) string {
+	key := p.Key().String()
+
+	// The opaque value is presented with the generic
+	// name of the key (RFC 9460 section 2.1).
+	if _, ok := p.(*SVCBUnknownParam); ok {
+		key = "key" + strconv.Itoa(int(p.Key()))
+	}
+
+	value := p.Value()
+
+	if value == "" {
+		return key
+	}
+
+	return key + "=" + value
+}
+
+func joinAddrs(addrs []netip.Addr) string {
+	parts := make([]string, 0, len(addrs))
+	for _, el := range addrs {
+		parts = append(parts, el.String())
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// escapeSVCBValue escapes a value as <char-string> of the
+// presentation format, the commas also are escaped inside
+// elements of comma-separated lists.
+func escapeSVCBValue(s string, list bool) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+
+		switch {
+		case ch == '\\' || ch == '"' || (list && ch == ','):
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case ch < 0x21 || ch > 0x7e || ch == ';' || ch == '(' || ch == ')':
+			fmt.Fprintf(&b, "\\%03d", ch)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+
+	return b.String()
+}
+
+func (dec *Decoder) decodeSVCB(nb *bv.ByteView, end uint) (*SVCB, error) {
+	priority, err := nb.TakeUint16()
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := dec.decodeName(nb)
+	if err != nil {
+		return nil, err
+	}
+
+	out := SVCB{Priority: priority, Target: target}
+
+	prev := -1
+	for nb.Pos() < end {
+		key, err := nb.TakeUint16()
+		if err != nil {
+			return nil, err
+		}
+
+		// SvcParamKeys SHALL appear in increasing numeric order.
+		if int(key) <= prev {
+			return nil, fmt.Errorf("svcb param key %d is out of order", key)
+		}
+		prev = int(key)
+
+		length, err := nb.TakeUint16()
+		if err != nil {
+			return nil, err
+		}
+
+		if nb.Pos()+uint(length) > end {
+			return nil, fmt.Errorf("svcb param %v overruns rdata", SVCBParamKey(key))
+		}
+
+		value, err := decodeOpaque(nb, length)
+		if err != nil {
+			return nil, err
+		}
+
+		// The malformed value of the param does not fail the
+		// message, the param is kept as opaque data, so the client
+		// which checks the params can ignore the record (RFC 9460
+		// section 2.2) and the record is encoded back unchanged.
+		param, err := decodeSVCBParam(SVCBParamKey(key), value)
+		if err != nil {
+			param = &SVCBUnknownParam{K: SVCBParamKey(key), Data: value}
+		}
+
+		out.Params = append(out.Params, param)
+	}
+
+	return &out, nil
+}
+
+func decodeSVCBParam(key SVCBParamKey, value []byte) (SVCBParam, error) {
+	switch key {
+	case SVCBParamKeyMandatory:
+		if len(value) == 0 || len(value)%2 != 0 {
+			return nil, fmt.Errorf("malformed svcb mandatory param, length=%d", len(value))
+		}
+
+		var p SVCBMandatory
+		for i := 0; i < len(value); i += 2 {
+			p.Keys = append(p.Keys, SVCBParamKey(uint16(value[i])<<8|uint16(value[i+1])))
+		}
+
+		return &p, nil
+
+	case SVCBParamKeyALPN:
+		var p SVCBALPN
+		for i := 0; i < len(value); {
+			length := int(value[i])
+			i++
+
+			if length == 0 || i+length > len(value) {
+				return nil, errors.New("malformed svcb alpn param")
+			}
+
+			p.IDs = append(p.IDs, string(value[i:i+length]))
+			i += length
+		}
+
+		if len(p.IDs) == 0 {
+			return nil, errors.New("svcb alpn param is empty")
+		}
+
+		return &p, nil
+
+	case SVCBParamKeyNoDefaultALPN:
+		if len(value) != 0 {
+			return nil, errors.New("svcb no-default-alpn param must have empty value")
+		}
+
+		return &SVCBNoDefaultALPN{}, nil
+
+	case SVCBParamKeyPort:
+		if len(value) != 2 {
+			return nil, fmt.Errorf("malformed svcb port param, length=%d", len(value))
+		}
+
+		return &SVCBPort{Port: uint16(value[0])<<8 | uint16(value[1])}, nil
+
+	case SVCBParamKeyIPv4Hint:
+		if len(value) == 0 || len(value)%4 != 0 {
+			return nil, fmt.Errorf("malformed svcb ipv4hint param, length=%d", len(value))
+		}
+
+		var p SVCBIPv4Hint
+		for i := 0; i < len(value); i += 4 {
+			p.Addrs = append(p.Addrs, netip.AddrFrom4(*(*[4]byte)(value[i : i+4])))
+		}
+
+		return &p, nil
+
+	case SVCBParamKeyECH:
+		return &SVCBECH{Config: value}, nil
+
+	case SVCBParamKeyIPv6Hint:
+		if len(value) == 0 || len(value)%16 != 0 {
+			return nil, fmt.Errorf("malformed svcb ipv6hint param, length=%d", len(value))
+		}
+
+		var p SVCBIPv6Hint
+		for i := 0; i < len(value); i += 16 {
+			p.Addrs = append(p.Addrs, netip.AddrFrom16(*(*[16]byte)(value[i : i+16])))
+		}
+
+		return &p, nil
+	}
+
+	return &SVCBUnknownParam{K: key, Data: value}, nil
+}
+
+func encodeSVCB(nb *bv.ByteView, index *labelsIndex, rd *SVCB) error {
+	if err := nb.PutUint16(rd.Priority); err != nil {
+		return err
+	}
+
+	if err := index.EncodeNameUncompressed(nb, rd.Target); err != nil {
+		return err
+	}
+
+	params := make([]SVCBParam, len(rd.Params))
+	copy(params, rd.Params)
+
+	sort.SliceStable(params, func(i, j int) bool {
+		return params[i].Key() < params[j].Key()
+	})
+
+	for i, el := range params {
+		if i > 0 && params[i-1].Key() == el.Key() {
+			return fmt.Errorf("svcb param %v is duplicated", el.Key())
+		}
+
+		value, err := encodeSVCBParam(el)
+		if err != nil {
+			return err
+		}
+
+		if len(value) > 0xffff {
+			return fmt.Errorf("svcb param %v is too big", el.Key())
+		}
+
+		if err := nb.PutUint16(uint16(el.Key())); err != nil {
+			return err
+		}
+
+		if err := nb.PutUint16(uint16(len(value))); err != nil {
+			return err
+		}
+
+		if err := encodeOpaque(nb, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeSVCBParam(p SVCBParam) ([]byte, error) {
+	var out []byte
+
+	switch p := p.(type) {
+	case *SVCBMandatory:
+		for _, el := range p.Keys {
+			out = append(out, byte(el>>8), byte(el))
+		}
+
+	case *SVCBALPN:
+		for _, el := range p.IDs {
+			if len(el) == 0 || len(el) > 255 {
+				return nil, fmt.Errorf("invalid alpn id length %d", len(el))
+			}
+
+			out = append(out, byte(len(el)))
+			out = append(out, el...)
+		}
+
+	case *SVCBNoDefaultALPN:
+
+	case *SVCBPort:
+		out = append(out, byte(p.Port>>8), byte(p.Port))
+
+	case *SVCBIPv4Hint:
+		for _, el := range p.Addrs {
+			if !el.Is4() {
+				return nil, fmt.Errorf("ipv4hint requires IPv4 address, got %v", el)
+			}
+
+			out = append(out, el.AsSlice()...)
+		}
+
+	case *SVCBECH:
+		out = append(out, p.Config...)
+
+	case *SVCBIPv6Hint:
+		for _, el := range p.Addrs {
+			if !el.Is6() {
+				return nil, fmt.Errorf("ipv6hint requires IPv6 address, got %v", el)
+			}
+
+			out = append(out, el.AsSlice()...)
+		}
+
+	case *SVCBUnknownParam:
+		out = append(out, p.Data...)
+
+	default:
+		return nil, fmt.Errorf("unsupported svcb param %T", p)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,294 @@
+package proto
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Reference - https://datatracker.ietf.org/doc/html/rfc1035#section-5
+
+// Presentation Format
+//
+// The records are represented in the master file (zone file) format:
+//
+//	<domain-name> <TTL> <class> <type> <RDATA>
+//
+// e.g. "example.com. 300 IN A 93.184.216.34". Domain names are always
+// absolute (fully qualified, with the trailing dot), the root domain
+// is represented as ".". The <character-string>s are always quoted.
+//
+// The types and classes without a mnemonic are represented as
+// "TYPE<n>" and "CLASS<n>", the RDATA that can not be represented
+// in a type specific way uses the generic format (RFC 3597):
+//
+//	\# <length> <hex data>
+
+// String returns the record in the presentation format.
+func (r ResourceRecord) String() string {
+	s := fqdn(r.Name) + " " + strconv.FormatUint(uint64(r.TTL), 10) + " " + classMnemonic(r.Class) + " " + typeMnemonic(r.Type)
+
+	if r.RData == nil {
+		return s
+	}
+
+	if rData := r.RData.String(); rData != "" {
+		s += " " + rData
+	}
+
+	return s
+}
+
+// String returns the question in the presentation format,
+// e.g. "example.com. IN A".
+func (q Question) String() string {
+	return fqdn(q.Name) + " " + classMnemonic(q.Class) + " " + typeMnemonic(q.Type)
+}
+
+// String returns the message in the dig-style layout:
+//
+//	;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 1
+//	;; flags: qr rd ra; QUERY: 1, ANSWER: 1, AUTHORITY: 0, ADDITIONAL: 1
+//
+//	;; OPT PSEUDOSECTION:
+//	; EDNS: version: 0, flags: do; udp: 1232
+//
+//	;; QUESTION SECTION:
+//	;example.com. IN A
+//
+//	;; ANSWER SECTION:
+//	example.com. 300 IN A 93.184.216.34
+//
+// Empty sections are omitted.
+func (m Message) String() string {
+	var b strings.Builder
+
+	additional := len(m.Additional)
+	if m.EDNS != nil {
+		additional++
+	}
+
+	fmt.Fprintf(&b, ";; ->>HEADER<<- opcode: %s, status: %s, id: %d\n",
+		opcodeMnemonic(m.Header.Opcode), rcodeMnemonic(m.ExtendedRCode()), m.Header.ID)
+	fmt.Fprintf(&b, ";; flags: %s; QUERY: %d, ANSWER: %d, AUTHORITY: %d, ADDITIONAL: %d\n",
+		headerFlags(m.Header), len(m.Question), len(m.Answer), len(m.Authority), additional)
+
+	if m.EDNS != nil {
+		flags := ""
+		if m.EDNS.DNSSECOK {
+			flags = " do"
+		}
+
+		fmt.Fprintf(&b, "\n;; OPT PSEUDOSECTION:\n; EDNS: version: %d, flags:%s; udp: %d\n",
+			m.EDNS.Version, flags, m.EDNS.UDPPayloadSize)
+
+		for _, el := range m.EDNS.Options {
+			fmt.Fprintf(&b, "; %s: %X\n", ednsOptionMnemonic(el.Code), el.Data)
+		}
+	}
+
+	if len(m.Question) > 0 {
+		b.WriteString("\n;; QUESTION SECTION:\n")
+
+		for _, el := range m.Question {
+			b.WriteString(";" + el.String() + "\n")
+		}
+	}
+
+	for _, section := range []struct {
+		name    string
+		records []ResourceRecord
+	}{
+		{name: "ANSWER", records: m.Answer},
+		{name: "AUTHORITY", records: m.Authority},
+		{name: "ADDITIONAL", records: m.Additional},
+	} {
+		if len(section.records) == 0 {
+			continue
+		}
+
+		b.WriteString("\n;; " + section.name + " SECTION:\n")
+
+		for _, el := range section.records {
+			b.WriteString(el.String() + "\n")
+		}
+	}
+
+	return b.String()
+}
+
+func headerFlags(h Header) string {
+	var flags []string
+
+	for _, el := range []struct {
+		set  bool
+		name string
+	}{
+		{h.Response, "qr"},
+		{h.AuthoritativeAnswer, "aa"},
+		{h.TruncateCation, "tc"},
+		{h.RecursionDesired, "rd"},
+		{h.RecursionAvailable, "ra"},
+		{h.AuthenticData, "ad"},
+		{h.CheckingDisabled, "cd"},
+	} {
+		if el.set {
+			flags = append(flags, el.name)
+		}
+	}
+
+	return strings.Join(flags, " ")
+}
+
+// typeMnemonic returns the textual representation of a
+// type, e.g. "A", "CNAME", or "TYPE65280" for unknown types.
+func typeMnemonic(t QType) string {
+	s := t.String()
+	if t == QTypeUnknown || strings.HasPrefix(s, "QType(") {
+		return "TYPE" + strconv.Itoa(int(t))
+	}
+
+	return strings.ToUpper(strings.TrimPrefix(s, "QType"))
+}
+
+var classMnemonics = map[QClass]string{
+	ClassIN:  "IN",
+	ClassCS:  "CS",
+	ClassCH:  "CH",
+	ClassHS:  "HS",
+	ClassAny: "ANY",
+}
+
+// classMnemonic returns the textual representation of a
+// class, e.g. "IN", or "CLASS32" for unknown classes.
+func classMnemonic(c QClass) string {
+	if s, ok := classMnemonics[c]; ok {
+		return s
+	}
+
+	return "CLASS" + strconv.Itoa(int(c))
+}
+
+var opcodeMnemonics = map[Opcode]string{
+	OpcodeQuery:  "QUERY",
+	OpcodeIQuery: "IQUERY",
+	OpcodeStatus: "STATUS",
+	4:            "NOTIFY",
+	5:            "UPDATE",
+}
+
+func opcodeMnemonic(o Opcode) string {
+	if s, ok := opcodeMnemonics[o]; ok {
+		return s
+	}
+
+	return "OPCODE" + strconv.Itoa(int(o))
+}
+
+var rcodeMnemonics = map[uint16]string{
+	0:  "NOERROR",
+	1:  "FORMERR",
+	2:  "SERVFAIL",
+	3:  "NXDOMAIN",
+	4:  "NOTIMP",
+	5:  "REFUSED",
+	6:  "YXDOMAIN",
+	7:  "YXRRSET",
+	8:  "NXRRSET",
+	9:  "NOTAUTH",
+	10: "NOTZONE",
+	16: "BADVERS",
+}
+
+// rcodeMnemonic returns the textual representation of the
+// extended (12-bit) RCODE.
+func rcodeMnemonic(rcode uint16) string {
+	if s, ok := rcodeMnemonics[rcode]; ok {
+		return s
+	}
+
+	return "RCODE" + strconv.Itoa(int(rcode))
+}
+
+var ednsOptionMnemonics = map[EDNSOptionCode]string{
+	EDNSOptionCodeNSID:         "NSID",
+	EDNSOptionCodeClientSubnet: "CLIENT-SUBNET",
+	EDNSOptionCodeExpire:       "EXPIRE",
+	EDNSOptionCodeCookie:       "COOKIE",
+	EDNSOptionCodeTCPKeepalive: "KEEPALIVE",
+	EDNSOptionCodePadding:      "PADDING",
+}
+
+func ednsOptionMnemonic(code EDNSOptionCode) string {
+	if s, ok := ednsOptionMnemonics[code]; ok {
+		return s
+	}
+
+	return "OPT" + strconv.Itoa(int(code))
+}
+
+// fqdn returns absolute domain name in the presentation format,
+// the special characters of labels are escaped.
+func fqdn(name string) string {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return "."
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+
+		switch {
+		case ch == '\\' || ch == '"' || ch == ';' || ch == '(' || ch == ')' || ch == '@' || ch == '$':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case ch < 0x21 || ch > 0x7e:
+			fmt.Fprintf(&b, "\\%03d", ch)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+
+	b.WriteByte('.')
+
+	return b.String()
+}
+
+// characterString returns quoted <character-string>, the quote
+// and backslash characters are escaped with a backslash, the
+// non-printable ones are represented as \DDD.
+func characterString(s string) string {
+	var b strings.Builder
+
+	b.WriteByte('"')
+
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+
+		switch {
+		case ch == '\\' || ch == '"':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case ch < 0x20 || ch > 0x7e:
+			fmt.Fprintf(&b, "\\%03d", ch)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// genericRData returns RDATA in the generic format (RFC 3597).
+func genericRData(data []byte) string {
+	if len(data) == 0 {
+		return `\# 0`
+	}
+
+	return `\# ` + strconv.Itoa(len(data)) + " " + hex.EncodeToString(data)
+}
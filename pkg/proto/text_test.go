@@ -0,0 +1,260 @@
+package proto
+
+import (
+	"net/netip"
+	"os"
+	"testing"
+
+	testing2 "github.com/rokkerruslan/dnska/testing"
+)
+
+func TestResourceRecordString(t *testing.T) {
+	cases := []struct {
+		record ResourceRecord
+		text   string
+	}{
+		{
+			record: ResourceRecord{Name: "example.com", Type: QTypeA, Class: ClassIN, TTL: 300, RData: &A{Addr: netip.MustParseAddr("93.184.216.34")}},
+			text:   "example.com. 300 IN A 93.184.216.34",
+		},
+		{
+			record: ResourceRecord{Name: "example.com", Type: QTypeAAAA, Class: ClassIN, TTL: 300, RData: &AAAA{Addr: netip.MustParseAddr("2606:2800:220:1::1")}},
+			text:   "example.com. 300 IN AAAA 2606:2800:220:1::1",
+		},
+		{
+			record: ResourceRecord{Name: "", Type: QTypeNS, Class: ClassIN, TTL: 518400, RData: &NS{Host: "a.root-servers.net"}},
+			text:   ". 518400 IN NS a.root-servers.net.",
+		},
+		{
+			record: ResourceRecord{Name: "example.com", Type: QTypeMX, Class: ClassIN, TTL: 60, RData: &MX{Preference: 10, Exchange: "mail.example.com"}},
+			text:   "example.com. 60 IN MX 10 mail.example.com.",
+		},
+		{
+			record: ResourceRecord{
+				Name:  "example.com",
+				Type:  QTypeSOA,
+				Class: ClassIN,
+				TTL:   3600,
+				RData: &SOA{MName: "ns.icann.org", RName: "noc.dns.icann.org", Serial: 2022091274, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 3600},
+			},
+			text: "example.com. 3600 IN SOA ns.icann.org. noc.dns.icann.org. 2022091274 7200 3600 1209600 3600",
+		},
+		{
+			record: ResourceRecord{Name: "example.com", Type: QTypeTXT, Class: ClassIN, TTL: 60, RData: &TXT{Data: []string{`v=spf1 -all`, "say \"hi\"\x00"}}},
+			text:   `example.com. 60 IN TXT "v=spf1 -all" "say \"hi\"\000"`,
+		},
+		{
+			record: ResourceRecord{Name: "example.com", Type: QTypeHINFO, Class: ClassCH, TTL: 0, RData: &HINFO{CPU: "INTEL-386", OS: "UNIX"}},
+			text:   `example.com. 0 CH HINFO "INTEL-386" "UNIX"`,
+		},
+		{
+			record: ResourceRecord{Name: "example.com", Type: QType(65280), Class: QClass(32), TTL: 0, RData: &Unknown{T: QType(65280), Data: []byte{0xca, 0xfe}}},
+			text:   `example.com. 0 CLASS32 TYPE65280 \# 2 cafe`,
+		},
+		{
+			record: ResourceRecord{Name: "example.com", Type: QTypeNULL, Class: ClassIN, TTL: 0, RData: &NULL{Data: []byte{}}},
+			text:   `example.com. 0 IN NULL \# 0`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.text, func(t *testing.T) {
+			testing2.Assert(t, tc.record.String(), tc.text)
+
+			parsed, err := ParseResourceRecord(tc.text)
+			testing2.FailIfError(t, err)
+
+			testing2.Assert(t, parsed, tc.record)
+		})
+	}
+}
+
+func TestParseResourceRecord(t *testing.T) {
+	cases := []struct {
+		name string
+		text string
+		want ResourceRecord
+	}{
+		{
+			name: "class and ttl are optional",
+			text: "example.com A 192.0.2.1",
+			want: ResourceRecord{Name: "example.com", Type: QTypeA, Class: ClassIN, RData: &A{Addr: netip.MustParseAddr("192.0.2.1")}},
+		},
+		{
+			name: "class before ttl",
+			text: "example.com. in 300 a 192.0.2.1",
+			want: ResourceRecord{Name: "example.com", Type: QTypeA, Class: ClassIN, TTL: 300, RData: &A{Addr: netip.MustParseAddr("192.0.2.1")}},
+		},
+		{
+			name: "multiple lines and comments",
+			text: "example.com. 3600 IN SOA ns.example.com. hostmaster.example.com. (\n" +
+				"    1 ; serial\n" +
+				"    7200 ; refresh\n" +
+				"    3600 1209600 300 )",
+			want: ResourceRecord{
+				Name:  "example.com",
+				Type:  QTypeSOA,
+				Class: ClassIN,
+				TTL:   3600,
+				RData: &SOA{MName: "ns.example.com", RName: "hostmaster.example.com", Serial: 1, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 300},
+			},
+		},
+		{
+			name: "generic data of known type",
+			text: `example.com. 300 IN A \# 4 C0000201`,
+			want: ResourceRecord{Name: "example.com", Type: QTypeA, Class: ClassIN, TTL: 300, RData: &A{Addr: netip.MustParseAddr("192.0.2.1")}},
+		},
+		{
+			name: "unquoted character strings",
+			text: `example.com. 300 IN TXT hello\032world`,
+			want: ResourceRecord{Name: "example.com", Type: QTypeTXT, Class: ClassIN, TTL: 300, RData: &TXT{Data: []string{"hello world"}}},
+		},
+		{
+			name: "quoted svcb param value",
+			text: `example.com. 300 IN HTTPS 1 . alpn="h2,h3" port=443`,
+			want: ResourceRecord{
+				Name:  "example.com",
+				Type:  QTypeHTTPS,
+				Class: ClassIN,
+				TTL:   300,
+				RData: &HTTPS{SVCB{Priority: 1, Params: []SVCBParam{&SVCBALPN{IDs: []string{"h2", "h3"}}, &SVCBPort{Port: 443}}}},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseResourceRecord(tc.text)
+			testing2.FailIfError(t, err)
+
+			testing2.Assert(t, got, tc.want)
+		})
+	}
+}
+
+func TestParseResourceRecordErrors(t *testing.T) {
+	for _, text := range []string{
+		"example.com.",
+		"example.com. 300 IN",
+		"example.com. 300 IN BOGUS 1",
+		"example.com. 300 IN A",
+		"example.com. 300 IN A 2001:db8::1",
+		"example.com. 300 IN A 192.0.2.1 192.0.2.2",
+		"example.com. 300 IN MX 70000 mail.example.com.",
+		`example.com. 300 IN TXT "unterminated`,
+		`example.com. 300 IN A \# 5 C0000201`,
+		`example.com. 300 IN OPT 1`,
+		`@ 300 IN A 192.0.2.1`,
+		`a\.b.example.com. 300 IN A 192.0.2.1`,
+		`a\046b.example.com. 300 IN A 192.0.2.1`,
+		`example.com. 300 IN CNAME a\.b.example.com.`,
+	} {
+		t.Run(text, func(t *testing.T) {
+			_, err := ParseResourceRecord(text)
+			if err == nil {
+				t.Fatalf("expected error for %q", text)
+			}
+		})
+	}
+}
+
+func TestMessageString(t *testing.T) {
+	m := Message{
+		Header: Header{ID: 4660, Response: true, RecursionDesired: true, RecursionAvailable: true},
+		Question: []Question{
+			{Name: "example.com", Type: QTypeA, Class: ClassIN},
+		},
+		Answer: []ResourceRecord{
+			{Name: "example.com", Type: QTypeA, Class: ClassIN, TTL: 300, RData: &A{Addr: netip.MustParseAddr("93.184.216.34")}},
+		},
+		EDNS: &EDNS{UDPPayloadSize: 1232, DNSSECOK: true},
+	}
+
+	want := ";; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 4660\n" +
+		";; flags: qr rd ra; QUERY: 1, ANSWER: 1, AUTHORITY: 0, ADDITIONAL: 1\n" +
+		"\n" +
+		";; OPT PSEUDOSECTION:\n" +
+		"; EDNS: version: 0, flags: do; udp: 1232\n" +
+		"\n" +
+		";; QUESTION SECTION:\n" +
+		";example.com. IN A\n" +
+		"\n" +
+		";; ANSWER SECTION:\n" +
+		"example.com. 300 IN A 93.184.216.34\n"
+
+	testing2.Assert(t, m.String(), want)
+}
+
+func TestParseMessageRoundTrip(t *testing.T) {
+	for _, name := range []string{
+		"testdata/standard-query.query.A.yahoo.com.opt.cookie",
+		"testdata/standard-query.response.A.yahoo.com.opt.cookie",
+		"testdata/standard-query.response.soa.com",
+	} {
+		t.Run(name, func(t *testing.T) {
+			buf, err := os.ReadFile(name)
+			testing2.FailIfError(t, err)
+
+			m, err := NewDecoder().Decode(buf)
+			testing2.FailIfError(t, err)
+
+			got, err := ParseMessage(m.String())
+			testing2.FailIfError(t, err)
+
+			want, err := NewEncoder(make([]byte, 4096)).Encode(m)
+			testing2.FailIfError(t, err)
+
+			gotBuf, err := NewEncoder(make([]byte, 4096)).Encode(got)
+			testing2.FailIfError(t, err)
+
+			testing2.Assert(t, gotBuf, want)
+		})
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	text := `
+; A query with a record in the additional section.
+;; ->>HEADER<<- opcode: QUERY, status: BADVERS, id: 7
+;; flags: rd cd
+
+;; OPT PSEUDOSECTION:
+; EDNS: version: 0, flags: do; udp: 1232
+; COOKIE: 0102030405060708
+
+;; QUESTION SECTION:
+;example.com. IN SOA
+
+;; ADDITIONAL SECTION:
+example.com. 3600 IN SOA ns.example.com. hostmaster.example.com. (
+	1 7200 3600 ; serial refresh retry
+	1209600 300 )
+`
+
+	want := Message{
+		Header: Header{ID: 7, RecursionDesired: true, CheckingDisabled: true},
+		Question: []Question{
+			{Name: "example.com", Type: QTypeSOA, Class: ClassIN},
+		},
+		Additional: []ResourceRecord{
+			{
+				Name:  "example.com",
+				Type:  QTypeSOA,
+				Class: ClassIN,
+				TTL:   3600,
+				RData: &SOA{MName: "ns.example.com", RName: "hostmaster.example.com", Serial: 1, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 300},
+			},
+		},
+		EDNS: &EDNS{
+			UDPPayloadSize: 1232,
+			ExtendedRCode:  1,
+			DNSSECOK:       true,
+			Options:        []EDNSOption{{Code: EDNSOptionCodeCookie, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}}},
+		},
+	}
+
+	got, err := ParseMessage(text)
+	testing2.FailIfError(t, err)
+
+	testing2.Assert(t, got, want)
+}
@@ -0,0 +1,61 @@
+package proto
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/rokkerruslan/dnska/pkg/bv"
+)
+
+// EncodeTruncated encodes message "m" like Encode, but if the message
+// does not fit into the buffer of the encoder, the whole RRsets are
+// removed from the end of the message until it fits (RFC 2181
+// section 9). The additional section is truncated first, TC bit is
+// set only if the records of the answer or authority sections are
+// removed. OPT record is always kept (RFC 6891 section 7).
+func (enc *Encoder) EncodeTruncated(m Message) ([]byte, error) {
+	for {
+		buf, err := enc.Encode(m)
+
+		var bufErr *bv.ErrBuf
+		if !errors.As(err, &bufErr) {
+			return buf, err
+		}
+
+		switch {
+		case len(m.Additional) != 0:
+			m.Additional = m.Additional[:lastRRSet(m.Additional)]
+		case len(m.Authority) != 0:
+			m.Authority = m.Authority[:lastRRSet(m.Authority)]
+			m.Header.TruncateCation = true
+		case len(m.Answer) != 0:
+			m.Answer = m.Answer[:lastRRSet(m.Answer)]
+			m.Header.TruncateCation = true
+		default:
+			// Even the header and the question do not fit.
+			return buf, err
+		}
+
+		enc.bv.Seek(0)
+		enc.index.reset()
+	}
+}
+
+// lastRRSet returns the index of the first record of the last RRset
+// of "records", the records of RRset have the same name, type and
+// class.
+func lastRRSet(records []ResourceRecord) int {
+	last := records[len(records)-1]
+
+	i := len(records) - 1
+	for i > 0 {
+		prev := records[i-1]
+		if prev.Type != last.Type || prev.Class != last.Class || !strings.EqualFold(prev.Name, last.Name) {
+			break
+		}
+
+		i--
+	}
+
+	return i
+}
@@ -1,15 +1,23 @@
 package testing
 
 import (
+	"net/netip"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 )
 
+// comparers teach cmp how to compare types with unexported
+// fields that are used across the project.
+var comparers = []cmp.Option{
+	cmp.Comparer(func(a, b netip.Addr) bool { return a == b }),
+	cmp.Comparer(func(a, b netip.AddrPort) bool { return a == b }),
+}
+
 func Assert(t *testing.T, got, want interface{}) {
 	t.Helper()
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, comparers...); diff != "" {
 		t.Error(diff)
 	}
 }